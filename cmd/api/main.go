@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -16,7 +17,14 @@ import (
 	"github.com/peterlimg/supabase-e/internal/repository"
 	"github.com/peterlimg/supabase-e/internal/services"
 	"github.com/peterlimg/supabase-e/pkg/database"
+	"github.com/peterlimg/supabase-e/pkg/health"
+	"github.com/peterlimg/supabase-e/pkg/idempotency"
 	"github.com/peterlimg/supabase-e/pkg/logger"
+	"github.com/peterlimg/supabase-e/pkg/mailer"
+	"github.com/peterlimg/supabase-e/pkg/metrics"
+	"github.com/peterlimg/supabase-e/pkg/ratelimit"
+	"github.com/peterlimg/supabase-e/pkg/resilience"
+	"github.com/peterlimg/supabase-e/pkg/tracing"
 )
 
 func main() {
@@ -27,10 +35,16 @@ func main() {
 	}
 
 	// Setup logger
-	logger.Setup(cfg.LogLevel)
+	logger.Setup(cfg)
 	logger := logger.GetLogger("main")
 	logger.Info().Msg("Starting API server")
 
+	// Setup tracing
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to setup tracing")
+	}
+
 	// Initialize database connection
 	db := database.NewSupabaseClient(cfg)
 	logger.Info().Msg("Connected to Supabase")
@@ -38,18 +52,56 @@ func main() {
 	// Initialize repositories
 	userRepo := repository.NewUserRepository(db)
 	productRepo := repository.NewProductRepository(db)
+	productImageRepo := repository.NewProductImageRepository(db)
+	categoryRepo := repository.NewCategoryRepository(db)
+	stockRepo := repository.NewStockRepository(db)
+	productVariantRepo := repository.NewProductVariantRepository(db)
+	productRevisionRepo := repository.NewProductRevisionRepository(db)
+	importJobRepo := repository.NewImportJobRepository(db)
 
 	// Initialize services
-	authService := services.NewAuthService(userRepo, db, cfg)
-	productService := services.NewProductService(productRepo)
+	authService := services.NewAuthService(userRepo, db, mailer.NewLogMailer(), cfg)
+	productImageService := services.NewProductImageService(productRepo, productImageRepo, db, cfg)
+	categoryService := services.NewCategoryService(categoryRepo)
+	productVariantService := services.NewProductVariantService(productRepo, productVariantRepo, productImageRepo, cfg)
+	productService := services.NewProductService(productRepo, productRevisionRepo, productImageService, categoryService, productVariantService, cfg)
+	stockService := services.NewStockService(stockRepo, productRepo, productVariantRepo)
+	productImportService := services.NewProductImportService(productService, productRepo, importJobRepo, categoryService, cfg)
+
+	// Fail the imports that a previous run of this instance left unfinished
+	if err := productImportService.Recover(context.Background()); err != nil {
+		logger.Error().Err(err).Msg("Failed to recover import jobs")
+	}
+
+	// Register dependency health checks
+	healthRegistry := health.NewRegistry(cfg.HealthCheckTimeout, cfg.HealthCheckTTL)
+	healthRegistry.Register("postgrest", db.CheckPostgREST)
+	healthRegistry.Register("auth", db.CheckAuth)
+	healthRegistry.Register("postgrest_circuit", db.Breakers.Get(resilience.UpstreamPostgREST).Check)
+	healthRegistry.Register("auth_circuit", db.Breakers.Get(resilience.UpstreamAuth).Check)
+
+	// Rate limit buckets and idempotent responses are kept in process; swap
+	// in shared stores when running multiple instances
+	rateLimitStore := ratelimit.NewMemoryStore()
+	idempotencyStore := idempotency.NewMemoryStore()
 
 	// Setup router
-	router := handlers.SetupRouter(cfg, db, authService, productService)
+	router, err := handlers.SetupRouter(cfg, healthRegistry, rateLimitStore, idempotencyStore, authService, productService, productImageService, categoryService, stockService, productVariantService, productImportService)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to setup router")
+	}
+
+	// Derive every request context from a base context that is cancelled
+	// once graceful shutdown gives up, aborting in-flight Supabase calls
+	baseCtx, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
 
 	// Create HTTP server
 	server := &http.Server{
-		Addr:    fmt.Sprintf(":%d", cfg.Port),
-		Handler: router,
+		Addr:              fmt.Sprintf(":%d", cfg.Port),
+		Handler:           router,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return baseCtx },
 	}
 
 	// Start server in a goroutine
@@ -60,20 +112,82 @@ func main() {
 		}
 	}()
 
+	// Start the admin server exposing metrics on its own port if configured
+	var adminServer *http.Server
+	if cfg.MetricsEnabled && cfg.MetricsPort != 0 {
+		adminMux := http.NewServeMux()
+		adminMux.Handle(cfg.MetricsPath, metrics.Handler())
+		adminServer = &http.Server{
+			Addr:    fmt.Sprintf(":%d", cfg.MetricsPort),
+			Handler: adminMux,
+		}
+
+		go func() {
+			logger.Info().Int("port", cfg.MetricsPort).Msg("Admin server listening")
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Fatal().Err(err).Msg("Failed to start admin server")
+			}
+		}()
+	}
+
+	// Start the background jobs: purging products that have been in the
+	// trash past the retention period and applying publishing schedules
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go services.NewTrashPurger(productService, cfg).Run(jobsCtx)
+	go services.NewProductScheduler(productService, cfg).Run(jobsCtx)
+
 	// Wait for interrupt signal to gracefully shutdown the server
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	logger.Info().Msg("Shutting down server...")
+	stopJobs()
+
+	// Fail readiness first and give load balancers time to stop routing
+	// traffic to us before connections are closed
+	healthRegistry.SetShuttingDown()
+	logger.Info().Dur("delay", cfg.ShutdownDrainDelay).Msg("Draining traffic")
+	time.Sleep(cfg.ShutdownDrainDelay)
 
 	// Create a deadline to wait for
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
 
-	// Shutdown the server
+	// Shutdown the server, cancelling requests still running at the deadline.
+	// A forced shutdown still drains imports and flushes traces below.
+	forced := false
 	if err := server.Shutdown(ctx); err != nil {
-		logger.Fatal().Err(err).Msg("Server forced to shutdown")
+		cancelBase()
+		logger.Error().Err(err).Msg("Server forced to shutdown")
+		forced = true
+	}
+
+	// The remaining steps get their own deadline, since a forced server
+	// shutdown has used up the first one
+	cleanupCtx, cancelCleanup := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancelCleanup()
+
+	// Interrupt running imports and wait for them to record that they failed
+	if err := productImportService.Shutdown(cleanupCtx); err != nil {
+		logger.Error().Err(err).Msg("Imports did not stop in time")
 	}
 
+	// Shutdown the admin server
+	if adminServer != nil {
+		if err := adminServer.Shutdown(cleanupCtx); err != nil {
+			logger.Error().Err(err).Msg("Admin server forced to shutdown")
+		}
+	}
+
+	// Flush pending spans
+	if err := shutdownTracing(cleanupCtx); err != nil {
+		logger.Error().Err(err).Msg("Failed to flush traces")
+	}
+
+	if forced {
+		cancelCleanup()
+		os.Exit(1)
+	}
 	logger.Info().Msg("Server exited gracefully")
 }
@@ -2,24 +2,94 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/peterlimg/supabase-e/pkg/money"
 	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
 )
 
+// RateLimit is a rate limit of Requests per Period; a zero Requests disables it
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+}
+
 // Config holds all configuration for the application
 type Config struct {
-	Port               int
-	Environment        string
-	LogLevel           string
-	SupabaseURL        string
-	SupabaseKey        string
-	SupabaseServiceKey string
-	JWTSecret          string
-	JWTExpiry          time.Duration
+	Port                    int
+	Environment             string
+	LogLevel                string
+	LogFormat               string
+	LogFile                 string
+	LogMaxSizeMB            int
+	LogMaxBackups           int
+	LogMaxAgeDays           int
+	LogComponentLevels      map[string]string
+	LogRedactFields         []string
+	MetricsEnabled          bool
+	MetricsPath             string
+	MetricsPort             int
+	TracingExporter         string
+	TracingServiceName      string
+	TracingSampleRatio      float64
+	HealthCheckTimeout      time.Duration
+	HealthCheckTTL          time.Duration
+	ShutdownDrainDelay      time.Duration
+	ShutdownTimeout         time.Duration
+	RequestTimeout          time.Duration
+	SupabaseTimeout         time.Duration
+	SupabaseMaxRetries      int
+	SupabaseRetryBaseDelay  time.Duration
+	SupabaseRetryMaxDelay   time.Duration
+	BreakerFailureThreshold int
+	BreakerOpenTimeout      time.Duration
+	SupabaseURL             string
+	SupabaseKey             string
+	SupabaseServiceKey      string
+	RateLimitLogin          RateLimit
+	RateLimitAuth           RateLimit
+	RateLimitAPI            RateLimit
+	TrustedProxies          []string
+	LoginMaxFailures        int
+	LoginIPMaxFailures      int
+	LoginFailureWindow      time.Duration
+	LoginLockoutDuration    time.Duration
+	LoginDelayBase          time.Duration
+	LoginDelayMax           time.Duration
+	IdempotencyTTL          time.Duration
+	IdempotencyMaxBytes     int
+	RequireIfMatch          bool
+	DefaultCurrency         string
+	PriceFormat             money.Format
+	ExchangeRates           *money.Rates
+	FacetPriceBounds        []decimal.Decimal
+	SearchMinSimilarity     float64
+	TrashRetention          time.Duration
+	TrashPurgeInterval      time.Duration
+	PublishScheduleInterval time.Duration
+	ImportMaxBytes          int
+	ImportBatchSize         int
+	ImportJobTTL            time.Duration
+	ImportConcurrency       int
+	ImportMaxJobsPerUser    int
+	ExportPageSize          int
+	ExportTimeout           time.Duration
+	BatchMaxOperations      int
+	StorageBucket           string
+	StoragePublicBucket     bool
+	StorageSignedURLTTL     time.Duration
+	ImageMaxBytes           int
+	ImageMaxPerProduct      int
+	ImageMaxPixels          int
+	ImageVariantWidths      []int
+	JWTSecret               string
+	JWTExpiry               time.Duration
 }
 
 // LoadConfig loads configuration from environment variables
@@ -34,6 +104,11 @@ func LoadConfig() (*Config, error) {
 	port := 8080
 	env := "development"
 	logLevel := "info"
+	logFormat := ""
+	logMaxSizeMB := 100
+	logMaxBackups := 5
+	logMaxAgeDays := 30
+	logRedactFields := []string{"password", "token", "email", "api_key"}
 	jwtExpiry := 24 * time.Hour
 
 	// Parse port
@@ -54,6 +129,213 @@ func LoadConfig() (*Config, error) {
 		logLevel = os.Getenv("LOG_LEVEL")
 	}
 
+	// Parse log format, defaulting to JSON in production
+	if os.Getenv("LOG_FORMAT") != "" {
+		logFormat = strings.ToLower(os.Getenv("LOG_FORMAT"))
+	} else if env == "production" {
+		logFormat = "json"
+	} else {
+		logFormat = "console"
+	}
+
+	// Parse log file rotation settings
+	logMaxSizeMB = intEnv("LOG_MAX_SIZE_MB", logMaxSizeMB)
+	logMaxBackups = intEnv("LOG_MAX_BACKUPS", logMaxBackups)
+	logMaxAgeDays = intEnv("LOG_MAX_AGE_DAYS", logMaxAgeDays)
+
+	// Parse per-component log levels, e.g. "repository=debug,auth=warn"
+	logComponentLevels := map[string]string{}
+	for _, pair := range listEnv("LOG_COMPONENT_LEVELS") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) == 2 {
+			logComponentLevels[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+
+	// Parse redacted log fields
+	if fields := listEnv("LOG_REDACT_FIELDS"); len(fields) > 0 {
+		logRedactFields = fields
+	}
+
+	// Parse metrics settings; a non-zero METRICS_PORT serves the endpoint on a
+	// separate admin listener instead of the public router
+	metricsEnabled := os.Getenv("METRICS_ENABLED") != "false"
+	metricsPath := "/metrics"
+	if os.Getenv("METRICS_PATH") != "" {
+		metricsPath = os.Getenv("METRICS_PATH")
+	}
+	metricsPort := intEnv("METRICS_PORT", 0)
+
+	// Parse tracing settings
+	tracingExporter := strings.ToLower(os.Getenv("TRACING_EXPORTER"))
+	tracingServiceName := "supabase-e-api"
+	if os.Getenv("OTEL_SERVICE_NAME") != "" {
+		tracingServiceName = os.Getenv("OTEL_SERVICE_NAME")
+	}
+	tracingSampleRatio := 1.0
+	if os.Getenv("TRACING_SAMPLE_RATIO") != "" {
+		ratio, err := strconv.ParseFloat(os.Getenv("TRACING_SAMPLE_RATIO"), 64)
+		if err == nil {
+			tracingSampleRatio = ratio
+		}
+	}
+
+	// Parse health check and shutdown settings
+	healthCheckTimeout := durationEnv("HEALTH_CHECK_TIMEOUT", 2*time.Second)
+	healthCheckTTL := durationEnv("HEALTH_CHECK_CACHE_TTL", 5*time.Second)
+	shutdownDrainDelay := durationEnv("SHUTDOWN_DRAIN_DELAY", 5*time.Second)
+	shutdownTimeout := durationEnv("SHUTDOWN_TIMEOUT", 5*time.Second)
+
+	// Parse request and Supabase call timeouts (0 disables them)
+	requestTimeout := durationEnv("REQUEST_TIMEOUT", 30*time.Second)
+	supabaseTimeout := durationEnv("SUPABASE_TIMEOUT", 10*time.Second)
+
+	// Parse retry and circuit breaker settings (a zero threshold disables
+	// the breakers)
+	supabaseMaxRetries := intEnv("SUPABASE_MAX_RETRIES", 2)
+	supabaseRetryBaseDelay := durationEnv("SUPABASE_RETRY_BASE_DELAY", 100*time.Millisecond)
+	supabaseRetryMaxDelay := durationEnv("SUPABASE_RETRY_MAX_DELAY", 2*time.Second)
+	breakerFailureThreshold := intEnv("BREAKER_FAILURE_THRESHOLD", 5)
+	breakerOpenTimeout := durationEnv("BREAKER_OPEN_TIMEOUT", 30*time.Second)
+
+	// Parse rate limits, e.g. RATE_LIMIT_LOGIN=5/1m
+	rateLimitLogin, err := rateLimitEnv("RATE_LIMIT_LOGIN", RateLimit{Requests: 5, Period: time.Minute})
+	if err != nil {
+		return nil, err
+	}
+	rateLimitAuth, err := rateLimitEnv("RATE_LIMIT_AUTH", RateLimit{Requests: 20, Period: time.Minute})
+	if err != nil {
+		return nil, err
+	}
+	rateLimitAPI, err := rateLimitEnv("RATE_LIMIT_API", RateLimit{Requests: 300, Period: time.Minute})
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the proxies whose X-Forwarded-For headers are trusted for the
+	// client IP; by default none are, and the connection's address is used
+	trustedProxies := listEnv("TRUSTED_PROXIES")
+	for _, proxy := range trustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q", proxy)
+			}
+		}
+	}
+
+	// Parse login brute-force protection settings
+	loginMaxFailures := intEnv("LOGIN_MAX_FAILURES", 5)
+	loginIPMaxFailures := intEnv("LOGIN_IP_MAX_FAILURES", 20)
+	loginFailureWindow := durationEnv("LOGIN_FAILURE_WINDOW", 15*time.Minute)
+	loginLockoutDuration := durationEnv("LOGIN_LOCKOUT_DURATION", 15*time.Minute)
+	loginDelayBase := durationEnv("LOGIN_DELAY_BASE", time.Second)
+	loginDelayMax := durationEnv("LOGIN_DELAY_MAX", 30*time.Second)
+
+	// Parse how long idempotent responses are kept for replay
+	idempotencyTTL := durationEnv("IDEMPOTENCY_TTL", 24*time.Hour)
+	idempotencyMaxBytes := intEnv("IDEMPOTENCY_MAX_BYTES", 1<<20)
+
+	// Parse whether product writes must carry an If-Match header
+	requireIfMatch := os.Getenv("REQUIRE_IF_MATCH") != "false"
+
+	// Parse money settings; exchange rates are given against the default
+	// currency, e.g. EXCHANGE_RATES=EUR=0.92,GBP=0.79
+	defaultCurrency := "USD"
+	if os.Getenv("DEFAULT_CURRENCY") != "" {
+		defaultCurrency = strings.ToUpper(os.Getenv("DEFAULT_CURRENCY"))
+	}
+	priceFormat := money.FormatDecimal
+	if os.Getenv("PRICE_FORMAT") != "" {
+		priceFormat, err = money.ParseFormat(strings.ToLower(os.Getenv("PRICE_FORMAT")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid PRICE_FORMAT: %w", err)
+		}
+	}
+	exchangeRates, err := money.ParseRates(defaultCurrency, listEnv("EXCHANGE_RATES"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid money settings: %w", err)
+	}
+
+	// Parse the price range boundaries of product list facets, given in major
+	// units of the listing currency
+	facetPriceBounds := []decimal.Decimal{
+		decimal.NewFromInt(10), decimal.NewFromInt(25), decimal.NewFromInt(50),
+		decimal.NewFromInt(100), decimal.NewFromInt(250), decimal.NewFromInt(500),
+	}
+	if bounds := listEnv("FACET_PRICE_BOUNDS"); len(bounds) > 0 {
+		facetPriceBounds = nil
+		for _, b := range bounds {
+			bound, err := decimal.NewFromString(b)
+			if err != nil || !bound.IsPositive() ||
+				(len(facetPriceBounds) > 0 && !bound.GreaterThan(facetPriceBounds[len(facetPriceBounds)-1])) {
+				return nil, fmt.Errorf("invalid FACET_PRICE_BOUNDS %q", os.Getenv("FACET_PRICE_BOUNDS"))
+			}
+			facetPriceBounds = append(facetPriceBounds, bound)
+		}
+	}
+
+	// Parse the trigram similarity above which a product name matches a
+	// misspelled search query
+	searchMinSimilarity := 0.3
+	if os.Getenv("SEARCH_MIN_SIMILARITY") != "" {
+		searchMinSimilarity, err = strconv.ParseFloat(os.Getenv("SEARCH_MIN_SIMILARITY"), 64)
+		if err != nil || searchMinSimilarity <= 0 || searchMinSimilarity > 1 {
+			return nil, fmt.Errorf("invalid SEARCH_MIN_SIMILARITY %q", os.Getenv("SEARCH_MIN_SIMILARITY"))
+		}
+	}
+
+	// Parse how long trashed products are kept and how often they are
+	// purged; an interval of 0 disables purging
+	trashRetention := durationEnv("TRASH_RETENTION", 30*24*time.Hour)
+	trashPurgeInterval := durationEnv("TRASH_PURGE_INTERVAL", time.Hour)
+
+	// Parse how often scheduled publish and unpublish times are applied; 0
+	// disables the scheduler
+	publishScheduleInterval := durationEnv("PUBLISH_SCHEDULE_INTERVAL", time.Minute)
+
+	// Parse product import settings; finished jobs and their error reports
+	// are kept for the job TTL, and at most the given number of imports run
+	// at once
+	importMaxBytes := intEnv("IMPORT_MAX_BYTES", 50<<20)
+	importBatchSize := intEnv("IMPORT_BATCH_SIZE", 500)
+	importJobTTL := durationEnv("IMPORT_JOB_TTL", 24*time.Hour)
+	importConcurrency := intEnv("IMPORT_CONCURRENCY", 2)
+	importMaxJobsPerUser := intEnv("IMPORT_MAX_JOBS_PER_USER", 3)
+
+	// Parse product export settings; exports replace the request timeout
+	// with their own
+	exportPageSize := intEnv("EXPORT_PAGE_SIZE", 500)
+	exportTimeout := durationEnv("EXPORT_TIMEOUT", 10*time.Minute)
+
+	// Parse the largest number of operations in a product batch
+	batchMaxOperations := intEnv("BATCH_MAX_OPERATIONS", 500)
+
+	// Parse product image storage settings; private buckets are served
+	// through signed URLs
+	storageBucket := "product-images"
+	if os.Getenv("STORAGE_BUCKET") != "" {
+		storageBucket = os.Getenv("STORAGE_BUCKET")
+	}
+	storagePublicBucket := os.Getenv("STORAGE_PUBLIC_BUCKET") == "true"
+	storageSignedURLTTL := durationEnv("STORAGE_SIGNED_URL_TTL", time.Hour)
+	imageMaxBytes := intEnv("IMAGE_MAX_BYTES", 5<<20)
+	imageMaxPerProduct := intEnv("IMAGE_MAX_PER_PRODUCT", 10)
+
+	// Parse image processing settings; variants are generated for each width
+	// narrower than the uploaded image
+	imageMaxPixels := intEnv("IMAGE_MAX_PIXELS", 40_000_000)
+	imageVariantWidths := []int{160, 480, 1024}
+	if widths := listEnv("IMAGE_VARIANT_WIDTHS"); len(widths) > 0 {
+		imageVariantWidths = nil
+		for _, w := range widths {
+			width, err := strconv.Atoi(w)
+			if err != nil || width <= 0 {
+				return nil, fmt.Errorf("invalid IMAGE_VARIANT_WIDTHS %q", os.Getenv("IMAGE_VARIANT_WIDTHS"))
+			}
+			imageVariantWidths = append(imageVariantWidths, width)
+		}
+	}
+
 	// Parse JWT expiry
 	if os.Getenv("JWT_EXPIRY") != "" {
 		duration, err := time.ParseDuration(os.Getenv("JWT_EXPIRY"))
@@ -74,13 +356,131 @@ func LoadConfig() (*Config, error) {
 	}
 
 	return &Config{
-		Port:               port,
-		Environment:        env,
-		LogLevel:           logLevel,
-		SupabaseURL:        supabaseURL,
-		SupabaseKey:        supabaseKey,
-		SupabaseServiceKey: supabaseServiceKey,
-		JWTSecret:          jwtSecret,
-		JWTExpiry:          jwtExpiry,
+		Port:                    port,
+		Environment:             env,
+		LogLevel:                logLevel,
+		LogFormat:               logFormat,
+		LogFile:                 os.Getenv("LOG_FILE"),
+		LogMaxSizeMB:            logMaxSizeMB,
+		LogMaxBackups:           logMaxBackups,
+		LogMaxAgeDays:           logMaxAgeDays,
+		LogComponentLevels:      logComponentLevels,
+		LogRedactFields:         logRedactFields,
+		MetricsEnabled:          metricsEnabled,
+		MetricsPath:             metricsPath,
+		MetricsPort:             metricsPort,
+		TracingExporter:         tracingExporter,
+		TracingServiceName:      tracingServiceName,
+		TracingSampleRatio:      tracingSampleRatio,
+		HealthCheckTimeout:      healthCheckTimeout,
+		HealthCheckTTL:          healthCheckTTL,
+		ShutdownDrainDelay:      shutdownDrainDelay,
+		ShutdownTimeout:         shutdownTimeout,
+		RequestTimeout:          requestTimeout,
+		SupabaseTimeout:         supabaseTimeout,
+		SupabaseMaxRetries:      supabaseMaxRetries,
+		SupabaseRetryBaseDelay:  supabaseRetryBaseDelay,
+		SupabaseRetryMaxDelay:   supabaseRetryMaxDelay,
+		BreakerFailureThreshold: breakerFailureThreshold,
+		BreakerOpenTimeout:      breakerOpenTimeout,
+		SupabaseURL:             supabaseURL,
+		SupabaseKey:             supabaseKey,
+		SupabaseServiceKey:      supabaseServiceKey,
+		RateLimitLogin:          rateLimitLogin,
+		RateLimitAuth:           rateLimitAuth,
+		RateLimitAPI:            rateLimitAPI,
+		TrustedProxies:          trustedProxies,
+		LoginMaxFailures:        loginMaxFailures,
+		LoginIPMaxFailures:      loginIPMaxFailures,
+		LoginFailureWindow:      loginFailureWindow,
+		LoginLockoutDuration:    loginLockoutDuration,
+		LoginDelayBase:          loginDelayBase,
+		LoginDelayMax:           loginDelayMax,
+		IdempotencyTTL:          idempotencyTTL,
+		IdempotencyMaxBytes:     idempotencyMaxBytes,
+		RequireIfMatch:          requireIfMatch,
+		DefaultCurrency:         defaultCurrency,
+		PriceFormat:             priceFormat,
+		ExchangeRates:           exchangeRates,
+		FacetPriceBounds:        facetPriceBounds,
+		SearchMinSimilarity:     searchMinSimilarity,
+		TrashRetention:          trashRetention,
+		TrashPurgeInterval:      trashPurgeInterval,
+		PublishScheduleInterval: publishScheduleInterval,
+		ImportMaxBytes:          importMaxBytes,
+		ImportBatchSize:         importBatchSize,
+		ImportJobTTL:            importJobTTL,
+		ImportConcurrency:       importConcurrency,
+		ImportMaxJobsPerUser:    importMaxJobsPerUser,
+		ExportPageSize:          exportPageSize,
+		ExportTimeout:           exportTimeout,
+		BatchMaxOperations:      batchMaxOperations,
+		StorageBucket:           storageBucket,
+		StoragePublicBucket:     storagePublicBucket,
+		StorageSignedURLTTL:     storageSignedURLTTL,
+		ImageMaxBytes:           imageMaxBytes,
+		ImageMaxPerProduct:      imageMaxPerProduct,
+		ImageMaxPixels:          imageMaxPixels,
+		ImageVariantWidths:      imageVariantWidths,
+		JWTSecret:               jwtSecret,
+		JWTExpiry:               jwtExpiry,
 	}, nil
 }
+
+// intEnv returns the integer value of the named environment variable, or def
+// if it is unset or invalid
+func intEnv(name string, def int) int {
+	if v := os.Getenv(name); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			return i
+		}
+	}
+	return def
+}
+
+// durationEnv returns the duration value of the named environment variable,
+// or def if it is unset or invalid
+func durationEnv(name string, def time.Duration) time.Duration {
+	if v := os.Getenv(name); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return def
+}
+
+// rateLimitEnv parses the named environment variable as "<requests>/<period>"
+// (e.g. "100/1m"), returning def if it is unset
+func rateLimitEnv(name string, def RateLimit) (RateLimit, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+
+	parts := strings.SplitN(v, "/", 2)
+	if len(parts) != 2 {
+		return def, fmt.Errorf("invalid %s %q: expected <requests>/<period>", name, v)
+	}
+	requests, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || requests < 0 {
+		return def, fmt.Errorf("invalid %s %q: bad request count", name, v)
+	}
+	period, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+	if err != nil || period <= 0 {
+		return def, fmt.Errorf("invalid %s %q: bad period", name, v)
+	}
+
+	return RateLimit{Requests: requests, Period: period}, nil
+}
+
+// listEnv returns the comma separated values of the named environment
+// variable with surrounding whitespace and empty entries removed
+func listEnv(name string) []string {
+	var values []string
+	for _, v := range strings.Split(os.Getenv(name), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,13 @@
+-- Store product prices as fixed-precision decimals with an ISO 4217 currency
+
+ALTER TABLE products
+  ALTER COLUMN price TYPE NUMERIC(19, 4);
+
+ALTER TABLE products
+  ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD';
+
+-- Existing products may have a zero price, so the constraint is only checked
+-- for new and changed rows. Once such prices have been corrected, run
+--   ALTER TABLE products VALIDATE CONSTRAINT products_price_positive;
+ALTER TABLE products
+  ADD CONSTRAINT products_price_positive CHECK (price > 0) NOT VALID;
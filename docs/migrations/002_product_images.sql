@@ -0,0 +1,21 @@
+-- Keep ordered product images stored in Supabase Storage
+
+CREATE TABLE IF NOT EXISTS product_images (
+  id UUID PRIMARY KEY,
+  product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  path TEXT NOT NULL UNIQUE,
+  content_type TEXT NOT NULL,
+  size BIGINT NOT NULL,
+  position INTEGER NOT NULL DEFAULT 0,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_images_product ON product_images(product_id, position);
+
+-- Only the API (service role) accesses images
+ALTER TABLE product_images ENABLE ROW LEVEL SECURITY;
+
+-- Private bucket for the image files
+INSERT INTO storage.buckets (id, name, public)
+VALUES ('product-images', 'product-images', false)
+ON CONFLICT (id) DO NOTHING;
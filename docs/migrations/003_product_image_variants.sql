@@ -0,0 +1,4 @@
+-- Record the resized variants generated for each product image
+
+ALTER TABLE product_images
+  ADD COLUMN IF NOT EXISTS variants JSONB NOT NULL DEFAULT '[]';
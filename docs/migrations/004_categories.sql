@@ -0,0 +1,63 @@
+-- Turn the free-text products.category into a categories table. Every
+-- distinct existing value becomes a top-level category; values that slugify
+-- to the same slug are merged into one category.
+
+CREATE TABLE IF NOT EXISTS categories (
+  id UUID PRIMARY KEY,
+  name TEXT NOT NULL,
+  slug TEXT NOT NULL UNIQUE,
+  parent_id UUID REFERENCES categories(id) ON DELETE RESTRICT,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_categories_parent ON categories(parent_id);
+
+-- Slug used for the backfill; blank or symbol-only names become "uncategorized"
+CREATE TEMP TABLE category_backfill AS
+SELECT DISTINCT
+  category AS name,
+  COALESCE(
+    NULLIF(trim(BOTH '-' FROM regexp_replace(lower(trim(category)), '[^a-z0-9]+', '-', 'g')), ''),
+    'uncategorized'
+  ) AS slug
+FROM products;
+
+INSERT INTO categories (id, name, slug)
+SELECT gen_random_uuid(), MIN(trim(name)), slug
+FROM category_backfill
+GROUP BY slug
+ON CONFLICT (slug) DO NOTHING;
+
+ALTER TABLE products
+  ADD COLUMN IF NOT EXISTS category_id UUID REFERENCES categories(id) ON DELETE RESTRICT;
+
+UPDATE products p
+SET category_id = c.id
+FROM category_backfill b
+JOIN categories c ON c.slug = b.slug
+WHERE p.category = b.name;
+
+ALTER TABLE products ALTER COLUMN category_id SET NOT NULL;
+
+DROP INDEX IF EXISTS idx_products_category;
+ALTER TABLE products DROP COLUMN category;
+CREATE INDEX IF NOT EXISTS idx_products_category ON products(category_id);
+
+DROP TABLE category_backfill;
+
+ALTER TABLE categories ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY categories_read_all ON categories
+  FOR SELECT
+  USING (true);
+
+CREATE OR REPLACE FUNCTION category_product_counts()
+RETURNS TABLE (category_id UUID, product_count BIGINT) AS $$
+  SELECT category_id, COUNT(*) FROM products GROUP BY category_id;
+$$ LANGUAGE sql STABLE;
+
+CREATE TRIGGER update_categories_updated_at
+  BEFORE UPDATE ON categories
+  FOR EACH ROW
+  EXECUTE FUNCTION update_updated_at();
@@ -0,0 +1,7 @@
+-- Add free-form tags to products
+
+ALTER TABLE products
+  ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS idx_products_tags ON products USING GIN (tags);
+CREATE INDEX IF NOT EXISTS idx_products_created_at ON products(created_at DESC);
@@ -0,0 +1,81 @@
+-- Track product stock with an append-only ledger of stock movements
+
+ALTER TABLE products
+  ADD COLUMN IF NOT EXISTS stock_quantity INTEGER NOT NULL DEFAULT 0 CHECK (stock_quantity >= 0),
+  ADD COLUMN IF NOT EXISTS reserved_quantity INTEGER NOT NULL DEFAULT 0 CHECK (reserved_quantity >= 0),
+  ADD COLUMN IF NOT EXISTS low_stock_threshold INTEGER NOT NULL DEFAULT 0 CHECK (low_stock_threshold >= 0),
+  ADD COLUMN IF NOT EXISTS available_quantity INTEGER GENERATED ALWAYS AS (stock_quantity - reserved_quantity) STORED,
+  ADD CONSTRAINT products_reserved_within_stock CHECK (reserved_quantity <= stock_quantity);
+
+-- Stock movements table; an append-only ledger of every stock change with the
+-- levels it left the product at
+CREATE TABLE IF NOT EXISTS stock_movements (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  quantity_change INTEGER NOT NULL,
+  reserved_change INTEGER NOT NULL DEFAULT 0,
+  stock_quantity INTEGER NOT NULL,
+  reserved_quantity INTEGER NOT NULL,
+  reason TEXT NOT NULL CHECK (reason IN ('restock', 'sale', 'return', 'damage', 'correction', 'reservation', 'release')),
+  note TEXT,
+  created_by UUID REFERENCES users(id),
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_products_available ON products(available_quantity);
+CREATE INDEX IF NOT EXISTS idx_stock_movements_product ON stock_movements(product_id, created_at DESC);
+
+ALTER TABLE stock_movements ENABLE ROW LEVEL SECURITY;
+
+-- Atomically change the stock of a product and record the movement. The row
+-- lock taken by the update serializes concurrent adjustments, and the check
+-- constraints on products reject any that would leave the stock negative or
+-- below the reserved quantity.
+CREATE OR REPLACE FUNCTION adjust_stock(
+  p_product_id UUID,
+  p_quantity_change INTEGER,
+  p_reserved_change INTEGER,
+  p_reason TEXT,
+  p_note TEXT,
+  p_created_by UUID
+)
+RETURNS stock_movements AS $$
+DECLARE
+  new_stock INTEGER;
+  new_reserved INTEGER;
+  movement stock_movements;
+BEGIN
+  UPDATE products
+  SET stock_quantity = stock_quantity + p_quantity_change,
+      reserved_quantity = reserved_quantity + p_reserved_change
+  WHERE id = p_product_id
+  RETURNING stock_quantity, reserved_quantity INTO new_stock, new_reserved;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'product % not found', p_product_id USING ERRCODE = 'no_data_found';
+  END IF;
+
+  INSERT INTO stock_movements (product_id, quantity_change, reserved_change, stock_quantity, reserved_quantity, reason, note, created_by)
+  VALUES (p_product_id, p_quantity_change, p_reserved_change, new_stock, new_reserved, p_reason, NULLIF(p_note, ''), p_created_by)
+  RETURNING * INTO movement;
+
+  RETURN movement;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Keep the stock ledger append-only. Movements only go away together with
+-- their product, when the cascading delete no longer finds it.
+CREATE OR REPLACE FUNCTION prevent_stock_movement_changes()
+RETURNS TRIGGER AS $$
+BEGIN
+  IF TG_OP = 'DELETE' AND NOT EXISTS (SELECT 1 FROM products WHERE id = OLD.product_id) THEN
+    RETURN OLD;
+  END IF;
+  RAISE EXCEPTION 'stock movements are append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER stock_movements_append_only
+  BEFORE UPDATE OR DELETE ON stock_movements
+  FOR EACH ROW
+  EXECUTE FUNCTION prevent_stock_movement_changes();
@@ -0,0 +1,132 @@
+-- Product variants with their own SKU, price override, images and stock. The
+-- stock of a product with variants is the total of its variants.
+
+ALTER TABLE products
+  ADD COLUMN IF NOT EXISTS option_axes TEXT[] NOT NULL DEFAULT '{}';
+
+-- Product variants table; options map each option axis of the product to a
+-- value, and image_ids refer to images of the product
+CREATE TABLE IF NOT EXISTS product_variants (
+  id UUID PRIMARY KEY,
+  product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  sku TEXT NOT NULL UNIQUE,
+  options JSONB NOT NULL DEFAULT '{}',
+  price NUMERIC(19, 4) CHECK (price > 0),
+  image_ids UUID[] NOT NULL DEFAULT '{}',
+  stock_quantity INTEGER NOT NULL DEFAULT 0 CHECK (stock_quantity >= 0),
+  reserved_quantity INTEGER NOT NULL DEFAULT 0 CHECK (reserved_quantity >= 0),
+  low_stock_threshold INTEGER NOT NULL DEFAULT 0 CHECK (low_stock_threshold >= 0),
+  available_quantity INTEGER GENERATED ALWAYS AS (stock_quantity - reserved_quantity) STORED,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  CONSTRAINT product_variants_reserved_within_stock CHECK (reserved_quantity <= stock_quantity)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_product_variants_options ON product_variants(product_id, lower(options::TEXT));
+
+ALTER TABLE product_variants ENABLE ROW LEVEL SECURITY;
+
+-- Allow anyone to read variants; changes go through the API's service role
+CREATE POLICY product_variants_read_all ON product_variants
+  FOR SELECT
+  USING (true);
+
+ALTER TABLE stock_movements
+  ADD COLUMN IF NOT EXISTS variant_id UUID;
+
+-- adjust_stock gains the p_variant_id parameter
+DROP FUNCTION IF EXISTS adjust_stock(UUID, INTEGER, INTEGER, TEXT, TEXT, UUID);
+
+-- Atomically change the stock of a product, or of one of its variants when
+-- p_variant_id is set, and record the movement. A variant's change is also
+-- applied to the totals on its product. The row locks taken by the updates
+-- serialize concurrent adjustments, and the check constraints reject any that
+-- would leave the stock negative or below the reserved quantity.
+CREATE OR REPLACE FUNCTION adjust_stock(
+  p_product_id UUID,
+  p_variant_id UUID,
+  p_quantity_change INTEGER,
+  p_reserved_change INTEGER,
+  p_reason TEXT,
+  p_note TEXT,
+  p_created_by UUID
+)
+RETURNS stock_movements AS $$
+DECLARE
+  new_stock INTEGER;
+  new_reserved INTEGER;
+  movement stock_movements;
+BEGIN
+  IF p_variant_id IS NOT NULL THEN
+    UPDATE product_variants
+    SET stock_quantity = stock_quantity + p_quantity_change,
+        reserved_quantity = reserved_quantity + p_reserved_change
+    WHERE id = p_variant_id AND product_id = p_product_id
+    RETURNING stock_quantity, reserved_quantity INTO new_stock, new_reserved;
+
+    IF NOT FOUND THEN
+      RAISE EXCEPTION 'variant % of product % not found', p_variant_id, p_product_id USING ERRCODE = 'no_data_found';
+    END IF;
+
+    UPDATE products
+    SET stock_quantity = stock_quantity + p_quantity_change,
+        reserved_quantity = reserved_quantity + p_reserved_change
+    WHERE id = p_product_id;
+  ELSE
+    UPDATE products
+    SET stock_quantity = stock_quantity + p_quantity_change,
+        reserved_quantity = reserved_quantity + p_reserved_change
+    WHERE id = p_product_id
+    RETURNING stock_quantity, reserved_quantity INTO new_stock, new_reserved;
+
+    IF NOT FOUND THEN
+      RAISE EXCEPTION 'product % not found', p_product_id USING ERRCODE = 'no_data_found';
+    END IF;
+  END IF;
+
+  INSERT INTO stock_movements (product_id, variant_id, quantity_change, reserved_change, stock_quantity, reserved_quantity, reason, note, created_by)
+  VALUES (p_product_id, p_variant_id, p_quantity_change, p_reserved_change, new_stock, new_reserved, p_reason, NULLIF(p_note, ''), p_created_by)
+  RETURNING * INTO movement;
+
+  RETURN movement;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Keep the stock ledger complete by only deleting variants without stock,
+-- unless the whole product is being deleted
+CREATE OR REPLACE FUNCTION prevent_stocked_variant_delete()
+RETURNS TRIGGER AS $$
+BEGIN
+  IF (OLD.stock_quantity <> 0 OR OLD.reserved_quantity <> 0)
+     AND EXISTS (SELECT 1 FROM products WHERE id = OLD.product_id) THEN
+    RAISE EXCEPTION 'variant % still has stock', OLD.id USING ERRCODE = 'check_violation';
+  END IF;
+  RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Detach deleted images from the variants showing them
+CREATE OR REPLACE FUNCTION detach_variant_image()
+RETURNS TRIGGER AS $$
+BEGIN
+  UPDATE product_variants
+  SET image_ids = array_remove(image_ids, OLD.id)
+  WHERE product_id = OLD.product_id AND OLD.id = ANY(image_ids);
+  RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER update_product_variants_updated_at
+  BEFORE UPDATE ON product_variants
+  FOR EACH ROW
+  EXECUTE FUNCTION update_updated_at();
+
+CREATE TRIGGER product_variants_keep_stock
+  BEFORE DELETE ON product_variants
+  FOR EACH ROW
+  EXECUTE FUNCTION prevent_stocked_variant_delete();
+
+CREATE TRIGGER product_images_detach_variants
+  AFTER DELETE ON product_images
+  FOR EACH ROW
+  EXECUTE FUNCTION detach_variant_image();
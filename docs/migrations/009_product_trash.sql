@@ -0,0 +1,48 @@
+-- Soft delete for products. Deleted products stay in the trash, hidden from
+-- listings and search, until they are restored or purged.
+
+ALTER TABLE products
+  ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_products_deleted_at ON products(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Count the products directly in each category, leaving out trashed ones
+CREATE OR REPLACE FUNCTION category_product_counts()
+RETURNS TABLE (category_id UUID, product_count BIGINT) AS $$
+  SELECT category_id, COUNT(*) FROM products WHERE deleted_at IS NULL GROUP BY category_id;
+$$ LANGUAGE sql STABLE;
+
+-- Full-text product search ranked by relevance. Every query word matches as a
+-- prefix, and product names within min_similarity trigram word similarity of
+-- the query match even when misspelled. Matched terms are wrapped in <mark>
+-- tags in name_highlight and snippet.
+CREATE OR REPLACE FUNCTION search_products(
+  search_query TEXT,
+  min_similarity REAL DEFAULT 0.3,
+  result_limit INTEGER DEFAULT 10,
+  result_offset INTEGER DEFAULT 0
+)
+RETURNS TABLE (product products, rank REAL, name_highlight TEXT, snippet TEXT) AS $$
+DECLARE
+  prefix_query tsquery;
+BEGIN
+  SELECT to_tsquery('english', string_agg(word || ':*', ' & '))
+  INTO prefix_query
+  FROM regexp_split_to_table(lower(search_query), '[^[:alnum:]]+') AS word
+  WHERE word <> '';
+
+  PERFORM set_config('pg_trgm.word_similarity_threshold', min_similarity::TEXT, true);
+
+  RETURN QUERY
+  SELECT
+    p,
+    (COALESCE(ts_rank_cd(p.search_vector, prefix_query), 0) + word_similarity(search_query, p.name))::REAL AS rank,
+    ts_headline('english', p.name, prefix_query, 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true'),
+    ts_headline('english', p.description, prefix_query, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5')
+  FROM products p
+  WHERE p.deleted_at IS NULL
+    AND (p.search_vector @@ prefix_query OR search_query <% p.name)
+  ORDER BY 2 DESC, p.created_at DESC
+  LIMIT result_limit OFFSET result_offset;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,61 @@
+-- Revision history of products. Existing products get their current state
+-- as revision 1.
+
+-- Product revisions table; a snapshot of the editable fields of a product
+-- each time it is created or changed
+CREATE TABLE IF NOT EXISTS product_revisions (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  revision INTEGER NOT NULL CHECK (revision > 0),
+  snapshot JSONB NOT NULL,
+  created_by UUID REFERENCES users(id),
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  UNIQUE (product_id, revision)
+);
+
+ALTER TABLE product_revisions ENABLE ROW LEVEL SECURITY;
+
+-- Record a snapshot as the next revision of a product. Locking the product
+-- row numbers concurrent revisions one after another.
+CREATE OR REPLACE FUNCTION add_product_revision(
+  p_product_id UUID,
+  p_snapshot JSONB,
+  p_created_by UUID
+)
+RETURNS product_revisions AS $$
+DECLARE
+  revision_row product_revisions;
+BEGIN
+  PERFORM 1 FROM products WHERE id = p_product_id FOR UPDATE;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'product % not found', p_product_id USING ERRCODE = 'no_data_found';
+  END IF;
+
+  INSERT INTO product_revisions (product_id, revision, snapshot, created_by)
+  SELECT p_product_id, COALESCE(MAX(revision), 0) + 1, p_snapshot, p_created_by
+  FROM product_revisions
+  WHERE product_id = p_product_id
+  RETURNING * INTO revision_row;
+
+  RETURN revision_row;
+END;
+$$ LANGUAGE plpgsql;
+
+INSERT INTO product_revisions (product_id, revision, snapshot, created_by, created_at)
+SELECT
+  id,
+  1,
+  jsonb_build_object(
+    'name', name,
+    'description', description,
+    'price', trim_scale(price)::TEXT,
+    'currency', currency,
+    'category_id', category_id,
+    'tags', to_jsonb(tags),
+    'option_axes', to_jsonb(option_axes),
+    'image_url', image_url
+  ),
+  created_by,
+  updated_at
+FROM products
+ON CONFLICT (product_id, revision) DO NOTHING;
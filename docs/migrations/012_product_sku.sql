@@ -0,0 +1,5 @@
+-- Stock keeping units for products, which bulk imports use to find the
+-- products a row updates. Products without a SKU keep it NULL.
+
+ALTER TABLE products
+  ADD COLUMN IF NOT EXISTS sku TEXT UNIQUE;
@@ -0,0 +1,103 @@
+-- Batch product writes. Atomic batches are applied by batch_write_products,
+-- which writes every operation in one transaction.
+
+-- Snapshot the editable fields of a product, as recorded in its revisions
+CREATE OR REPLACE FUNCTION product_snapshot(p products)
+RETURNS JSONB AS $$
+  SELECT jsonb_build_object(
+    'name', p.name,
+    'description', p.description,
+    'price', trim_scale(p.price)::TEXT,
+    'currency', p.currency,
+    'category_id', p.category_id,
+    'tags', to_jsonb(p.tags),
+    'option_axes', to_jsonb(p.option_axes),
+    'image_url', p.image_url
+  );
+$$ LANGUAGE sql IMMUTABLE;
+
+-- Apply a batch of product writes in one transaction, returning the written
+-- products in order. Creates insert the given product, updates replace its
+-- editable fields and deletes move it to the trash; updates and deletes only
+-- apply to the version of the product given as expected_updated_at. Creates
+-- and updates record a revision by p_user_id. If any write fails the whole
+-- batch is rolled back, and the error detail holds the index of that write.
+CREATE OR REPLACE FUNCTION batch_write_products(
+  p_writes JSONB,
+  p_user_id UUID
+)
+RETURNS SETOF products AS $$
+DECLARE
+  write_index INTEGER;
+  batch_write JSONB;
+  new_row products;
+  product_row products;
+  error_state TEXT;
+  error_message TEXT;
+BEGIN
+  FOR write_index, batch_write IN
+    SELECT ordinality - 1, value FROM jsonb_array_elements(p_writes) WITH ORDINALITY
+  LOOP
+    BEGIN
+      new_row := jsonb_populate_record(NULL::products, batch_write->'product');
+
+      CASE batch_write->>'op'
+        WHEN 'create' THEN
+          INSERT INTO products (
+            id, sku, name, description, price, currency, category_id, tags,
+            option_axes, image_url, status, publish_at, unpublish_at,
+            low_stock_threshold, created_by, created_at, updated_at
+          )
+          VALUES (
+            new_row.id, new_row.sku, new_row.name, new_row.description,
+            new_row.price, new_row.currency, new_row.category_id, COALESCE(new_row.tags, '{}'),
+            COALESCE(new_row.option_axes, '{}'), new_row.image_url, new_row.status,
+            new_row.publish_at, new_row.unpublish_at, new_row.low_stock_threshold,
+            new_row.created_by, new_row.created_at, new_row.updated_at
+          )
+          RETURNING * INTO product_row;
+        WHEN 'update' THEN
+          UPDATE products SET
+            name = new_row.name,
+            description = new_row.description,
+            price = new_row.price,
+            currency = new_row.currency,
+            category_id = new_row.category_id,
+            tags = COALESCE(new_row.tags, '{}'),
+            option_axes = CASE
+              WHEN batch_write->'product' ? 'option_axes' THEN new_row.option_axes
+              ELSE products.option_axes
+            END,
+            image_url = new_row.image_url
+          WHERE id = (batch_write->>'id')::UUID
+            AND deleted_at IS NULL
+            AND updated_at = (batch_write->>'expected_updated_at')::TIMESTAMPTZ
+          RETURNING * INTO product_row;
+        WHEN 'delete' THEN
+          UPDATE products SET deleted_at = NOW()
+          WHERE id = (batch_write->>'id')::UUID
+            AND deleted_at IS NULL
+            AND updated_at = (batch_write->>'expected_updated_at')::TIMESTAMPTZ
+          RETURNING * INTO product_row;
+      END CASE;
+
+      IF NOT FOUND THEN
+        PERFORM 1 FROM products WHERE id = (batch_write->>'id')::UUID AND deleted_at IS NULL;
+        IF FOUND THEN
+          RAISE EXCEPTION 'product % was modified', batch_write->>'id' USING ERRCODE = 'PT412';
+        END IF;
+        RAISE EXCEPTION 'product % not found', batch_write->>'id' USING ERRCODE = 'no_data_found';
+      END IF;
+
+      IF batch_write->>'op' <> 'delete' THEN
+        PERFORM add_product_revision(product_row.id, product_snapshot(product_row), p_user_id);
+      END IF;
+    EXCEPTION WHEN OTHERS THEN
+      GET STACKED DIAGNOSTICS error_state = RETURNED_SQLSTATE, error_message = MESSAGE_TEXT;
+      RAISE EXCEPTION USING ERRCODE = error_state, MESSAGE = error_message, DETAIL = write_index::TEXT;
+    END;
+
+    RETURN NEXT product_row;
+  END LOOP;
+END;
+$$ LANGUAGE plpgsql;
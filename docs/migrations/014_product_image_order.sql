@@ -0,0 +1,81 @@
+-- Add and reorder product images in the database, so that concurrent uploads
+-- respect the image limit and get unique positions.
+
+-- Append an image to a product, numbering it after the product's last image.
+-- Locking the product row serializes concurrent uploads, so that the image
+-- limit holds and positions stay unique. The product gets a new version.
+CREATE OR REPLACE FUNCTION add_product_image(
+  p_image JSONB,
+  p_max_images INTEGER
+)
+RETURNS product_images AS $$
+DECLARE
+  new_image product_images;
+  image_row product_images;
+  image_count INTEGER;
+BEGIN
+  new_image := jsonb_populate_record(NULL::product_images, p_image);
+
+  UPDATE products SET updated_at = NOW()
+  WHERE id = new_image.product_id AND deleted_at IS NULL;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'product % not found', new_image.product_id USING ERRCODE = 'no_data_found';
+  END IF;
+
+  SELECT COUNT(*) INTO image_count FROM product_images WHERE product_id = new_image.product_id;
+  IF image_count >= p_max_images THEN
+    RAISE EXCEPTION 'product % already has % images', new_image.product_id, image_count
+      USING ERRCODE = 'program_limit_exceeded';
+  END IF;
+
+  INSERT INTO product_images (id, product_id, path, content_type, size, position, variants, created_at)
+  SELECT
+    new_image.id,
+    new_image.product_id,
+    new_image.path,
+    new_image.content_type,
+    new_image.size,
+    COALESCE(MAX(position), -1) + 1,
+    COALESCE(new_image.variants, '[]'),
+    COALESCE(new_image.created_at, NOW())
+  FROM product_images
+  WHERE product_id = new_image.product_id
+  RETURNING * INTO image_row;
+
+  RETURN image_row;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Set the display order of the images of a product in one statement. The
+-- given IDs must list every image of the product exactly once. The product
+-- gets a new version.
+CREATE OR REPLACE FUNCTION reorder_product_images(
+  p_product_id UUID,
+  p_image_ids UUID[]
+)
+RETURNS SETOF product_images AS $$
+BEGIN
+  UPDATE products SET updated_at = NOW()
+  WHERE id = p_product_id AND deleted_at IS NULL;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'product % not found', p_product_id USING ERRCODE = 'no_data_found';
+  END IF;
+
+  IF cardinality(p_image_ids) <> (SELECT COUNT(*) FROM product_images WHERE product_id = p_product_id)
+    OR cardinality(p_image_ids) <> (
+      SELECT COUNT(DISTINCT i.id)
+      FROM product_images i
+      WHERE i.product_id = p_product_id AND i.id = ANY (p_image_ids)
+    ) THEN
+    RAISE EXCEPTION 'image order must list every image of product % exactly once', p_product_id
+      USING ERRCODE = 'invalid_parameter_value';
+  END IF;
+
+  UPDATE product_images i SET position = ordered.ordinality - 1
+  FROM unnest(p_image_ids) WITH ORDINALITY AS ordered(id, ordinality)
+  WHERE i.id = ordered.id AND i.position <> ordered.ordinality - 1;
+
+  RETURN QUERY
+  SELECT * FROM product_images WHERE product_id = p_product_id ORDER BY position;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,56 @@
+-- Count listing facets in the database instead of fetching every matching
+-- product.
+
+-- Count the products matching a listing filter per category, tag and price
+-- range in one object, so that no row limit truncates the counts. Filters
+-- left NULL match every product. Prices are converted with the factors in
+-- p_rates, keyed by currency, and rounded to p_exponent decimal places;
+-- products in other currencies are left out of the price ranges. Range i
+-- holds the prices from p_bounds[i] up to p_bounds[i + 1].
+CREATE OR REPLACE FUNCTION product_facet_counts(
+  p_category_ids UUID[],
+  p_tags TEXT[],
+  p_match_all_tags BOOLEAN,
+  p_in_stock BOOLEAN,
+  p_status TEXT,
+  p_created_by UUID,
+  p_rates JSONB,
+  p_exponent INTEGER,
+  p_bounds NUMERIC[]
+)
+RETURNS JSONB AS $$
+  WITH matching AS (
+    SELECT category_id, tags, price, currency
+    FROM products
+    WHERE deleted_at IS NULL
+      AND (p_category_ids IS NULL OR category_id = ANY(p_category_ids))
+      AND (p_tags IS NULL OR CASE WHEN p_match_all_tags THEN tags @> p_tags ELSE tags && p_tags END)
+      AND (p_in_stock IS NULL OR (available_quantity > 0) = p_in_stock)
+      AND (p_status IS NULL OR status = p_status)
+      AND (p_created_by IS NULL OR created_by = p_created_by)
+  )
+  SELECT jsonb_build_object(
+    'categories', (
+      SELECT COALESCE(jsonb_object_agg(category_id, n), '{}')
+      FROM (SELECT category_id, COUNT(*) AS n FROM matching GROUP BY category_id) c
+    ),
+    'tags', (
+      SELECT COALESCE(jsonb_object_agg(tag, n), '{}')
+      FROM (SELECT tag, COUNT(*) AS n FROM matching, unnest(tags) AS tag GROUP BY tag) t
+    ),
+    'price_ranges', (
+      SELECT COALESCE(jsonb_object_agg(price_range, n), '{}')
+      FROM (
+        SELECT
+          CASE WHEN cardinality(p_bounds) > 0
+            THEN width_bucket(ROUND(price * (p_rates->>currency)::NUMERIC, p_exponent), p_bounds)
+            ELSE 0
+          END AS price_range,
+          COUNT(*) AS n
+        FROM matching
+        WHERE p_rates ? currency
+        GROUP BY 1
+      ) r
+    )
+  );
+$$ LANGUAGE sql STABLE;
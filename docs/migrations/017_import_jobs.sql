@@ -0,0 +1,32 @@
+-- Store product import jobs, so that their progress and error reports
+-- survive a restart of the API. worker names the instance running a job.
+
+CREATE TABLE IF NOT EXISTS import_jobs (
+  id UUID PRIMARY KEY,
+  status TEXT NOT NULL CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+  format TEXT NOT NULL CHECK (format IN ('csv', 'ndjson')),
+  dry_run BOOLEAN NOT NULL DEFAULT FALSE,
+  created_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  worker TEXT NOT NULL,
+  rows INTEGER NOT NULL DEFAULT 0,
+  created INTEGER NOT NULL DEFAULT 0,
+  updated INTEGER NOT NULL DEFAULT 0,
+  failed INTEGER NOT NULL DEFAULT 0,
+  errors JSONB NOT NULL DEFAULT '[]',
+  error TEXT,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_import_jobs_unfinished ON import_jobs(worker, updated_at) WHERE finished_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_import_jobs_finished_at ON import_jobs(finished_at) WHERE finished_at IS NOT NULL;
+
+ALTER TABLE import_jobs ENABLE ROW LEVEL SECURITY;
+
+-- updated_at shows when a running job last made progress
+DROP TRIGGER IF EXISTS update_import_jobs_updated_at ON import_jobs;
+CREATE TRIGGER update_import_jobs_updated_at
+  BEFORE UPDATE ON import_jobs
+  FOR EACH ROW
+  EXECUTE FUNCTION update_updated_at();
@@ -1,5 +1,8 @@
 -- Schema for Supabase database
 
+-- Trigram matching for typo tolerant product search
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
 -- Users table
 CREATE TABLE IF NOT EXISTS users (
   id UUID PRIMARY KEY,
@@ -11,28 +14,157 @@ CREATE TABLE IF NOT EXISTS users (
   updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
 
+-- Categories table; parent_id forms the category hierarchy
+CREATE TABLE IF NOT EXISTS categories (
+  id UUID PRIMARY KEY,
+  name TEXT NOT NULL,
+  slug TEXT NOT NULL UNIQUE,
+  parent_id UUID REFERENCES categories(id) ON DELETE RESTRICT,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
 -- Products table
 CREATE TABLE IF NOT EXISTS products (
   id UUID PRIMARY KEY,
+  sku TEXT UNIQUE,
   name TEXT NOT NULL,
   description TEXT NOT NULL,
-  price DECIMAL NOT NULL,
-  category TEXT NOT NULL,
+  price NUMERIC(19, 4) NOT NULL CHECK (price > 0),
+  currency CHAR(3) NOT NULL DEFAULT 'USD',
+  category_id UUID NOT NULL REFERENCES categories(id) ON DELETE RESTRICT,
+  tags TEXT[] NOT NULL DEFAULT '{}',
+  option_axes TEXT[] NOT NULL DEFAULT '{}',
   image_url TEXT,
+  status TEXT NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'published', 'archived')),
+  publish_at TIMESTAMP WITH TIME ZONE,
+  unpublish_at TIMESTAMP WITH TIME ZONE,
+  stock_quantity INTEGER NOT NULL DEFAULT 0 CHECK (stock_quantity >= 0),
+  reserved_quantity INTEGER NOT NULL DEFAULT 0 CHECK (reserved_quantity >= 0),
+  low_stock_threshold INTEGER NOT NULL DEFAULT 0 CHECK (low_stock_threshold >= 0),
+  available_quantity INTEGER GENERATED ALWAYS AS (stock_quantity - reserved_quantity) STORED,
+  search_vector TSVECTOR GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(description, '')), 'B')
+  ) STORED,
   created_by UUID REFERENCES users(id),
+  edited_by UUID REFERENCES users(id),
   created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-  updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  deleted_at TIMESTAMP WITH TIME ZONE,
+  CONSTRAINT products_reserved_within_stock CHECK (reserved_quantity <= stock_quantity)
+);
+
+-- Product images table; the files live in the Supabase Storage bucket
+-- configured with STORAGE_BUCKET
+CREATE TABLE IF NOT EXISTS product_images (
+  id UUID PRIMARY KEY,
+  product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  path TEXT NOT NULL UNIQUE,
+  content_type TEXT NOT NULL,
+  size BIGINT NOT NULL,
+  position INTEGER NOT NULL DEFAULT 0,
+  variants JSONB NOT NULL DEFAULT '[]',
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Product variants table; options map each option axis of the product to a
+-- value, and image_ids refer to images of the product
+CREATE TABLE IF NOT EXISTS product_variants (
+  id UUID PRIMARY KEY,
+  product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  sku TEXT NOT NULL UNIQUE,
+  options JSONB NOT NULL DEFAULT '{}',
+  price NUMERIC(19, 4) CHECK (price > 0),
+  image_ids UUID[] NOT NULL DEFAULT '{}',
+  stock_quantity INTEGER NOT NULL DEFAULT 0 CHECK (stock_quantity >= 0),
+  reserved_quantity INTEGER NOT NULL DEFAULT 0 CHECK (reserved_quantity >= 0),
+  low_stock_threshold INTEGER NOT NULL DEFAULT 0 CHECK (low_stock_threshold >= 0),
+  available_quantity INTEGER GENERATED ALWAYS AS (stock_quantity - reserved_quantity) STORED,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  CONSTRAINT product_variants_reserved_within_stock CHECK (reserved_quantity <= stock_quantity)
+);
+
+-- Product revisions table; a snapshot of the editable fields of a product
+-- each time it is created or changed
+CREATE TABLE IF NOT EXISTS product_revisions (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  revision INTEGER NOT NULL CHECK (revision > 0),
+  snapshot JSONB NOT NULL,
+  created_by UUID REFERENCES users(id),
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  UNIQUE (product_id, revision)
+);
+
+-- Stock movements table; an append-only ledger of every stock change with the
+-- levels it left the product at
+CREATE TABLE IF NOT EXISTS stock_movements (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  -- Not a foreign key so that the history outlives deleted variants
+  variant_id UUID,
+  quantity_change INTEGER NOT NULL,
+  reserved_change INTEGER NOT NULL DEFAULT 0,
+  stock_quantity INTEGER NOT NULL,
+  reserved_quantity INTEGER NOT NULL,
+  reason TEXT NOT NULL CHECK (reason IN ('restock', 'sale', 'return', 'damage', 'correction', 'reservation', 'release')),
+  note TEXT,
+  created_by UUID REFERENCES users(id),
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Import jobs table; the progress and failed rows of product imports.
+-- worker names the instance running a job.
+CREATE TABLE IF NOT EXISTS import_jobs (
+  id UUID PRIMARY KEY,
+  status TEXT NOT NULL CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+  format TEXT NOT NULL CHECK (format IN ('csv', 'ndjson')),
+  dry_run BOOLEAN NOT NULL DEFAULT FALSE,
+  created_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  worker TEXT NOT NULL,
+  rows INTEGER NOT NULL DEFAULT 0,
+  created INTEGER NOT NULL DEFAULT 0,
+  updated INTEGER NOT NULL DEFAULT 0,
+  failed INTEGER NOT NULL DEFAULT 0,
+  errors JSONB NOT NULL DEFAULT '[]',
+  error TEXT,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  finished_at TIMESTAMP WITH TIME ZONE
 );
 
 -- Create indexes for better performance
-CREATE INDEX IF NOT EXISTS idx_products_category ON products(category);
+CREATE INDEX IF NOT EXISTS idx_categories_parent ON categories(parent_id);
+CREATE INDEX IF NOT EXISTS idx_products_category ON products(category_id);
+CREATE INDEX IF NOT EXISTS idx_products_tags ON products USING GIN (tags);
+CREATE INDEX IF NOT EXISTS idx_products_created_at ON products(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_products_search ON products USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_products_name_trgm ON products USING GIN (name gin_trgm_ops);
 CREATE INDEX IF NOT EXISTS idx_products_created_by ON products(created_by);
+CREATE INDEX IF NOT EXISTS idx_products_available ON products(available_quantity);
+CREATE INDEX IF NOT EXISTS idx_products_status ON products(status, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_products_publish_at ON products(publish_at) WHERE status = 'draft' AND publish_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_products_unpublish_at ON products(unpublish_at) WHERE status = 'published' AND unpublish_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_products_deleted_at ON products(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_product_variants_options ON product_variants(product_id, lower(options::TEXT));
+CREATE INDEX IF NOT EXISTS idx_stock_movements_product ON stock_movements(product_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_product_images_product ON product_images(product_id, position);
+CREATE INDEX IF NOT EXISTS idx_import_jobs_unfinished ON import_jobs(worker, updated_at) WHERE finished_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_import_jobs_finished_at ON import_jobs(finished_at) WHERE finished_at IS NOT NULL;
 
 -- Row Level Security (RLS) policies
 
 -- Enable RLS on tables
 ALTER TABLE users ENABLE ROW LEVEL SECURITY;
+ALTER TABLE categories ENABLE ROW LEVEL SECURITY;
 ALTER TABLE products ENABLE ROW LEVEL SECURITY;
+ALTER TABLE product_images ENABLE ROW LEVEL SECURITY;
+ALTER TABLE product_variants ENABLE ROW LEVEL SECURITY;
+ALTER TABLE product_revisions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE stock_movements ENABLE ROW LEVEL SECURITY;
+ALTER TABLE import_jobs ENABLE ROW LEVEL SECURITY;
 
 -- Users policies
 -- Allow users to read their own profile
@@ -45,6 +177,12 @@ CREATE POLICY users_update_own ON users
   FOR UPDATE
   USING (auth.uid() = id);
 
+-- Categories policies
+-- Allow anyone to read categories; changes go through the API's service role
+CREATE POLICY categories_read_all ON categories
+  FOR SELECT
+  USING (true);
+
 -- Products policies
 -- Allow anyone to read products
 CREATE POLICY products_read_all ON products
@@ -66,6 +204,12 @@ CREATE POLICY products_delete_own ON products
   FOR DELETE
   USING (auth.uid() = created_by);
 
+-- Product variants policies
+-- Allow anyone to read variants; changes go through the API's service role
+CREATE POLICY product_variants_read_all ON product_variants
+  FOR SELECT
+  USING (true);
+
 -- Create a function to update the updated_at timestamp
 CREATE OR REPLACE FUNCTION update_updated_at()
 RETURNS TRIGGER AS $$
@@ -75,6 +219,411 @@ BEGIN
 END;
 $$ LANGUAGE plpgsql;
 
+-- Count the published products directly in each category, leaving out
+-- trashed ones
+CREATE OR REPLACE FUNCTION category_product_counts()
+RETURNS TABLE (category_id UUID, product_count BIGINT) AS $$
+  SELECT category_id, COUNT(*)
+  FROM products
+  WHERE deleted_at IS NULL AND status = 'published'
+  GROUP BY category_id;
+$$ LANGUAGE sql STABLE;
+
+-- Full-text search over published products ranked by relevance. Every query
+-- word matches as a prefix, and product names within min_similarity trigram
+-- word similarity of the query match even when misspelled. Matched terms are
+-- wrapped in <mark> tags in name_highlight and snippet.
+CREATE OR REPLACE FUNCTION search_products(
+  search_query TEXT,
+  min_similarity REAL DEFAULT 0.3,
+  result_limit INTEGER DEFAULT 10,
+  result_offset INTEGER DEFAULT 0
+)
+RETURNS TABLE (product products, rank REAL, name_highlight TEXT, snippet TEXT) AS $$
+DECLARE
+  prefix_query tsquery;
+BEGIN
+  SELECT to_tsquery('english', string_agg(word || ':*', ' & '))
+  INTO prefix_query
+  FROM regexp_split_to_table(lower(search_query), '[^[:alnum:]]+') AS word
+  WHERE word <> '';
+
+  PERFORM set_config('pg_trgm.word_similarity_threshold', min_similarity::TEXT, true);
+
+  RETURN QUERY
+  SELECT
+    p,
+    (COALESCE(ts_rank_cd(p.search_vector, prefix_query), 0) + word_similarity(search_query, p.name))::REAL AS rank,
+    ts_headline('english', p.name, prefix_query, 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true'),
+    ts_headline('english', p.description, prefix_query, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5')
+  FROM products p
+  WHERE p.deleted_at IS NULL
+    AND p.status = 'published'
+    AND (p.search_vector @@ prefix_query OR search_query <% p.name)
+  ORDER BY 2 DESC, p.created_at DESC
+  LIMIT result_limit OFFSET result_offset;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Count the products matching a listing filter per category, tag and price
+-- range in one object, so that no row limit truncates the counts. Filters
+-- left NULL match every product. Prices are converted with the factors in
+-- p_rates, keyed by currency, and rounded to p_exponent decimal places;
+-- products in other currencies are left out of the price ranges. Range i
+-- holds the prices from p_bounds[i] up to p_bounds[i + 1].
+CREATE OR REPLACE FUNCTION product_facet_counts(
+  p_category_ids UUID[],
+  p_tags TEXT[],
+  p_match_all_tags BOOLEAN,
+  p_in_stock BOOLEAN,
+  p_status TEXT,
+  p_created_by UUID,
+  p_rates JSONB,
+  p_exponent INTEGER,
+  p_bounds NUMERIC[]
+)
+RETURNS JSONB AS $$
+  WITH matching AS (
+    SELECT category_id, tags, price, currency
+    FROM products
+    WHERE deleted_at IS NULL
+      AND (p_category_ids IS NULL OR category_id = ANY(p_category_ids))
+      AND (p_tags IS NULL OR CASE WHEN p_match_all_tags THEN tags @> p_tags ELSE tags && p_tags END)
+      AND (p_in_stock IS NULL OR (available_quantity > 0) = p_in_stock)
+      AND (p_status IS NULL OR status = p_status)
+      AND (p_created_by IS NULL OR created_by = p_created_by)
+  )
+  SELECT jsonb_build_object(
+    'categories', (
+      SELECT COALESCE(jsonb_object_agg(category_id, n), '{}')
+      FROM (SELECT category_id, COUNT(*) AS n FROM matching GROUP BY category_id) c
+    ),
+    'tags', (
+      SELECT COALESCE(jsonb_object_agg(tag, n), '{}')
+      FROM (SELECT tag, COUNT(*) AS n FROM matching, unnest(tags) AS tag GROUP BY tag) t
+    ),
+    'price_ranges', (
+      SELECT COALESCE(jsonb_object_agg(price_range, n), '{}')
+      FROM (
+        SELECT
+          CASE WHEN cardinality(p_bounds) > 0
+            THEN width_bucket(ROUND(price * (p_rates->>currency)::NUMERIC, p_exponent), p_bounds)
+            ELSE 0
+          END AS price_range,
+          COUNT(*) AS n
+        FROM matching
+        WHERE p_rates ? currency
+        GROUP BY 1
+      ) r
+    )
+  );
+$$ LANGUAGE sql STABLE;
+
+-- Atomically change the stock of a product, or of one of its variants when
+-- p_variant_id is set, and record the movement. A variant's change is also
+-- applied to the totals on its product. The row locks taken by the updates
+-- serialize concurrent adjustments, and the check constraints reject any that
+-- would leave the stock negative or below the reserved quantity.
+CREATE OR REPLACE FUNCTION adjust_stock(
+  p_product_id UUID,
+  p_variant_id UUID,
+  p_quantity_change INTEGER,
+  p_reserved_change INTEGER,
+  p_reason TEXT,
+  p_note TEXT,
+  p_created_by UUID
+)
+RETURNS stock_movements AS $$
+DECLARE
+  new_stock INTEGER;
+  new_reserved INTEGER;
+  movement stock_movements;
+BEGIN
+  IF p_variant_id IS NOT NULL THEN
+    UPDATE product_variants
+    SET stock_quantity = stock_quantity + p_quantity_change,
+        reserved_quantity = reserved_quantity + p_reserved_change
+    WHERE id = p_variant_id AND product_id = p_product_id
+    RETURNING stock_quantity, reserved_quantity INTO new_stock, new_reserved;
+
+    IF NOT FOUND THEN
+      RAISE EXCEPTION 'variant % of product % not found', p_variant_id, p_product_id USING ERRCODE = 'no_data_found';
+    END IF;
+
+    UPDATE products
+    SET stock_quantity = stock_quantity + p_quantity_change,
+        reserved_quantity = reserved_quantity + p_reserved_change
+    WHERE id = p_product_id;
+  ELSE
+    UPDATE products
+    SET stock_quantity = stock_quantity + p_quantity_change,
+        reserved_quantity = reserved_quantity + p_reserved_change
+    WHERE id = p_product_id
+    RETURNING stock_quantity, reserved_quantity INTO new_stock, new_reserved;
+
+    IF NOT FOUND THEN
+      RAISE EXCEPTION 'product % not found', p_product_id USING ERRCODE = 'no_data_found';
+    END IF;
+  END IF;
+
+  INSERT INTO stock_movements (product_id, variant_id, quantity_change, reserved_change, stock_quantity, reserved_quantity, reason, note, created_by)
+  VALUES (p_product_id, p_variant_id, p_quantity_change, p_reserved_change, new_stock, new_reserved, p_reason, NULLIF(p_note, ''), p_created_by)
+  RETURNING * INTO movement;
+
+  RETURN movement;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Record a snapshot as the next revision of a product. Locking the product
+-- row numbers concurrent revisions one after another.
+CREATE OR REPLACE FUNCTION add_product_revision(
+  p_product_id UUID,
+  p_snapshot JSONB,
+  p_created_by UUID
+)
+RETURNS product_revisions AS $$
+DECLARE
+  revision_row product_revisions;
+BEGIN
+  PERFORM 1 FROM products WHERE id = p_product_id FOR UPDATE;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'product % not found', p_product_id USING ERRCODE = 'no_data_found';
+  END IF;
+
+  INSERT INTO product_revisions (product_id, revision, snapshot, created_by)
+  SELECT p_product_id, COALESCE(MAX(revision), 0) + 1, p_snapshot, p_created_by
+  FROM product_revisions
+  WHERE product_id = p_product_id
+  RETURNING * INTO revision_row;
+
+  RETURN revision_row;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Snapshot the editable fields of a product, as recorded in its revisions
+CREATE OR REPLACE FUNCTION product_snapshot(p products)
+RETURNS JSONB AS $$
+  SELECT jsonb_build_object(
+    'name', p.name,
+    'description', p.description,
+    'price', trim_scale(p.price)::TEXT,
+    'currency', p.currency,
+    'category_id', p.category_id,
+    'tags', to_jsonb(p.tags),
+    'option_axes', to_jsonb(p.option_axes),
+    'image_url', p.image_url
+  );
+$$ LANGUAGE sql IMMUTABLE;
+
+-- Record the editable fields of a product as its next revision whenever
+-- they are written, in the same transaction as the write. The revision is by
+-- the user who last edited the product, or by its creator when it is new.
+CREATE OR REPLACE FUNCTION record_product_revision()
+RETURNS TRIGGER AS $$
+BEGIN
+  PERFORM add_product_revision(NEW.id, product_snapshot(NEW), COALESCE(NEW.edited_by, NEW.created_by));
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Apply a batch of product writes in one transaction, returning the written
+-- products in order. Creates insert the given product, updates replace its
+-- editable fields and deletes move it to the trash; updates and deletes only
+-- apply to the version of the product given as expected_updated_at. Creates
+-- and updates record a revision by p_user_id. If any write fails the whole
+-- batch is rolled back, and the error detail holds the index of that write.
+CREATE OR REPLACE FUNCTION batch_write_products(
+  p_writes JSONB,
+  p_user_id UUID
+)
+RETURNS SETOF products AS $$
+DECLARE
+  write_index INTEGER;
+  batch_write JSONB;
+  new_row products;
+  product_row products;
+  error_state TEXT;
+  error_message TEXT;
+BEGIN
+  FOR write_index, batch_write IN
+    SELECT ordinality - 1, value FROM jsonb_array_elements(p_writes) WITH ORDINALITY
+  LOOP
+    BEGIN
+      new_row := jsonb_populate_record(NULL::products, batch_write->'product');
+
+      CASE batch_write->>'op'
+        WHEN 'create' THEN
+          INSERT INTO products (
+            id, sku, name, description, price, currency, category_id, tags,
+            option_axes, image_url, status, publish_at, unpublish_at,
+            low_stock_threshold, created_by, created_at, updated_at
+          )
+          VALUES (
+            new_row.id, new_row.sku, new_row.name, new_row.description,
+            new_row.price, new_row.currency, new_row.category_id, COALESCE(new_row.tags, '{}'),
+            COALESCE(new_row.option_axes, '{}'), new_row.image_url, new_row.status,
+            new_row.publish_at, new_row.unpublish_at, new_row.low_stock_threshold,
+            new_row.created_by, new_row.created_at, new_row.updated_at
+          )
+          RETURNING * INTO product_row;
+        WHEN 'update' THEN
+          UPDATE products SET
+            name = new_row.name,
+            description = new_row.description,
+            price = new_row.price,
+            currency = new_row.currency,
+            category_id = new_row.category_id,
+            tags = COALESCE(new_row.tags, '{}'),
+            option_axes = CASE
+              WHEN batch_write->'product' ? 'option_axes' THEN new_row.option_axes
+              ELSE products.option_axes
+            END,
+            image_url = new_row.image_url,
+            edited_by = p_user_id
+          WHERE id = (batch_write->>'id')::UUID
+            AND deleted_at IS NULL
+            AND updated_at = (batch_write->>'expected_updated_at')::TIMESTAMPTZ
+          RETURNING * INTO product_row;
+        WHEN 'delete' THEN
+          UPDATE products SET deleted_at = NOW()
+          WHERE id = (batch_write->>'id')::UUID
+            AND deleted_at IS NULL
+            AND updated_at = (batch_write->>'expected_updated_at')::TIMESTAMPTZ
+          RETURNING * INTO product_row;
+      END CASE;
+
+      IF NOT FOUND THEN
+        PERFORM 1 FROM products WHERE id = (batch_write->>'id')::UUID AND deleted_at IS NULL;
+        IF FOUND THEN
+          RAISE EXCEPTION 'product % was modified', batch_write->>'id' USING ERRCODE = 'PT412';
+        END IF;
+        RAISE EXCEPTION 'product % not found', batch_write->>'id' USING ERRCODE = 'no_data_found';
+      END IF;
+    EXCEPTION WHEN OTHERS THEN
+      GET STACKED DIAGNOSTICS error_state = RETURNED_SQLSTATE, error_message = MESSAGE_TEXT;
+      RAISE EXCEPTION USING ERRCODE = error_state, MESSAGE = error_message, DETAIL = write_index::TEXT;
+    END;
+
+    RETURN NEXT product_row;
+  END LOOP;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Append an image to a product, numbering it after the product's last image.
+-- Locking the product row serializes concurrent uploads, so that the image
+-- limit holds and positions stay unique. The product gets a new version.
+CREATE OR REPLACE FUNCTION add_product_image(
+  p_image JSONB,
+  p_max_images INTEGER
+)
+RETURNS product_images AS $$
+DECLARE
+  new_image product_images;
+  image_row product_images;
+  image_count INTEGER;
+BEGIN
+  new_image := jsonb_populate_record(NULL::product_images, p_image);
+
+  UPDATE products SET updated_at = NOW()
+  WHERE id = new_image.product_id AND deleted_at IS NULL;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'product % not found', new_image.product_id USING ERRCODE = 'no_data_found';
+  END IF;
+
+  SELECT COUNT(*) INTO image_count FROM product_images WHERE product_id = new_image.product_id;
+  IF image_count >= p_max_images THEN
+    RAISE EXCEPTION 'product % already has % images', new_image.product_id, image_count
+      USING ERRCODE = 'program_limit_exceeded';
+  END IF;
+
+  INSERT INTO product_images (id, product_id, path, content_type, size, position, variants, created_at)
+  SELECT
+    new_image.id,
+    new_image.product_id,
+    new_image.path,
+    new_image.content_type,
+    new_image.size,
+    COALESCE(MAX(position), -1) + 1,
+    COALESCE(new_image.variants, '[]'),
+    COALESCE(new_image.created_at, NOW())
+  FROM product_images
+  WHERE product_id = new_image.product_id
+  RETURNING * INTO image_row;
+
+  RETURN image_row;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Set the display order of the images of a product in one statement. The
+-- given IDs must list every image of the product exactly once. The product
+-- gets a new version.
+CREATE OR REPLACE FUNCTION reorder_product_images(
+  p_product_id UUID,
+  p_image_ids UUID[]
+)
+RETURNS SETOF product_images AS $$
+BEGIN
+  UPDATE products SET updated_at = NOW()
+  WHERE id = p_product_id AND deleted_at IS NULL;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'product % not found', p_product_id USING ERRCODE = 'no_data_found';
+  END IF;
+
+  IF cardinality(p_image_ids) <> (SELECT COUNT(*) FROM product_images WHERE product_id = p_product_id)
+    OR cardinality(p_image_ids) <> (
+      SELECT COUNT(DISTINCT i.id)
+      FROM product_images i
+      WHERE i.product_id = p_product_id AND i.id = ANY (p_image_ids)
+    ) THEN
+    RAISE EXCEPTION 'image order must list every image of product % exactly once', p_product_id
+      USING ERRCODE = 'invalid_parameter_value';
+  END IF;
+
+  UPDATE product_images i SET position = ordered.ordinality - 1
+  FROM unnest(p_image_ids) WITH ORDINALITY AS ordered(id, ordinality)
+  WHERE i.id = ordered.id AND i.position <> ordered.ordinality - 1;
+
+  RETURN QUERY
+  SELECT * FROM product_images WHERE product_id = p_product_id ORDER BY position;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Keep the stock ledger complete by only deleting variants without stock,
+-- unless the whole product is being deleted
+CREATE OR REPLACE FUNCTION prevent_stocked_variant_delete()
+RETURNS TRIGGER AS $$
+BEGIN
+  IF (OLD.stock_quantity <> 0 OR OLD.reserved_quantity <> 0)
+     AND EXISTS (SELECT 1 FROM products WHERE id = OLD.product_id) THEN
+    RAISE EXCEPTION 'variant % still has stock', OLD.id USING ERRCODE = 'check_violation';
+  END IF;
+  RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Detach deleted images from the variants showing them
+CREATE OR REPLACE FUNCTION detach_variant_image()
+RETURNS TRIGGER AS $$
+BEGIN
+  UPDATE product_variants
+  SET image_ids = array_remove(image_ids, OLD.id)
+  WHERE product_id = OLD.product_id AND OLD.id = ANY(image_ids);
+  RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Keep the stock ledger append-only. Movements only go away together with
+-- their product, when the cascading delete no longer finds it.
+CREATE OR REPLACE FUNCTION prevent_stock_movement_changes()
+RETURNS TRIGGER AS $$
+BEGIN
+  IF TG_OP = 'DELETE' AND NOT EXISTS (SELECT 1 FROM products WHERE id = OLD.product_id) THEN
+    RETURN OLD;
+  END IF;
+  RAISE EXCEPTION 'stock movements are append-only';
+END;
+$$ LANGUAGE plpgsql;
+
 -- Create triggers to update the updated_at timestamp
 CREATE TRIGGER update_users_updated_at
   BEFORE UPDATE ON users
@@ -85,3 +634,38 @@ CREATE TRIGGER update_products_updated_at
   BEFORE UPDATE ON products
   FOR EACH ROW
   EXECUTE FUNCTION update_updated_at();
+
+CREATE TRIGGER products_record_revision
+  AFTER INSERT OR UPDATE OF name, description, price, currency, category_id, tags, option_axes, image_url ON products
+  FOR EACH ROW
+  EXECUTE FUNCTION record_product_revision();
+
+CREATE TRIGGER update_categories_updated_at
+  BEFORE UPDATE ON categories
+  FOR EACH ROW
+  EXECUTE FUNCTION update_updated_at();
+
+CREATE TRIGGER stock_movements_append_only
+  BEFORE UPDATE OR DELETE ON stock_movements
+  FOR EACH ROW
+  EXECUTE FUNCTION prevent_stock_movement_changes();
+
+CREATE TRIGGER update_product_variants_updated_at
+  BEFORE UPDATE ON product_variants
+  FOR EACH ROW
+  EXECUTE FUNCTION update_updated_at();
+
+CREATE TRIGGER update_import_jobs_updated_at
+  BEFORE UPDATE ON import_jobs
+  FOR EACH ROW
+  EXECUTE FUNCTION update_updated_at();
+
+CREATE TRIGGER product_variants_keep_stock
+  BEFORE DELETE ON product_variants
+  FOR EACH ROW
+  EXECUTE FUNCTION prevent_stocked_variant_delete();
+
+CREATE TRIGGER product_images_detach_variants
+  AFTER DELETE ON product_images
+  FOR EACH ROW
+  EXECUTE FUNCTION detach_variant_image();
@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/peterlimg/supabase-e/internal/models"
@@ -29,7 +32,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	user, err := h.authService.Register(req)
+	user, err := h.authService.Register(c.Request.Context(), req)
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to register user", err)
 		return
@@ -46,10 +49,21 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.authService.Login(req)
-	if err != nil {
+	resp, err := h.authService.Login(c.Request.Context(), req, c.ClientIP())
+	var blocked *services.LoginBlockedError
+	switch {
+	case errors.As(err, &blocked):
+		// Locked and throttled accounts get the same response so that a
+		// lockout does not confirm the email exists
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(blocked.RetryAfter.Seconds()))))
+		utils.ErrorResponse(c, http.StatusTooManyRequests, "Too many failed login attempts", nil)
+		return
+	case errors.Is(err, services.ErrInvalidCredentials):
 		utils.ErrorResponse(c, http.StatusUnauthorized, "Authentication failed", err)
 		return
+	case err != nil:
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Authentication failed", err)
+		return
 	}
 
 	utils.SuccessResponse(c, http.StatusOK, "Login successful", resp)
@@ -64,7 +78,7 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 		return
 	}
 
-	user, err := h.authService.GetUserByID(userID.(string))
+	user, err := h.authService.GetUserByID(c.Request.Context(), userID.(string))
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to get user profile", err)
 		return
@@ -88,7 +102,7 @@ func (h *AuthHandler) UpdateProfile(c *gin.Context) {
 		return
 	}
 
-	user, err := h.authService.UpdateUser(userID.(string), req)
+	user, err := h.authService.UpdateUser(c.Request.Context(), userID.(string), req)
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update profile", err)
 		return
@@ -96,3 +110,45 @@ func (h *AuthHandler) UpdateProfile(c *gin.Context) {
 
 	utils.SuccessResponse(c, http.StatusOK, "Profile updated successfully", user)
 }
+
+// PatchProfile handles partially updating the current user's profile with a
+// JSON merge patch (RFC 7396) or JSON patch (RFC 6902)
+func (h *AuthHandler) PatchProfile(c *gin.Context) {
+	// Get the user ID from the context (set by the auth middleware)
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.UnauthorizedResponse(c)
+		return
+	}
+
+	patch, ok := bindPatch(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.authService.PatchUser(c.Request.Context(), userID.(string), patch)
+	if writeRequestError(c, err) {
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update profile", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Profile updated successfully", user)
+}
+
+// UnlockAccount handles clearing the lockout of an account (admin only)
+func (h *AuthHandler) UnlockAccount(c *gin.Context) {
+	var req models.UnlockAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request body", err)
+		return
+	}
+
+	unlocked := h.authService.UnlockAccount(c.Request.Context(), req.Email)
+
+	utils.SuccessResponse(c, http.StatusOK, "Account unlocked successfully", map[string]bool{
+		"unlocked": unlocked,
+	})
+}
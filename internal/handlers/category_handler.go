@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/peterlimg/supabase-e/internal/models"
+	"github.com/peterlimg/supabase-e/internal/repository"
+	"github.com/peterlimg/supabase-e/internal/services"
+	"github.com/peterlimg/supabase-e/pkg/utils"
+)
+
+// CategoryHandler handles category requests
+type CategoryHandler struct {
+	categoryService *services.CategoryService
+}
+
+// NewCategoryHandler creates a new category handler
+func NewCategoryHandler(categoryService *services.CategoryService) *CategoryHandler {
+	return &CategoryHandler{
+		categoryService: categoryService,
+	}
+}
+
+// ListCategories handles listing all categories with their product counts
+func (h *CategoryHandler) ListCategories(c *gin.Context) {
+	categories, err := h.categoryService.ListCategories(c.Request.Context())
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to list categories", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Categories retrieved successfully", categories)
+}
+
+// GetCategory handles getting a category by ID or slug
+func (h *CategoryHandler) GetCategory(c *gin.Context) {
+	category, err := h.categoryService.GetCategory(c.Request.Context(), c.Param("id"))
+	if h.writeError(c, err, "Failed to get category") {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Category retrieved successfully", category)
+}
+
+// CreateCategory handles creating a new category (admin only)
+func (h *CategoryHandler) CreateCategory(c *gin.Context) {
+	var req models.CreateCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request body", err)
+		return
+	}
+
+	category, err := h.categoryService.CreateCategory(c.Request.Context(), req)
+	if h.writeError(c, err, "Failed to create category") {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Category created successfully", category)
+}
+
+// UpdateCategory handles updating a category (admin only)
+func (h *CategoryHandler) UpdateCategory(c *gin.Context) {
+	var req models.UpdateCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request body", err)
+		return
+	}
+
+	category, err := h.categoryService.UpdateCategory(c.Request.Context(), c.Param("id"), req)
+	if h.writeError(c, err, "Failed to update category") {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Category updated successfully", category)
+}
+
+// DeleteCategory handles deleting a category (admin only)
+func (h *CategoryHandler) DeleteCategory(c *gin.Context) {
+	err := h.categoryService.DeleteCategory(c.Request.Context(), c.Param("id"))
+	if h.writeError(c, err, "Failed to delete category") {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Category deleted successfully", nil)
+}
+
+// writeError responds to a category service error, mapping it to its status
+// code, and reports whether err was non-nil
+func (h *CategoryHandler) writeError(c *gin.Context, err error, message string) bool {
+	if err == nil {
+		return false
+	}
+	if writeRequestError(c, err) {
+		return true
+	}
+
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		utils.NotFoundResponse(c, "Category not found")
+	case errors.Is(err, services.ErrCategoryInUse):
+		utils.ErrorResponse(c, http.StatusConflict, "Category still has products or subcategories", err)
+	case errors.Is(err, repository.ErrConflict):
+		utils.ErrorResponse(c, http.StatusConflict, "A category with this slug already exists", err)
+	default:
+		utils.ErrorResponse(c, http.StatusInternalServerError, message, err)
+	}
+	return true
+}
@@ -4,32 +4,46 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/peterlimg/supabase-e/pkg/database"
+	"github.com/peterlimg/supabase-e/pkg/health"
 	"github.com/peterlimg/supabase-e/pkg/utils"
 )
 
 // HealthHandler handles health check requests
 type HealthHandler struct {
-	db *database.Client
+	registry *health.Registry
 }
 
 // NewHealthHandler creates a new health handler
-func NewHealthHandler(db *database.Client) *HealthHandler {
+func NewHealthHandler(registry *health.Registry) *HealthHandler {
 	return &HealthHandler{
-		db: db,
+		registry: registry,
 	}
 }
 
-// Check handles checking the health of the API
+// Check handles checking the health of the API and its dependencies
 func (h *HealthHandler) Check(c *gin.Context) {
-	// Check database connection
-	err := h.db.Health()
-	if err != nil {
-		utils.ErrorResponse(c, http.StatusServiceUnavailable, "Database connection failed", err)
+	h.Ready(c)
+}
+
+// Live handles the liveness probe; it only reports that the process is able
+// to serve requests and never checks dependencies
+func (h *HealthHandler) Live(c *gin.Context) {
+	utils.SuccessResponse(c, http.StatusOK, "API is alive", health.Report{
+		Status: health.StatusUp,
+	})
+}
+
+// Ready handles the readiness probe, running every registered dependency check
+func (h *HealthHandler) Ready(c *gin.Context) {
+	report := h.registry.Run(c.Request.Context())
+	if !report.Healthy() {
+		c.JSON(http.StatusServiceUnavailable, utils.Response{
+			Success: false,
+			Message: "API is not ready",
+			Data:    report,
+		})
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "API is healthy", map[string]string{
-		"status": "up",
-	})
+	utils.SuccessResponse(c, http.StatusOK, "API is ready", report)
 }
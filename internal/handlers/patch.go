@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/peterlimg/supabase-e/pkg/utils"
+)
+
+// bindPatch reads a patch document from the request body. On failure it
+// responds with 400 or 415 and returns false.
+func bindPatch(c *gin.Context) (utils.Patch, bool) {
+	body, err := c.GetRawData()
+	if err != nil {
+		utils.BadRequestResponse(c, "Failed to read request body", err)
+		return utils.Patch{}, false
+	}
+
+	patch, err := utils.NewPatch(c.GetHeader("Content-Type"), body)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusUnsupportedMediaType, "Unsupported patch format", err)
+		return utils.Patch{}, false
+	}
+	return patch, true
+}
+
+// writeRequestError responds to errors caused by an invalid request or patch
+// document and reports whether err was one
+func writeRequestError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, utils.ErrMalformedPatch):
+		utils.BadRequestResponse(c, "Invalid patch document", err)
+	case errors.Is(err, utils.ErrValidation):
+		utils.ErrorResponse(c, http.StatusUnprocessableEntity, "Request failed validation", err)
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/peterlimg/supabase-e/config"
+	"github.com/peterlimg/supabase-e/internal/models"
+	"github.com/peterlimg/supabase-e/pkg/money"
+	"github.com/peterlimg/supabase-e/pkg/utils"
+	"github.com/shopspring/decimal"
+)
+
+// minorUnitProduct is a product whose prices are written in minor units
+type minorUnitProduct struct {
+	models.Product
+	Price         int64              `json:"price"`
+	Variants      []minorUnitVariant `json:"variants,omitempty"`
+	CreatedByUser *models.User       `json:"created_by_user,omitempty"`
+}
+
+// minorUnitVariant is a variant whose price override is written in minor
+// units
+type minorUnitVariant struct {
+	models.ProductVariant
+	Price *int64 `json:"price"`
+}
+
+// presentProduct prepares a product for a response: its prices are converted
+// into the currency requested with ?currency= and written in the configured
+// price format. On failure it responds with 400 and returns false.
+func (h *ProductHandler) presentProduct(c *gin.Context, product models.Product, createdBy *models.User) (interface{}, bool) {
+	if target := c.Query("currency"); target != "" {
+		price, err := h.config.ExchangeRates.Convert(product.Price, product.Currency, target)
+		if err != nil {
+			utils.BadRequestResponse(c, "Unsupported currency", err)
+			return nil, false
+		}
+		product.Price, product.Currency = price, strings.ToUpper(target)
+	}
+
+	variants := make([]models.ProductVariant, 0, len(product.Variants))
+	for _, variant := range product.Variants {
+		view, ok := convertVariant(c, h.config, variant)
+		if !ok {
+			return nil, false
+		}
+		variants = append(variants, view)
+	}
+	product.Variants = variants
+
+	if h.config.PriceFormat == money.FormatMinor {
+		minor, err := money.RoundToMinor(product.Price, product.Currency)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to format price", err)
+			return nil, false
+		}
+		view := minorUnitProduct{Product: product, Price: minor, CreatedByUser: createdBy}
+		for _, variant := range variants {
+			minorVariant, ok := minorUnitVariantOf(c, variant)
+			if !ok {
+				return nil, false
+			}
+			view.Variants = append(view.Variants, minorVariant)
+		}
+		return view, true
+	}
+
+	if createdBy != nil {
+		return models.ProductResponse{Product: product, CreatedByUser: *createdBy}, true
+	}
+	return product, true
+}
+
+// searchResultView is a search result whose product has been prepared for a
+// response
+type searchResultView struct {
+	Product       interface{} `json:"product"`
+	Rank          float64     `json:"rank"`
+	NameHighlight string      `json:"name_highlight"`
+	Snippet       string      `json:"snippet"`
+}
+
+// presentVariant prepares a variant for a response like presentProduct
+func presentVariant(c *gin.Context, cfg *config.Config, variant models.ProductVariant) (interface{}, bool) {
+	variant, ok := convertVariant(c, cfg, variant)
+	if !ok {
+		return nil, false
+	}
+	if cfg.PriceFormat == money.FormatMinor {
+		return minorUnitVariantOf(c, variant)
+	}
+	return variant, true
+}
+
+// convertVariant converts the price override of a variant into the currency
+// requested with ?currency=. On failure it responds with 400 and returns
+// false.
+func convertVariant(c *gin.Context, cfg *config.Config, variant models.ProductVariant) (models.ProductVariant, bool) {
+	target := c.Query("currency")
+	if target == "" {
+		return variant, true
+	}
+	if variant.Price != nil {
+		price, err := cfg.ExchangeRates.Convert(*variant.Price, variant.Currency, target)
+		if err != nil {
+			utils.BadRequestResponse(c, "Unsupported currency", err)
+			return variant, false
+		}
+		variant.Price = &price
+	}
+	variant.Currency = strings.ToUpper(target)
+	return variant, true
+}
+
+// minorUnitVariantOf writes the price override of a variant in minor units.
+// On failure it responds with 500 and returns false.
+func minorUnitVariantOf(c *gin.Context, variant models.ProductVariant) (minorUnitVariant, bool) {
+	minor, err := optionalMinor(variant.Price, variant.Currency)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to format price", err)
+		return minorUnitVariant{}, false
+	}
+	return minorUnitVariant{ProductVariant: variant, Price: minor}, true
+}
+
+// minorUnitSnapshot is a product revision snapshot whose price is written in
+// minor units
+type minorUnitSnapshot struct {
+	models.UpdateProductRequest
+	Price *int64 `json:"price"`
+}
+
+// minorUnitRevision is a product revision whose snapshot and price changes
+// are written in minor units
+type minorUnitRevision struct {
+	models.ProductRevision
+	Snapshot minorUnitSnapshot    `json:"snapshot"`
+	Changes  []models.FieldChange `json:"changes"`
+}
+
+// presentRevisions prepares product revisions for a response, writing their
+// prices in the configured price format. Past prices are never converted
+// into another currency. On failure it responds with 500 and returns false.
+func (h *ProductHandler) presentRevisions(c *gin.Context, revisions []models.ProductRevision) ([]interface{}, bool) {
+	views := make([]interface{}, 0, len(revisions))
+	for _, revision := range revisions {
+		if h.config.PriceFormat != money.FormatMinor {
+			views = append(views, revision)
+			continue
+		}
+
+		view := minorUnitRevision{ProductRevision: revision}
+		var err error
+		if view.Snapshot, err = minorUnitSnapshotOf(revision.Snapshot); err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to format price", err)
+			return nil, false
+		}
+
+		// Diff the converted snapshots so that price changes are in minor
+		// units too
+		var previous *minorUnitSnapshot
+		if revision.Previous != nil {
+			snapshot, err := minorUnitSnapshotOf(*revision.Previous)
+			if err != nil {
+				utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to format price", err)
+				return nil, false
+			}
+			previous = &snapshot
+		}
+		if view.Changes, err = models.DiffSnapshots(previous, view.Snapshot); err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to compare revisions", err)
+			return nil, false
+		}
+
+		views = append(views, view)
+	}
+	return views, true
+}
+
+// minorUnitSnapshotOf writes the price of a revision snapshot in minor units
+func minorUnitSnapshotOf(snapshot models.UpdateProductRequest) (minorUnitSnapshot, error) {
+	if snapshot.Price == nil || snapshot.Currency == nil {
+		return minorUnitSnapshot{UpdateProductRequest: snapshot}, nil
+	}
+	minor, err := money.RoundToMinor(*snapshot.Price, *snapshot.Currency)
+	if err != nil {
+		return minorUnitSnapshot{}, err
+	}
+	return minorUnitSnapshot{UpdateProductRequest: snapshot, Price: &minor}, nil
+}
+
+// presentProducts prepares a list of products for a response like
+// presentProduct
+func (h *ProductHandler) presentProducts(c *gin.Context, products []models.Product) ([]interface{}, bool) {
+	views := make([]interface{}, 0, len(products))
+	for _, product := range products {
+		view, ok := h.presentProduct(c, product, nil)
+		if !ok {
+			return nil, false
+		}
+		views = append(views, view)
+	}
+	return views, true
+}
+
+// minorUnitPriceRange is a price range facet whose bounds are written in
+// minor units
+type minorUnitPriceRange struct {
+	models.PriceRangeFacet
+	Min *int64 `json:"min"`
+	Max *int64 `json:"max"`
+}
+
+// presentFacets writes the bounds of price range facets in the configured
+// price format. On failure it responds with 500 and returns false.
+func (h *ProductHandler) presentFacets(c *gin.Context, facets models.ProductFacets) (interface{}, bool) {
+	if h.config.PriceFormat != money.FormatMinor {
+		return facets, true
+	}
+
+	ranges := make([]minorUnitPriceRange, 0, len(facets.PriceRanges))
+	for _, r := range facets.PriceRanges {
+		min, err := optionalMinor(r.Min, r.Currency)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to format price", err)
+			return nil, false
+		}
+		max, err := optionalMinor(r.Max, r.Currency)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to format price", err)
+			return nil, false
+		}
+		ranges = append(ranges, minorUnitPriceRange{PriceRangeFacet: r, Min: min, Max: max})
+	}
+
+	return gin.H{
+		"categories":   facets.Categories,
+		"tags":         facets.Tags,
+		"price_ranges": ranges,
+	}, true
+}
+
+// optionalMinor converts an optional price into minor units
+func optionalMinor(bound *decimal.Decimal, currency string) (*int64, error) {
+	if bound == nil {
+		return nil, nil
+	}
+	minor, err := money.RoundToMinor(*bound, currency)
+	if err != nil {
+		return nil, err
+	}
+	return &minor, nil
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/peterlimg/supabase-e/internal/models"
+	"github.com/peterlimg/supabase-e/internal/repository"
+	"github.com/peterlimg/supabase-e/internal/services"
+	"github.com/peterlimg/supabase-e/pkg/logger"
+	"github.com/peterlimg/supabase-e/pkg/utils"
+	"github.com/shopspring/decimal"
+)
+
+// batchResult is the result of one operation of a batch, with the status
+// code the matching single request would have answered
+type batchResult struct {
+	Index   int                   `json:"index"`
+	Op      models.ProductBatchOp `json:"op"`
+	ID      string                `json:"id,omitempty"`
+	Status  int                   `json:"status"`
+	Error   string                `json:"error,omitempty"`
+	Product interface{}           `json:"product,omitempty"`
+}
+
+// batchSuccessStatus maps each operation to its status code on success
+var batchSuccessStatus = map[models.ProductBatchOp]int{
+	models.ProductBatchCreate: http.StatusCreated,
+	models.ProductBatchUpdate: http.StatusOK,
+	models.ProductBatchDelete: http.StatusNoContent,
+}
+
+// BatchProducts handles applying a batch of product creates, updates and
+// deletes. It answers 200 when every operation succeeded and 207 otherwise,
+// with the result of each operation in order.
+func (h *ProductHandler) BatchProducts(c *gin.Context) {
+	userID, admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req models.ProductBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request body", err)
+		return
+	}
+
+	// The products are presented after they have been written, so the target
+	// currency is checked first
+	if target := c.Query("currency"); target != "" {
+		if _, err := h.config.ExchangeRates.Convert(decimal.Zero, h.config.ExchangeRates.Base(), target); err != nil {
+			utils.BadRequestResponse(c, "Unsupported currency", err)
+			return
+		}
+	}
+
+	outcomes, err := h.productService.BatchProducts(c.Request.Context(), req, userID, admin)
+	if writeRequestError(c, err) {
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to apply product batch", err)
+		return
+	}
+
+	results := make([]batchResult, len(outcomes))
+	succeeded := 0
+	for i, outcome := range outcomes {
+		op := req.Operations[i]
+		result := batchResult{Index: i, Op: op.Op, ID: op.ID}
+		if outcome.Err != nil {
+			result.Status, result.Error = batchErrorStatus(outcome.Err), outcome.Err.Error()
+			if result.Status == http.StatusInternalServerError {
+				// Unexpected errors may reveal internals, so only the log
+				// gets their details
+				log := logger.GetLogger("batch")
+				log.Error().Err(outcome.Err).Int("index", i).Str("op", string(op.Op)).Msg("Product batch operation failed")
+				result.Error = "Internal server error"
+			}
+			results[i] = result
+			continue
+		}
+
+		succeeded++
+		result.Status = batchSuccessStatus[op.Op]
+		if outcome.Product != nil {
+			result.ID = outcome.Product.ID
+			if op.Op != models.ProductBatchDelete {
+				view, ok := h.presentProduct(c, *outcome.Product, nil)
+				if !ok {
+					return
+				}
+				result.Product = view
+			}
+		}
+		results[i] = result
+	}
+
+	status, message := http.StatusOK, "Product batch applied successfully"
+	if succeeded < len(results) {
+		status, message = http.StatusMultiStatus, "Product batch applied with failures"
+	}
+	utils.SuccessResponseWithMeta(c, status, message, results, gin.H{
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+	})
+}
+
+// batchErrorStatus maps the error of a batch operation to the status code
+// the matching single request would have answered
+func batchErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, utils.ErrMalformedPatch):
+		return http.StatusBadRequest
+	case errors.Is(err, utils.ErrValidation):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, repository.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrNotProductOwner):
+		return http.StatusForbidden
+	case errors.Is(err, repository.ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, services.ErrIfMatchRequired):
+		return http.StatusPreconditionRequired
+	case errors.Is(err, services.ErrDuplicateSKU), errors.Is(err, services.ErrVariantsExist), errors.Is(err, repository.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrBatchAborted):
+		return http.StatusFailedDependency
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/peterlimg/supabase-e/internal/models"
+	"github.com/peterlimg/supabase-e/pkg/logger"
+	"github.com/peterlimg/supabase-e/pkg/money"
+	"github.com/peterlimg/supabase-e/pkg/utils"
+	"github.com/peterlimg/supabase-e/pkg/xlsx"
+	"github.com/shopspring/decimal"
+)
+
+// exportColumn is a column of a product export. Values are strings, ints,
+// decimals, string lists, times or nil.
+type exportColumn struct {
+	name  string
+	value func(p exportProduct) interface{}
+}
+
+// exportProduct is a product whose price has been converted for an export;
+// price holds the price in the configured price format
+type exportProduct struct {
+	models.Product
+	price interface{}
+}
+
+// exportColumns lists the columns of a product export in their default
+// order. The columns shared with imports use the same names and formats, so
+// that an export limited to them can be imported again.
+var exportColumns = []exportColumn{
+	{"id", func(p exportProduct) interface{} { return p.ID }},
+	{"sku", func(p exportProduct) interface{} { return p.SKU }},
+	{"name", func(p exportProduct) interface{} { return p.Name }},
+	{"description", func(p exportProduct) interface{} { return p.Description }},
+	{"price", func(p exportProduct) interface{} { return p.price }},
+	{"currency", func(p exportProduct) interface{} { return p.Currency }},
+	{"category_id", func(p exportProduct) interface{} { return p.CategoryID }},
+	{"tags", func(p exportProduct) interface{} { return p.Tags }},
+	{"option_axes", func(p exportProduct) interface{} { return p.OptionAxes }},
+	{"image_url", func(p exportProduct) interface{} { return p.ImageURL }},
+	{"status", func(p exportProduct) interface{} { return string(p.Status) }},
+	{"publish_at", func(p exportProduct) interface{} { return p.PublishAt }},
+	{"unpublish_at", func(p exportProduct) interface{} { return p.UnpublishAt }},
+	{"stock_quantity", func(p exportProduct) interface{} { return p.StockQuantity }},
+	{"reserved_quantity", func(p exportProduct) interface{} { return p.ReservedQuantity }},
+	{"available_quantity", func(p exportProduct) interface{} { return p.AvailableQuantity }},
+	{"low_stock_threshold", func(p exportProduct) interface{} { return p.LowStockThreshold }},
+	{"created_by", func(p exportProduct) interface{} { return p.CreatedBy }},
+	{"created_at", func(p exportProduct) interface{} { return p.CreatedAt }},
+	{"updated_at", func(p exportProduct) interface{} { return p.UpdatedAt }},
+}
+
+// exportFormats maps the supported export formats to their content type and
+// file extension
+var exportFormats = map[string]struct {
+	contentType string
+	extension   string
+}{
+	"csv":    {"text/csv; charset=utf-8", "csv"},
+	"ndjson": {"application/x-ndjson", "ndjson"},
+	"xlsx":   {xlsx.ContentType, "xlsx"},
+}
+
+// ExportProducts handles downloading every product that matches the filters
+// of ListProducts as CSV, NDJSON or XLSX. The products are read and written a
+// page at a time, so the download starts right away and memory use does not
+// grow with the catalog.
+func (h *ProductHandler) ExportProducts(c *gin.Context) {
+	userID, admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	formatName := strings.ToLower(c.DefaultQuery("format", "csv"))
+	format, ok := exportFormats[formatName]
+	if !ok {
+		utils.BadRequestResponse(c, "format must be csv, ndjson or xlsx", nil)
+		return
+	}
+
+	columns, err := selectExportColumns(c.QueryArray("columns"))
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid export columns", err)
+		return
+	}
+
+	query, ok := listQuery(c, userID, admin)
+	if !ok {
+		return
+	}
+	if query.Currency != "" {
+		if _, err := h.config.ExchangeRates.Convert(decimal.Zero, h.config.ExchangeRates.Base(), query.Currency); err != nil {
+			utils.BadRequestResponse(c, "Unsupported currency", err)
+			return
+		}
+	}
+
+	// Exports take longer than ordinary requests, so they get their own
+	// deadline instead of the request timeout. A client that goes away fails
+	// the next write, which stops the export.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), h.config.ExportTimeout)
+	defer cancel()
+
+	// The response starts with the first page, so that a failure before it
+	// can still be reported as an error
+	var writer exportWriter
+	started := false
+	start := func() error {
+		started = true
+		c.Header("Content-Type", format.contentType)
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="products-%s.%s"`, time.Now().UTC().Format("20060102-150405"), format.extension))
+		c.Status(http.StatusOK)
+
+		var err error
+		writer, err = newExportWriter(formatName, c.Writer, columns)
+		return err
+	}
+
+	err = h.productService.ExportProducts(ctx, query, h.config.ExportPageSize, func(products []models.Product) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		for _, product := range products {
+			row, err := h.exportProduct(product, query.Currency)
+			if err != nil {
+				return err
+			}
+			if err := writer.write(row); err != nil {
+				return err
+			}
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if !started {
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to export products", err)
+			return
+		}
+		// An empty export still gets its header row
+		err = start()
+	}
+	if err == nil {
+		err = writer.close()
+	}
+	if err != nil {
+		// The status has been sent, so a failed export can only end early
+		log := logger.GetLogger("export")
+		log.Error().Err(err).Str("format", formatName).Msg("Product export failed")
+		c.Abort()
+	}
+}
+
+// exportProduct converts the price of a product into the requested currency
+// and the configured price format
+func (h *ProductHandler) exportProduct(product models.Product, currency string) (exportProduct, error) {
+	if currency != "" {
+		price, err := h.config.ExchangeRates.Convert(product.Price, product.Currency, currency)
+		if err != nil {
+			return exportProduct{}, err
+		}
+		product.Price, product.Currency = price, strings.ToUpper(currency)
+	}
+
+	if h.config.PriceFormat == money.FormatMinor {
+		minor, err := money.RoundToMinor(product.Price, product.Currency)
+		if err != nil {
+			return exportProduct{}, err
+		}
+		return exportProduct{Product: product, price: minor}, nil
+	}
+	return exportProduct{Product: product, price: product.Price}, nil
+}
+
+// selectExportColumns picks the columns named in the columns parameters,
+// given comma separated, repeated or both, or all columns if none are named
+func selectExportColumns(values []string) ([]exportColumn, error) {
+	byName := make(map[string]exportColumn, len(exportColumns))
+	for _, column := range exportColumns {
+		byName[column.name] = column
+	}
+
+	var columns []exportColumn
+	seen := map[string]bool{}
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" || seen[name] {
+				continue
+			}
+			column, ok := byName[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown column %q", name)
+			}
+			seen[name] = true
+			columns = append(columns, column)
+		}
+	}
+	if len(columns) == 0 {
+		return exportColumns, nil
+	}
+	return columns, nil
+}
+
+// exportWriter writes the rows of a product export in one format
+type exportWriter interface {
+	write(p exportProduct) error
+	close() error
+}
+
+// newExportWriter starts an export in the named format, writing the header
+// row for tabular formats
+func newExportWriter(format string, w io.Writer, columns []exportColumn) (exportWriter, error) {
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.name
+	}
+
+	switch format {
+	case "ndjson":
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		return &ndjsonExportWriter{encoder: encoder, columns: columns}, nil
+	case "xlsx":
+		workbook, err := xlsx.NewWriter(w, "Products")
+		if err != nil {
+			return nil, err
+		}
+		header := make([]interface{}, len(names))
+		for i, name := range names {
+			header[i] = name
+		}
+		return &xlsxExportWriter{workbook: workbook, columns: columns}, workbook.WriteRow(header)
+	default:
+		writer := csv.NewWriter(w)
+		return &csvExportWriter{writer: writer, columns: columns}, writer.Write(names)
+	}
+}
+
+// csvExportWriter writes an export as CSV, in the format imports read. Text
+// cells that look like formulas are escaped with a leading quote, which
+// imports remove again.
+type csvExportWriter struct {
+	writer  *csv.Writer
+	columns []exportColumn
+}
+
+// write implements exportWriter
+func (w *csvExportWriter) write(p exportProduct) error {
+	record := make([]string, len(w.columns))
+	for i, column := range w.columns {
+		switch v := cellValue(column.value(p)).(type) {
+		case nil:
+		case string:
+			// Text is never left for spreadsheet programs to run as a formula
+			record[i] = utils.EscapeCSVCell(v)
+		default:
+			record[i] = fmt.Sprint(v)
+		}
+	}
+	return w.writer.Write(record)
+}
+
+// close implements exportWriter
+func (w *csvExportWriter) close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// xlsxExportWriter writes an export as a single XLSX worksheet
+type xlsxExportWriter struct {
+	workbook *xlsx.Writer
+	columns  []exportColumn
+}
+
+// write implements exportWriter
+func (w *xlsxExportWriter) write(p exportProduct) error {
+	row := make([]interface{}, len(w.columns))
+	for i, column := range w.columns {
+		row[i] = cellValue(column.value(p))
+	}
+	return w.workbook.WriteRow(row)
+}
+
+// close implements exportWriter
+func (w *xlsxExportWriter) close() error {
+	return w.workbook.Close()
+}
+
+// ndjsonExportWriter writes an export as one JSON object per line, with the
+// values formatted like API responses
+type ndjsonExportWriter struct {
+	encoder *json.Encoder
+	columns []exportColumn
+}
+
+// write implements exportWriter
+func (w *ndjsonExportWriter) write(p exportProduct) error {
+	object := make(map[string]interface{}, len(w.columns))
+	for _, column := range w.columns {
+		value := column.value(p)
+		if list, ok := value.([]string); ok && list == nil {
+			value = []string{}
+		}
+		object[column.name] = value
+	}
+	return w.encoder.Encode(object)
+}
+
+// close implements exportWriter
+func (w *ndjsonExportWriter) close() error {
+	return nil
+}
+
+// cellValue turns a column value into a string, int, int64, decimal or nil
+// for tabular formats. Lists are joined with "|" and times are written in RFC
+// 3339 format, as imports expect them.
+func cellValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []string:
+		return strings.Join(v, "|")
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case *time.Time:
+		if v == nil {
+			return nil
+		}
+		return v.UTC().Format(time.RFC3339Nano)
+	case *int:
+		if v == nil {
+			return nil
+		}
+		return *v
+	default:
+		return v
+	}
+}
@@ -1,24 +1,31 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/peterlimg/supabase-e/config"
 	"github.com/peterlimg/supabase-e/internal/models"
+	"github.com/peterlimg/supabase-e/internal/repository"
 	"github.com/peterlimg/supabase-e/internal/services"
+	"github.com/peterlimg/supabase-e/pkg/money"
 	"github.com/peterlimg/supabase-e/pkg/utils"
 )
 
 // ProductHandler handles product requests
 type ProductHandler struct {
 	productService *services.ProductService
+	config         *config.Config
 }
 
 // NewProductHandler creates a new product handler
-func NewProductHandler(productService *services.ProductService) *ProductHandler {
+func NewProductHandler(productService *services.ProductService, config *config.Config) *ProductHandler {
 	return &ProductHandler{
 		productService: productService,
+		config:         config,
 	}
 }
 
@@ -37,95 +44,397 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 		return
 	}
 
-	product, err := h.productService.CreateProduct(req, userID.(string))
+	product, err := h.productService.CreateProduct(c.Request.Context(), req, userID.(string))
+	if writeRequestError(c, err) {
+		return
+	}
+	if errors.Is(err, services.ErrDuplicateSKU) {
+		utils.ErrorResponse(c, http.StatusConflict, "Another product has this SKU", err)
+		return
+	}
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to create product", err)
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusCreated, "Product created successfully", product)
+	view, ok := h.presentProduct(c, *product, nil)
+	if !ok {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Product created successfully", view)
 }
 
 // GetProduct handles getting a product by ID
 func (h *ProductHandler) GetProduct(c *gin.Context) {
+	userID, admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
 	id := c.Param("id")
 	if id == "" {
 		utils.BadRequestResponse(c, "Product ID is required", nil)
 		return
 	}
 
-	product, err := h.productService.GetProductByID(id)
-	if err != nil {
+	product, err := h.productService.GetProductByID(c.Request.Context(), id, userID, admin)
+	if errors.Is(err, repository.ErrNotFound) {
 		utils.NotFoundResponse(c, "Product not found")
 		return
 	}
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to get product", err)
+		return
+	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Product retrieved successfully", product)
+	// Let clients revalidate cached copies
+	etag := product.ETag()
+	c.Header("ETag", etag)
+	if ifNoneMatch := c.GetHeader("If-None-Match"); ifNoneMatch != "" && utils.MatchETag(ifNoneMatch, etag, true) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	view, ok := h.presentProduct(c, *product, nil)
+	if !ok {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Product retrieved successfully", view)
 }
 
 // GetProductWithUser handles getting a product with its creator's information
 func (h *ProductHandler) GetProductWithUser(c *gin.Context) {
+	userID, admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
 	id := c.Param("id")
 	if id == "" {
 		utils.BadRequestResponse(c, "Product ID is required", nil)
 		return
 	}
 
-	product, err := h.productService.GetProductWithUser(id)
-	if err != nil {
+	product, err := h.productService.GetProductWithUser(c.Request.Context(), id, userID, admin)
+	if errors.Is(err, repository.ErrNotFound) {
 		utils.NotFoundResponse(c, "Product not found")
 		return
 	}
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to get product", err)
+		return
+	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Product retrieved successfully", product)
+	view, ok := h.presentProduct(c, product.Product, &product.CreatedByUser)
+	if !ok {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Product retrieved successfully", view)
 }
 
 // UpdateProduct handles updating a product
 func (h *ProductHandler) UpdateProduct(c *gin.Context) {
+	userID, admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
 	id := c.Param("id")
 	if id == "" {
 		utils.BadRequestResponse(c, "Product ID is required", nil)
 		return
 	}
 
+	ifMatch, ok := h.ifMatch(c)
+	if !ok {
+		return
+	}
+
 	var req models.UpdateProductRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		utils.BadRequestResponse(c, "Invalid request body", err)
 		return
 	}
 
-	product, err := h.productService.UpdateProduct(id, req)
-	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update product", err)
+	product, err := h.productService.UpdateProduct(c.Request.Context(), id, req, ifMatch, userID, admin)
+	if h.writeError(c, err, "Failed to update product") {
+		return
+	}
+
+	c.Header("ETag", product.ETag())
+
+	view, ok := h.presentProduct(c, *product, nil)
+	if !ok {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Product updated successfully", view)
+}
+
+// PatchProduct handles partially updating a product with a JSON merge patch
+// (RFC 7396) or JSON patch (RFC 6902)
+func (h *ProductHandler) PatchProduct(c *gin.Context) {
+	userID, admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	id := c.Param("id")
+	if id == "" {
+		utils.BadRequestResponse(c, "Product ID is required", nil)
+		return
+	}
+
+	ifMatch, ok := h.ifMatch(c)
+	if !ok {
+		return
+	}
+
+	patch, ok := bindPatch(c)
+	if !ok {
+		return
+	}
+
+	product, err := h.productService.PatchProduct(c.Request.Context(), id, patch, ifMatch, userID, admin)
+	if h.writeError(c, err, "Failed to update product") {
+		return
+	}
+
+	c.Header("ETag", product.ETag())
+
+	view, ok := h.presentProduct(c, *product, nil)
+	if !ok {
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Product updated successfully", product)
+	utils.SuccessResponse(c, http.StatusOK, "Product updated successfully", view)
 }
 
-// DeleteProduct handles deleting a product
+// DeleteProduct handles moving a product to the trash
 func (h *ProductHandler) DeleteProduct(c *gin.Context) {
+	userID, admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	id := c.Param("id")
+	if id == "" {
+		utils.BadRequestResponse(c, "Product ID is required", nil)
+		return
+	}
+
+	ifMatch, ok := h.ifMatch(c)
+	if !ok {
+		return
+	}
+
+	err := h.productService.DeleteProduct(c.Request.Context(), id, ifMatch, userID, admin)
+	if h.writeError(c, err, "Failed to delete product") {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Product moved to trash", nil)
+}
+
+// UpdateStatus handles moving a product through its draft, published and
+// archived lifecycle and scheduling it
+func (h *ProductHandler) UpdateStatus(c *gin.Context) {
+	userID, admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	id := c.Param("id")
+	if id == "" {
+		utils.BadRequestResponse(c, "Product ID is required", nil)
+		return
+	}
+
+	ifMatch, ok := h.ifMatch(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateProductStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request body", err)
+		return
+	}
+
+	product, err := h.productService.UpdateStatus(c.Request.Context(), id, req, ifMatch, userID, admin)
+	if h.writeError(c, err, "Failed to update product status") {
+		return
+	}
+
+	c.Header("ETag", product.ETag())
+
+	view, ok := h.presentProduct(c, *product, nil)
+	if !ok {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Product status updated successfully", view)
+}
+
+// ListTrash handles listing the current user's trashed products
+func (h *ProductHandler) ListTrash(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.UnauthorizedResponse(c)
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	if err != nil || pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	products, err := h.productService.ListTrash(c.Request.Context(), userID.(string), page, pageSize)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to list trashed products", err)
+		return
+	}
+
+	views, ok := h.presentProducts(c, products)
+	if !ok {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Trashed products retrieved successfully", views)
+}
+
+// RestoreProduct handles taking a product out of the trash
+func (h *ProductHandler) RestoreProduct(c *gin.Context) {
+	userID, admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
 	id := c.Param("id")
 	if id == "" {
 		utils.BadRequestResponse(c, "Product ID is required", nil)
 		return
 	}
 
-	err := h.productService.DeleteProduct(id)
+	product, err := h.productService.RestoreProduct(c.Request.Context(), id, userID, admin)
+	if errors.Is(err, services.ErrNotProductOwner) {
+		utils.ForbiddenResponse(c)
+		return
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		utils.NotFoundResponse(c, "Product not found in trash")
+		return
+	}
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to delete product", err)
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to restore product", err)
+		return
+	}
+
+	c.Header("ETag", product.ETag())
+
+	view, ok := h.presentProduct(c, *product, nil)
+	if !ok {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Product restored successfully", view)
+}
+
+// ListRevisions handles listing the revision history of a product with the
+// changes made by each revision
+func (h *ProductHandler) ListRevisions(c *gin.Context) {
+	userID, admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	id := c.Param("id")
+	if id == "" {
+		utils.BadRequestResponse(c, "Product ID is required", nil)
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if err != nil || pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	revisions, err := h.productService.ListRevisions(c.Request.Context(), id, page, pageSize, userID, admin)
+	if h.writeError(c, err, "Failed to list product revisions") {
+		return
+	}
+
+	views, ok := h.presentRevisions(c, revisions)
+	if !ok {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Product revisions retrieved successfully", views)
+}
+
+// RestoreRevision handles rolling a product back to one of its revisions
+func (h *ProductHandler) RestoreRevision(c *gin.Context) {
+	userID, admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	id := c.Param("id")
+	if id == "" {
+		utils.BadRequestResponse(c, "Product ID is required", nil)
+		return
+	}
+
+	revision, err := strconv.Atoi(c.Param("rev"))
+	if err != nil || revision < 1 {
+		utils.BadRequestResponse(c, "Revision must be a positive number", err)
+		return
+	}
+
+	ifMatch, ok := h.ifMatch(c)
+	if !ok {
+		return
+	}
+
+	product, err := h.productService.RestoreRevision(c.Request.Context(), id, revision, ifMatch, userID, admin)
+	if h.writeError(c, err, "Failed to restore product revision") {
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Product deleted successfully", nil)
+	c.Header("ETag", product.ETag())
+
+	view, ok := h.presentProduct(c, *product, nil)
+	if !ok {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Product revision restored successfully", view)
 }
 
-// ListProducts handles listing all products with pagination and optional filtering
+// ListProducts handles listing products with pagination, filtering by
+// category and tags, and facet counts
 func (h *ProductHandler) ListProducts(c *gin.Context) {
+	userID, admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
 	// Parse pagination parameters
 	pageStr := c.DefaultQuery("page", "1")
 	pageSizeStr := c.DefaultQuery("page_size", "10")
-	category := c.Query("category")
 
 	page, err := strconv.Atoi(pageStr)
 	if err != nil || page < 1 {
@@ -137,11 +446,169 @@ func (h *ProductHandler) ListProducts(c *gin.Context) {
 		pageSize = 10
 	}
 
-	products, err := h.productService.ListProducts(page, pageSize, category)
+	query, ok := listQuery(c, userID, admin)
+	if !ok {
+		return
+	}
+	query.Page, query.PageSize = page, pageSize
+
+	list, err := h.productService.ListProducts(c.Request.Context(), query)
+	if errors.Is(err, money.ErrUnknownCurrency) {
+		utils.BadRequestResponse(c, "Unsupported currency", err)
+		return
+	}
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to list products", err)
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Products retrieved successfully", products)
+	views, ok := h.presentProducts(c, list.Products)
+	if !ok {
+		return
+	}
+
+	facets, ok := h.presentFacets(c, list.Facets)
+	if !ok {
+		return
+	}
+
+	utils.SuccessResponseWithMeta(c, http.StatusOK, "Products retrieved successfully", views, gin.H{"facets": facets})
+}
+
+// listQuery parses the filters of a product listing: category, tags,
+// tag_match, status, in_stock and currency. On invalid filters it responds
+// with 400 and returns false.
+func listQuery(c *gin.Context, userID string, admin bool) (models.ProductQuery, bool) {
+	// Tags may be given comma separated, repeated, or both
+	var tags []string
+	for _, value := range c.QueryArray("tags") {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	tagMatch := c.DefaultQuery("tag_match", "any")
+	if tagMatch != "any" && tagMatch != "all" {
+		utils.BadRequestResponse(c, "tag_match must be any or all", nil)
+		return models.ProductQuery{}, false
+	}
+
+	status := models.ProductStatus(c.DefaultQuery("status", string(models.ProductStatusPublished)))
+	if status != models.ProductStatusDraft && status != models.ProductStatusPublished && status != models.ProductStatusArchived {
+		utils.BadRequestResponse(c, "status must be draft, published or archived", nil)
+		return models.ProductQuery{}, false
+	}
+
+	var inStock *bool
+	if value := c.Query("in_stock"); value != "" {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			utils.BadRequestResponse(c, "in_stock must be true or false", err)
+			return models.ProductQuery{}, false
+		}
+		inStock = &b
+	}
+
+	return models.ProductQuery{
+		Category:     c.Query("category"),
+		Tags:         tags,
+		MatchAllTags: tagMatch == "all",
+		InStock:      inStock,
+		Currency:     c.Query("currency"),
+		Status:       status,
+		UserID:       userID,
+		Admin:        admin,
+	}, true
+}
+
+// SearchProducts handles full-text search over product names and
+// descriptions
+func (h *ProductHandler) SearchProducts(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	if err != nil || pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	results, err := h.productService.SearchProducts(c.Request.Context(), c.Query("q"), page, pageSize)
+	if errors.Is(err, utils.ErrValidation) {
+		utils.BadRequestResponse(c, "Invalid search query", err)
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to search products", err)
+		return
+	}
+
+	views := make([]searchResultView, 0, len(results))
+	for _, result := range results {
+		product, ok := h.presentProduct(c, result.Product, nil)
+		if !ok {
+			return
+		}
+		views = append(views, searchResultView{
+			Product:       product,
+			Rank:          result.Rank,
+			NameHighlight: result.NameHighlight,
+			Snippet:       result.Snippet,
+		})
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Products retrieved successfully", views)
+}
+
+// currentUser returns the ID of the authenticated user and whether they are
+// an admin. Without a user it responds with 401 and returns false.
+func currentUser(c *gin.Context) (string, bool, bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.UnauthorizedResponse(c)
+		return "", false, false
+	}
+	role, _ := c.Get("role")
+	return userID.(string), role == "admin", true
+}
+
+// ifMatch returns the If-Match header of a write request. When If-Match is
+// required and missing it responds with 428 and returns false.
+func (h *ProductHandler) ifMatch(c *gin.Context) (string, bool) {
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" && h.config.RequireIfMatch {
+		utils.ErrorResponse(c, http.StatusPreconditionRequired, "If-Match header is required", nil)
+		return "", false
+	}
+	return ifMatch, true
+}
+
+// writeError responds to a product service error, mapping repository errors
+// to their status codes, and reports whether err was non-nil
+func (h *ProductHandler) writeError(c *gin.Context, err error, message string) bool {
+	if err == nil {
+		return false
+	}
+	if writeRequestError(c, err) {
+		return true
+	}
+
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		utils.NotFoundResponse(c, "Product not found")
+	case errors.Is(err, services.ErrNotProductOwner):
+		utils.ForbiddenResponse(c)
+	case errors.Is(err, models.ErrInvalidStatusTransition):
+		utils.ErrorResponse(c, http.StatusConflict, "Product cannot move to that status", err)
+	case errors.Is(err, repository.ErrPreconditionFailed):
+		utils.ErrorResponse(c, http.StatusPreconditionFailed, "Product was modified by someone else", err)
+	case errors.Is(err, services.ErrVariantsExist):
+		utils.ErrorResponse(c, http.StatusConflict, "Option axes cannot change while the product has variants", err)
+	default:
+		utils.ErrorResponse(c, http.StatusInternalServerError, message, err)
+	}
+	return true
 }
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/peterlimg/supabase-e/config"
+	"github.com/peterlimg/supabase-e/internal/models"
+	"github.com/peterlimg/supabase-e/internal/repository"
+	"github.com/peterlimg/supabase-e/internal/services"
+	"github.com/peterlimg/supabase-e/pkg/utils"
+)
+
+// multipartOverhead is the room left for multipart headers and boundaries on
+// top of the image size limit
+const multipartOverhead = 64 << 10
+
+// ProductImageHandler handles product image requests
+type ProductImageHandler struct {
+	imageService *services.ProductImageService
+	config       *config.Config
+}
+
+// NewProductImageHandler creates a new product image handler
+func NewProductImageHandler(imageService *services.ProductImageService, config *config.Config) *ProductImageHandler {
+	return &ProductImageHandler{
+		imageService: imageService,
+		config:       config,
+	}
+}
+
+// UploadImage handles uploading an image of a product as the "file" field of
+// a multipart form
+func (h *ProductImageHandler) UploadImage(c *gin.Context) {
+	userID, admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	id := c.Param("id")
+	if id == "" {
+		utils.BadRequestResponse(c, "Product ID is required", nil)
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(h.config.ImageMaxBytes)+multipartOverhead)
+	header, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, "Image is too large", err)
+			return
+		}
+		utils.BadRequestResponse(c, "A multipart file field named \"file\" is required", err)
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		utils.BadRequestResponse(c, "Failed to read uploaded file", err)
+		return
+	}
+	defer file.Close()
+
+	image, err := h.imageService.UploadImage(c.Request.Context(), id, file, userID, admin)
+	if h.writeError(c, err, "Failed to upload image") {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Image uploaded successfully", image)
+}
+
+// ListImages handles listing the images of a product in display order
+func (h *ProductImageHandler) ListImages(c *gin.Context) {
+	userID, admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	id := c.Param("id")
+	if id == "" {
+		utils.BadRequestResponse(c, "Product ID is required", nil)
+		return
+	}
+
+	images, err := h.imageService.ListImages(c.Request.Context(), id, userID, admin)
+	if h.writeError(c, err, "Failed to list images") {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Images retrieved successfully", images)
+}
+
+// ReorderImages handles setting the display order of the images of a product
+func (h *ProductImageHandler) ReorderImages(c *gin.Context) {
+	userID, admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	id := c.Param("id")
+	if id == "" {
+		utils.BadRequestResponse(c, "Product ID is required", nil)
+		return
+	}
+
+	var req models.ReorderImagesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request body", err)
+		return
+	}
+
+	images, err := h.imageService.ReorderImages(c.Request.Context(), id, req.ImageIDs, userID, admin)
+	if h.writeError(c, err, "Failed to reorder images") {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Images reordered successfully", images)
+}
+
+// DeleteImage handles deleting an image of a product
+func (h *ProductImageHandler) DeleteImage(c *gin.Context) {
+	userID, admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	id := c.Param("id")
+	imageID := c.Param("imageId")
+	if id == "" || imageID == "" {
+		utils.BadRequestResponse(c, "Product ID and image ID are required", nil)
+		return
+	}
+
+	err := h.imageService.DeleteImage(c.Request.Context(), id, imageID, userID, admin)
+	if h.writeError(c, err, "Failed to delete image") {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Image deleted successfully", nil)
+}
+
+// writeError responds to a product image service error, mapping it to its
+// status code, and reports whether err was non-nil
+func (h *ProductImageHandler) writeError(c *gin.Context, err error, message string) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, repository.ErrNotFound):
+		utils.NotFoundResponse(c, "Product or image not found")
+	case errors.Is(err, services.ErrNotProductOwner):
+		utils.ForbiddenResponse(c)
+	case errors.Is(err, services.ErrUnsupportedImageType):
+		utils.ErrorResponse(c, http.StatusUnsupportedMediaType, "Only JPEG, PNG, GIF and WebP images are supported", err)
+	case errors.Is(err, services.ErrImageTooLarge):
+		utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, "Image is too large", err)
+	case errors.Is(err, services.ErrTooManyImages):
+		utils.ErrorResponse(c, http.StatusConflict, "Product has too many images", err)
+	case errors.Is(err, services.ErrInvalidImageOrder):
+		utils.ErrorResponse(c, http.StatusUnprocessableEntity, "Invalid image order", err)
+	default:
+		utils.ErrorResponse(c, http.StatusInternalServerError, message, err)
+	}
+	return true
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/peterlimg/supabase-e/config"
+	"github.com/peterlimg/supabase-e/internal/models"
+	"github.com/peterlimg/supabase-e/internal/services"
+	"github.com/peterlimg/supabase-e/pkg/utils"
+)
+
+// ProductImportHandler handles bulk product import requests
+type ProductImportHandler struct {
+	importService *services.ProductImportService
+	config        *config.Config
+}
+
+// NewProductImportHandler creates a new product import handler
+func NewProductImportHandler(importService *services.ProductImportService, config *config.Config) *ProductImportHandler {
+	return &ProductImportHandler{
+		importService: importService,
+		config:        config,
+	}
+}
+
+// ImportProducts handles starting an import of a CSV or NDJSON file, sent
+// either as the "file" field of a multipart form or as the request body. The
+// format is taken from the format query parameter, the content type or the
+// file name, and dry_run=true only validates the rows.
+func (h *ProductImportHandler) ImportProducts(c *gin.Context) {
+	userID, admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid dry_run parameter", err)
+		return
+	}
+
+	// Leave room for multipart headers and boundaries on top of the file size
+	// limit
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(h.config.ImportMaxBytes)+multipartOverhead)
+
+	var upload io.Reader = c.Request.Body
+	contentType, filename := c.ContentType(), ""
+	if contentType == "multipart/form-data" {
+		part, err := importFilePart(c)
+		if err != nil {
+			h.writeUploadError(c, err)
+			return
+		}
+		defer part.Close()
+		upload, contentType, filename = part, part.Header.Get("Content-Type"), part.FileName()
+	}
+
+	format, ok := importFormat(c.Query("format"), contentType, filename)
+	if !ok {
+		utils.BadRequestResponse(c, "Import format must be csv or ndjson", nil)
+		return
+	}
+
+	job, err := h.importService.StartImport(c.Request.Context(), upload, format, dryRun, userID, admin)
+	if err != nil {
+		h.writeUploadError(c, err)
+		return
+	}
+
+	c.Header("Location", "/api/v1/products/import/"+job.ID)
+	utils.SuccessResponse(c, http.StatusAccepted, "Product import started", job)
+}
+
+// GetImportJob handles getting the progress of an import job
+func (h *ProductImportHandler) GetImportJob(c *gin.Context) {
+	job, ok := h.job(c)
+	if !ok {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Import job retrieved successfully", job)
+}
+
+// DownloadImportErrors handles downloading the failed rows of an import job
+// as a CSV report
+func (h *ProductImportHandler) DownloadImportErrors(c *gin.Context) {
+	job, ok := h.job(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="import-%s-errors.csv"`, job.ID))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"row", "sku", "error"})
+	for _, rowErr := range job.Errors {
+		w.Write([]string{strconv.Itoa(rowErr.Row), utils.EscapeCSVCell(rowErr.SKU), utils.EscapeCSVCell(rowErr.Error)})
+	}
+	w.Flush()
+}
+
+// job looks up the import job named by the jobId parameter, responding with
+// 404 for jobs of other users
+func (h *ProductImportHandler) job(c *gin.Context) (*models.ImportJob, bool) {
+	userID, admin, ok := currentUser(c)
+	if !ok {
+		return nil, false
+	}
+
+	job, err := h.importService.GetJob(c.Request.Context(), c.Param("jobId"), userID, admin)
+	if errors.Is(err, services.ErrImportJobNotFound) {
+		utils.NotFoundResponse(c, "Import job not found")
+		return nil, false
+	}
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to get import job", err)
+		return nil, false
+	}
+	return job, true
+}
+
+// writeUploadError responds to an upload that could not be read, stored or
+// started
+func (h *ProductImportHandler) writeUploadError(c *gin.Context, err error) {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, "Import file is too large", err)
+	case errors.Is(err, http.ErrMissingFile):
+		utils.BadRequestResponse(c, "A multipart file field named \"file\" is required", err)
+	case errors.Is(err, services.ErrTooManyImports):
+		utils.ErrorResponse(c, http.StatusTooManyRequests, "Too many unfinished imports", err)
+	case errors.Is(err, services.ErrImportsStopped):
+		utils.ErrorResponse(c, http.StatusServiceUnavailable, "Server is shutting down", err)
+	default:
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to start product import", err)
+	}
+}
+
+// importFilePart streams the "file" field of a multipart form without
+// buffering the whole form
+func importFilePart(c *gin.Context) (*multipart.Part, error) {
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, http.ErrMissingFile
+	}
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, http.ErrMissingFile
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+		part.Close()
+	}
+}
+
+// importFormat picks the format of an upload from an explicit format
+// parameter, its content type or its file extension, in that order
+func importFormat(param, contentType, filename string) (models.ImportFormat, bool) {
+	if param != "" {
+		switch format := models.ImportFormat(strings.ToLower(param)); format {
+		case models.ImportFormatCSV, models.ImportFormatNDJSON:
+			return format, true
+		}
+		return "", false
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv", "application/csv":
+		return models.ImportFormatCSV, true
+	case "application/x-ndjson", "application/ndjson", "application/jsonl", "application/x-jsonlines":
+		return models.ImportFormatNDJSON, true
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return models.ImportFormatCSV, true
+	case ".ndjson", ".jsonl":
+		return models.ImportFormatNDJSON, true
+	}
+	return "", false
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/peterlimg/supabase-e/config"
+	"github.com/peterlimg/supabase-e/internal/models"
+	"github.com/peterlimg/supabase-e/internal/repository"
+	"github.com/peterlimg/supabase-e/internal/services"
+	"github.com/peterlimg/supabase-e/pkg/utils"
+)
+
+// ProductVariantHandler handles product variant requests
+type ProductVariantHandler struct {
+	variantService *services.ProductVariantService
+	config         *config.Config
+}
+
+// NewProductVariantHandler creates a new product variant handler
+func NewProductVariantHandler(variantService *services.ProductVariantService, config *config.Config) *ProductVariantHandler {
+	return &ProductVariantHandler{
+		variantService: variantService,
+		config:         config,
+	}
+}
+
+// ListVariants handles listing the variants of a product
+func (h *ProductVariantHandler) ListVariants(c *gin.Context) {
+	userID, admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	variants, err := h.variantService.ListVariants(c.Request.Context(), c.Param("id"), userID, admin)
+	if h.writeError(c, err, "Failed to list variants") {
+		return
+	}
+
+	views := make([]interface{}, 0, len(variants))
+	for _, variant := range variants {
+		view, ok := presentVariant(c, h.config, variant)
+		if !ok {
+			return
+		}
+		views = append(views, view)
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Variants retrieved successfully", views)
+}
+
+// GetVariant handles getting a variant of a product
+func (h *ProductVariantHandler) GetVariant(c *gin.Context) {
+	userID, admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	variant, err := h.variantService.GetVariant(c.Request.Context(), c.Param("id"), c.Param("variantId"), userID, admin)
+	if h.writeError(c, err, "Failed to get variant") {
+		return
+	}
+
+	h.respond(c, http.StatusOK, "Variant retrieved successfully", variant)
+}
+
+// CreateVariant handles adding a variant to a product
+func (h *ProductVariantHandler) CreateVariant(c *gin.Context) {
+	userID, admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req models.CreateVariantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request body", err)
+		return
+	}
+
+	variant, err := h.variantService.CreateVariant(c.Request.Context(), c.Param("id"), req, userID, admin)
+	if h.writeError(c, err, "Failed to create variant") {
+		return
+	}
+
+	h.respond(c, http.StatusCreated, "Variant created successfully", variant)
+}
+
+// UpdateVariant handles replacing the editable fields of a variant
+func (h *ProductVariantHandler) UpdateVariant(c *gin.Context) {
+	userID, admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateVariantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request body", err)
+		return
+	}
+
+	variant, err := h.variantService.UpdateVariant(c.Request.Context(), c.Param("id"), c.Param("variantId"), req, userID, admin)
+	if h.writeError(c, err, "Failed to update variant") {
+		return
+	}
+
+	h.respond(c, http.StatusOK, "Variant updated successfully", variant)
+}
+
+// DeleteVariant handles deleting a variant of a product
+func (h *ProductVariantHandler) DeleteVariant(c *gin.Context) {
+	userID, admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	err := h.variantService.DeleteVariant(c.Request.Context(), c.Param("id"), c.Param("variantId"), userID, admin)
+	if h.writeError(c, err, "Failed to delete variant") {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Variant deleted successfully", nil)
+}
+
+// respond writes a variant in the configured price format
+func (h *ProductVariantHandler) respond(c *gin.Context, statusCode int, message string, variant *models.ProductVariant) {
+	view, ok := presentVariant(c, h.config, *variant)
+	if !ok {
+		return
+	}
+
+	utils.SuccessResponse(c, statusCode, message, view)
+}
+
+// writeError responds to a product variant service error, mapping it to its
+// status code, and reports whether err was non-nil
+func (h *ProductVariantHandler) writeError(c *gin.Context, err error, message string) bool {
+	if err == nil {
+		return false
+	}
+	if writeRequestError(c, err) {
+		return true
+	}
+
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		utils.NotFoundResponse(c, "Product or variant not found")
+	case errors.Is(err, services.ErrNotProductOwner):
+		utils.ForbiddenResponse(c)
+	case errors.Is(err, services.ErrDuplicateVariant):
+		utils.ErrorResponse(c, http.StatusConflict, "A variant with this SKU or these options already exists", err)
+	case errors.Is(err, services.ErrVariantHasStock):
+		utils.ErrorResponse(c, http.StatusConflict, "Adjust the variant's stock to zero before deleting it", err)
+	case errors.Is(err, services.ErrProductHasStock):
+		utils.ErrorResponse(c, http.StatusConflict, "Adjust the product's stock to zero before adding variants", err)
+	default:
+		utils.ErrorResponse(c, http.StatusInternalServerError, message, err)
+	}
+	return true
+}
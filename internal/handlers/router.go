@@ -1,54 +1,116 @@
 package handlers
 
 import (
+	"fmt"
+
 	"github.com/gin-gonic/gin"
 	"github.com/peterlimg/supabase-e/config"
 	"github.com/peterlimg/supabase-e/internal/middleware"
 	"github.com/peterlimg/supabase-e/internal/services"
-	"github.com/peterlimg/supabase-e/pkg/database"
+	"github.com/peterlimg/supabase-e/pkg/health"
+	"github.com/peterlimg/supabase-e/pkg/idempotency"
+	"github.com/peterlimg/supabase-e/pkg/metrics"
+	"github.com/peterlimg/supabase-e/pkg/ratelimit"
 )
 
-// SetupRouter sets up the API routes
+// SetupRouter sets up the API routes. It fails on trusted proxies that are
+// not IP addresses or CIDR ranges.
 func SetupRouter(
 	cfg *config.Config,
-	db *database.Client,
+	healthRegistry *health.Registry,
+	rateLimitStore ratelimit.Store,
+	idempotencyStore idempotency.Store,
 	authService *services.AuthService,
 	productService *services.ProductService,
-) *gin.Engine {
+	productImageService *services.ProductImageService,
+	categoryService *services.CategoryService,
+	stockService *services.StockService,
+	productVariantService *services.ProductVariantService,
+	productImportService *services.ProductImportService,
+) (*gin.Engine, error) {
 	// Create a new Gin router
 	r := gin.New()
 
-	// Use the logger and recovery middleware
+	// Only trust X-Forwarded-For from the configured proxies, so that clients
+	// cannot pick their own IP for rate limits and login throttling
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+
+	// Use the tracing, metrics, logger and recovery middleware
+	r.Use(middleware.TracingMiddleware())
+	r.Use(middleware.MetricsMiddleware())
 	r.Use(middleware.LoggerMiddleware())
 	r.Use(gin.Recovery())
+	r.Use(middleware.TimeoutMiddleware(cfg.RequestTimeout))
 
 	// Create handlers
 	authHandler := NewAuthHandler(authService)
-	productHandler := NewProductHandler(productService)
-	healthHandler := NewHealthHandler(db)
+	productHandler := NewProductHandler(productService, cfg)
+	productImageHandler := NewProductImageHandler(productImageService, cfg)
+	categoryHandler := NewCategoryHandler(categoryService)
+	stockHandler := NewStockHandler(stockService)
+	productVariantHandler := NewProductVariantHandler(productVariantService, cfg)
+	productImportHandler := NewProductImportHandler(productImportService, cfg)
+	healthHandler := NewHealthHandler(healthRegistry)
 
-	// Health check route
+	// Health check routes
 	r.GET("/health", healthHandler.Check)
+	r.GET("/livez", healthHandler.Live)
+	r.GET("/readyz", healthHandler.Ready)
+
+	// Metrics route, unless it is served on a separate admin port
+	if cfg.MetricsEnabled && cfg.MetricsPort == 0 {
+		r.GET(cfg.MetricsPath, gin.WrapH(metrics.Handler()))
+	}
+
+	// Rate limit policies
+	loginLimit := middleware.RateLimitMiddleware(rateLimitStore, rateLimitPolicy("login", cfg.RateLimitLogin), middleware.KeyByIP)
+	authLimit := middleware.RateLimitMiddleware(rateLimitStore, rateLimitPolicy("auth", cfg.RateLimitAuth), middleware.KeyByIP)
+	apiLimit := middleware.RateLimitMiddleware(rateLimitStore, rateLimitPolicy("api", cfg.RateLimitAPI), middleware.KeyByUser)
 
 	// API v1 routes
 	v1 := r.Group("/api/v1")
 	{
-		// Auth routes
+		// Auth routes, limited per client IP
 		auth := v1.Group("/auth")
+		auth.Use(authLimit)
 		{
 			auth.POST("/register", authHandler.Register)
-			auth.POST("/login", authHandler.Login)
+			auth.POST("/login", loginLimit, authHandler.Login)
 		}
 
-		// Protected routes
+		// Protected routes, limited per user; POSTs honor Idempotency-Key
 		protected := v1.Group("")
-		protected.Use(middleware.AuthMiddleware(cfg))
+		protected.Use(
+			middleware.AuthMiddleware(cfg),
+			apiLimit,
+			middleware.IdempotencyMiddleware(idempotencyStore, cfg.IdempotencyTTL, cfg.IdempotencyMaxBytes),
+		)
 		{
 			// User routes
 			user := protected.Group("/users")
 			{
 				user.GET("/me", authHandler.GetProfile)
 				user.PUT("/me", authHandler.UpdateProfile)
+				user.PATCH("/me", authHandler.PatchProfile)
+			}
+
+			// Admin routes
+			admin := protected.Group("/admin")
+			admin.Use(middleware.RoleMiddleware("admin"))
+			{
+				admin.POST("/auth/unlock", authHandler.UnlockAccount)
+			}
+
+			// Category routes; changes are limited to admins
+			categories := protected.Group("/categories")
+			{
+				categories.GET("", categoryHandler.ListCategories)
+				categories.GET("/:id", categoryHandler.GetCategory)
+				categories.POST("", middleware.RoleMiddleware("admin"), categoryHandler.CreateCategory)
+				categories.PUT("/:id", middleware.RoleMiddleware("admin"), categoryHandler.UpdateCategory)
+				categories.DELETE("/:id", middleware.RoleMiddleware("admin"), categoryHandler.DeleteCategory)
 			}
 
 			// Product routes
@@ -56,13 +118,49 @@ func SetupRouter(
 			{
 				products.POST("", productHandler.CreateProduct)
 				products.GET("", productHandler.ListProducts)
+				products.GET("/search", productHandler.SearchProducts)
+				products.GET("/trash", productHandler.ListTrash)
+				products.GET("/export", productHandler.ExportProducts)
+				products.POST("/import", productImportHandler.ImportProducts)
+				products.GET("/import/:jobId", productImportHandler.GetImportJob)
+				products.GET("/import/:jobId/errors", productImportHandler.DownloadImportErrors)
+				products.POST("/batch", productHandler.BatchProducts)
 				products.GET("/:id", productHandler.GetProduct)
 				products.GET("/:id/with-user", productHandler.GetProductWithUser)
 				products.PUT("/:id", productHandler.UpdateProduct)
+				products.PATCH("/:id", productHandler.PatchProduct)
 				products.DELETE("/:id", productHandler.DeleteProduct)
+				products.PUT("/:id/status", productHandler.UpdateStatus)
+				products.POST("/:id/restore", productHandler.RestoreProduct)
+				products.GET("/:id/revisions", productHandler.ListRevisions)
+				products.POST("/:id/revisions/:rev/restore", productHandler.RestoreRevision)
+				products.GET("/:id/images", productImageHandler.ListImages)
+				products.POST("/:id/images", productImageHandler.UploadImage)
+				products.PUT("/:id/images/order", productImageHandler.ReorderImages)
+				products.DELETE("/:id/images/:imageId", productImageHandler.DeleteImage)
+				products.GET("/:id/stock", stockHandler.GetStock)
+				products.PUT("/:id/stock", stockHandler.UpdateStockSettings)
+				products.POST("/:id/stock/adjustments", stockHandler.AdjustStock)
+				products.GET("/:id/stock/movements", stockHandler.ListMovements)
+				products.GET("/:id/variants", productVariantHandler.ListVariants)
+				products.POST("/:id/variants", productVariantHandler.CreateVariant)
+				products.GET("/:id/variants/:variantId", productVariantHandler.GetVariant)
+				products.PUT("/:id/variants/:variantId", productVariantHandler.UpdateVariant)
+				products.DELETE("/:id/variants/:variantId", productVariantHandler.DeleteVariant)
+				products.GET("/:id/variants/:variantId/stock", stockHandler.GetVariantStock)
+				products.POST("/:id/variants/:variantId/stock/adjustments", stockHandler.AdjustStock)
 			}
 		}
 	}
 
-	return r
+	return r, nil
+}
+
+// rateLimitPolicy builds a named rate limit policy from its configuration
+func rateLimitPolicy(name string, limit config.RateLimit) ratelimit.Policy {
+	return ratelimit.Policy{
+		Name:   name,
+		Limit:  limit.Requests,
+		Period: limit.Period,
+	}
 }
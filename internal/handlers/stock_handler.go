@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/peterlimg/supabase-e/internal/models"
+	"github.com/peterlimg/supabase-e/internal/repository"
+	"github.com/peterlimg/supabase-e/internal/services"
+	"github.com/peterlimg/supabase-e/pkg/utils"
+)
+
+// StockHandler handles product stock requests
+type StockHandler struct {
+	stockService *services.StockService
+}
+
+// NewStockHandler creates a new stock handler
+func NewStockHandler(stockService *services.StockService) *StockHandler {
+	return &StockHandler{
+		stockService: stockService,
+	}
+}
+
+// GetStock handles getting the current stock of a product
+func (h *StockHandler) GetStock(c *gin.Context) {
+	userID, admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	level, err := h.stockService.GetStock(c.Request.Context(), c.Param("id"), userID, admin)
+	if h.writeError(c, err, "Failed to get stock") {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Stock retrieved successfully", level)
+}
+
+// GetVariantStock handles getting the current stock of a product variant
+func (h *StockHandler) GetVariantStock(c *gin.Context) {
+	userID, admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	level, err := h.stockService.GetVariantStock(c.Request.Context(), c.Param("id"), c.Param("variantId"), userID, admin)
+	if h.writeError(c, err, "Failed to get stock") {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Stock retrieved successfully", level)
+}
+
+// UpdateStockSettings handles changing the low-stock threshold of a product
+func (h *StockHandler) UpdateStockSettings(c *gin.Context) {
+	userID, admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateStockSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request body", err)
+		return
+	}
+
+	level, err := h.stockService.UpdateStockSettings(c.Request.Context(), c.Param("id"), req, userID, admin)
+	if h.writeError(c, err, "Failed to update stock settings") {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Stock settings updated successfully", level)
+}
+
+// AdjustStock handles changing the stock of a product, or of a product
+// variant on the variant routes, with a reason
+func (h *StockHandler) AdjustStock(c *gin.Context) {
+	userID, admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req models.AdjustStockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "Invalid request body", err)
+		return
+	}
+
+	movement, err := h.stockService.AdjustStock(c.Request.Context(), c.Param("id"), c.Param("variantId"), req, userID, admin)
+	if h.writeError(c, err, "Failed to adjust stock") {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Stock adjusted successfully", movement)
+}
+
+// ListMovements handles listing the stock ledger of a product
+func (h *StockHandler) ListMovements(c *gin.Context) {
+	userID, admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if err != nil || pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	movements, err := h.stockService.ListMovements(c.Request.Context(), c.Param("id"), page, pageSize, userID, admin)
+	if h.writeError(c, err, "Failed to list stock movements") {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Stock movements retrieved successfully", movements)
+}
+
+// writeError responds to a stock service error, mapping it to its status
+// code, and reports whether err was non-nil
+func (h *StockHandler) writeError(c *gin.Context, err error, message string) bool {
+	if err == nil {
+		return false
+	}
+	if writeRequestError(c, err) {
+		return true
+	}
+
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		utils.NotFoundResponse(c, "Product or variant not found")
+	case errors.Is(err, services.ErrNotProductOwner):
+		utils.ForbiddenResponse(c)
+	case errors.Is(err, services.ErrInsufficientStock):
+		utils.ErrorResponse(c, http.StatusConflict, "Not enough stock available", err)
+	case errors.Is(err, services.ErrProductHasVariants):
+		utils.ErrorResponse(c, http.StatusConflict, "Adjust the stock of the product's variants instead", err)
+	default:
+		utils.ErrorResponse(c, http.StatusInternalServerError, message, err)
+	}
+	return true
+}
@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/peterlimg/supabase-e/pkg/idempotency"
+	"github.com/peterlimg/supabase-e/pkg/logger"
+	"github.com/peterlimg/supabase-e/pkg/utils"
+)
+
+// IdempotencyKeyHeader is the request header carrying the idempotency key
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength bounds the key to keep store keys small
+const maxIdempotencyKeyLength = 255
+
+// captureWriter records the response body while writing it through
+type captureWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// Write implements io.Writer
+func (w *captureWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// WriteString implements io.StringWriter
+func (w *captureWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// IdempotencyMiddleware makes POST requests carrying an Idempotency-Key
+// header safe to retry. The first response per user and key is stored for
+// ttl and replayed for repeats; concurrent duplicates get a 409 and reusing a
+// key for a different request body gets a 422. Only empty and JSON bodies of
+// up to maxBytes are covered, since the body is read into memory to
+// fingerprint it; streamed uploads pass through untouched. It must run after
+// AuthMiddleware.
+func IdempotencyMiddleware(store idempotency.Store, ttl time.Duration, maxBytes int) gin.HandlerFunc {
+	log := logger.GetLogger("idempotency")
+
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if c.Request.Method != http.MethodPost || key == "" || (c.Request.ContentLength != 0 && !isJSONBody(c.ContentType())) {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			utils.BadRequestResponse(c, "Idempotency key is too long", nil)
+			c.Abort()
+			return
+		}
+
+		// Scope keys per user so that clients cannot collide with each other
+		scope := KeyByUser(c) + ":" + key
+
+		// Fingerprint the request so that a reused key with a different
+		// payload is detected
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, int64(maxBytes)))
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, "Request body is too large", err)
+			c.Abort()
+			return
+		}
+		if err != nil {
+			utils.BadRequestResponse(c, "Failed to read request body", err)
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.New()
+		hash.Write([]byte(c.Request.Method + " " + c.Request.URL.Path + "\n"))
+		hash.Write(body)
+		fingerprint := hex.EncodeToString(hash.Sum(nil))
+
+		ctx := c.Request.Context()
+		record, err := store.Begin(ctx, scope, fingerprint, ttl)
+		switch {
+		case errors.Is(err, idempotency.ErrInProgress):
+			utils.ErrorResponse(c, http.StatusConflict, "A request with this idempotency key is already in progress", err)
+			c.Abort()
+			return
+		case errors.Is(err, idempotency.ErrFingerprintMismatch):
+			utils.ErrorResponse(c, http.StatusUnprocessableEntity, "Idempotency key was reused with a different request", err)
+			c.Abort()
+			return
+		case err != nil:
+			// Fail open: an unavailable store must not block writes
+			log.Error().Err(err).Msg("Idempotency store failed")
+			c.Next()
+			return
+		case record != nil:
+			// Replay the original response
+			for name, values := range record.Header {
+				for _, v := range values {
+					c.Writer.Header().Add(name, v)
+				}
+			}
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(record.StatusCode, record.Header.Get("Content-Type"), record.Body)
+			c.Abort()
+			return
+		}
+
+		writer := &captureWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		// A panicking handler never gets to complete the key, so it is
+		// released before the panic reaches the recovery middleware
+		defer func() {
+			if r := recover(); r != nil {
+				if err := store.Release(ctx, scope); err != nil {
+					log.Error().Err(err).Msg("Failed to release idempotency key")
+				}
+				panic(r)
+			}
+		}()
+
+		// Process request
+		c.Next()
+
+		// Server errors and abandoned requests are not stored so that the
+		// client may retry them
+		status := writer.Status()
+		if status >= http.StatusInternalServerError || status == utils.StatusClientClosedRequest {
+			if err := store.Release(ctx, scope); err != nil {
+				log.Error().Err(err).Msg("Failed to release idempotency key")
+			}
+			return
+		}
+
+		err = store.Complete(ctx, scope, idempotency.Record{
+			StatusCode: status,
+			Header:     http.Header{"Content-Type": []string{writer.Header().Get("Content-Type")}},
+			Body:       writer.body.Bytes(),
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to store idempotent response")
+		}
+	}
+}
+
+// isJSONBody reports whether a request body of the given media type is JSON,
+// including JSON based types such as application/merge-patch+json
+func isJSONBody(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
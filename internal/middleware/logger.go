@@ -4,11 +4,15 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/rs/zerolog/log"
+	"github.com/peterlimg/supabase-e/pkg/logger"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // LoggerMiddleware logs request and response details
 func LoggerMiddleware() gin.HandlerFunc {
+	httpLogger := logger.GetLogger("http")
+	redactor := logger.GetRedactor()
+
 	return func(c *gin.Context) {
 		// Start timer
 		start := time.Now()
@@ -30,13 +34,13 @@ func LoggerMiddleware() gin.HandlerFunc {
 		// Get request method
 		method := c.Request.Method
 
-		// Construct the full path
+		// Construct the full path, masking sensitive query parameters
 		if raw != "" {
-			path = path + "?" + raw
+			path = path + "?" + redactor.RedactQuery(raw)
 		}
 
 		// Log the request
-		logger := log.With().
+		reqLogger := httpLogger.With().
 			Str("method", method).
 			Str("path", path).
 			Int("status", statusCode).
@@ -44,13 +48,18 @@ func LoggerMiddleware() gin.HandlerFunc {
 			Dur("latency", latency).
 			Logger()
 
+		// Correlate the log line with the request trace
+		if sc := trace.SpanContextFromContext(c.Request.Context()); sc.IsValid() {
+			reqLogger = reqLogger.With().Str("trace_id", sc.TraceID().String()).Logger()
+		}
+
 		switch {
 		case statusCode >= 500:
-			logger.Error().Msg("Server error")
+			reqLogger.Error().Msg("Server error")
 		case statusCode >= 400:
-			logger.Warn().Msg("Client error")
+			reqLogger.Warn().Msg("Client error")
 		default:
-			logger.Info().Msg("Request processed")
+			reqLogger.Info().Msg("Request processed")
 		}
 	}
 }
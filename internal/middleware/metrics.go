@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/peterlimg/supabase-e/pkg/metrics"
+)
+
+// MetricsMiddleware records request counts, latency and in-flight requests
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		metrics.HTTPRequestsInFlight.Inc()
+		defer metrics.HTTPRequestsInFlight.Dec()
+
+		// Process request
+		c.Next()
+
+		// Label by route template so that path parameters do not explode
+		// the label cardinality
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		statusClass := metrics.StatusClass(c.Writer.Status())
+		method := c.Request.Method
+
+		metrics.HTTPRequestsTotal.WithLabelValues(method, route, statusClass).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(method, route, statusClass).Observe(time.Since(start).Seconds())
+	}
+}
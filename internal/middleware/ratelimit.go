@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/peterlimg/supabase-e/pkg/logger"
+	"github.com/peterlimg/supabase-e/pkg/ratelimit"
+	"github.com/peterlimg/supabase-e/pkg/utils"
+)
+
+// RateLimitKeyFunc derives the rate limit identity of a request
+type RateLimitKeyFunc func(c *gin.Context) string
+
+// KeyByIP identifies requests by client IP, for anonymous routes
+func KeyByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// KeyByUser identifies requests by the authenticated user, falling back to
+// the client IP. It must run after AuthMiddleware.
+func KeyByUser(c *gin.Context) string {
+	if userID, exists := c.Get("userID"); exists {
+		return "user:" + userID.(string)
+	}
+	return KeyByIP(c)
+}
+
+// RateLimitMiddleware enforces a token-bucket policy per key and reports the
+// budget in the standard RateLimit-* headers
+func RateLimitMiddleware(store ratelimit.Store, policy ratelimit.Policy, keyFunc RateLimitKeyFunc) gin.HandlerFunc {
+	log := logger.GetLogger("ratelimit")
+
+	return func(c *gin.Context) {
+		if policy.Limit <= 0 {
+			c.Next()
+			return
+		}
+
+		key := policy.Name + ":" + keyFunc(c)
+		res, err := store.Take(c.Request.Context(), key, policy)
+		if err != nil {
+			// Fail open: an unavailable shared store must not take the API down
+			log.Error().Err(err).Str("policy", policy.Name).Msg("Rate limit store failed")
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+		c.Header("RateLimit-Policy", strconv.Itoa(res.Limit)+";w="+strconv.Itoa(ceilSeconds(policy.Period)))
+
+		if !res.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			utils.TooManyRequestsResponse(c)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// ceilSeconds rounds a duration up to whole seconds
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
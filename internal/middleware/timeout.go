@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/peterlimg/supabase-e/pkg/utils"
+)
+
+// TimeoutMiddleware bounds every request by the given timeout. The deadline
+// is carried by the request context so that in-flight Supabase calls are
+// cancelled; handlers that did not respond in time get a 504.
+func TimeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		// Process request
+		c.Next()
+
+		if !c.Writer.Written() && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			utils.GatewayTimeoutResponse(c)
+			c.Abort()
+		}
+	}
+}
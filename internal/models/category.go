@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Category represents a product category. Categories form a tree through
+// their parent.
+type Category struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	ParentID  *string   `json:"parent_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// The product counts are filled in on reads and never written; the total
+	// includes the products of all subcategories
+	ProductCount      *int `json:"product_count,omitempty"`
+	TotalProductCount *int `json:"total_product_count,omitempty"`
+}
+
+// CreateCategoryRequest represents the request to create a category. The
+// slug is derived from the name when omitted.
+type CreateCategoryRequest struct {
+	Name     string  `json:"name" binding:"required,max=100"`
+	Slug     string  `json:"slug,omitempty" binding:"omitempty,max=100"`
+	ParentID *string `json:"parent_id,omitempty" binding:"omitempty,uuid"`
+}
+
+// UpdateCategoryRequest represents the request to replace the editable
+// fields of a category; a null parent_id makes it a top-level category
+type UpdateCategoryRequest struct {
+	Name     string  `json:"name" binding:"required,max=100"`
+	Slug     string  `json:"slug" binding:"required,max=100"`
+	ParentID *string `json:"parent_id" binding:"omitempty,uuid"`
+}
+
+// CategoryProductCount is the number of products directly in a category
+type CategoryProductCount struct {
+	CategoryID   string `json:"category_id"`
+	ProductCount int    `json:"product_count"`
+}
+
+// NewCategory creates a new category with default values
+func NewCategory(req CreateCategoryRequest) Category {
+	now := time.Now()
+	return Category{
+		ID:        uuid.New().String(),
+		Name:      req.Name,
+		Slug:      req.Slug,
+		ParentID:  req.ParentID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
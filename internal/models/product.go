@@ -1,40 +1,185 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/peterlimg/supabase-e/pkg/money"
+	"github.com/peterlimg/supabase-e/pkg/utils"
+	"github.com/shopspring/decimal"
 )
 
+var (
+	// ErrNonPositivePrice is returned for prices that are zero or negative
+	ErrNonPositivePrice = errors.New("price must be greater than zero")
+
+	// ErrInvalidTag is returned for tags without any letters or digits
+	ErrInvalidTag = errors.New("invalid tag")
+
+	// ErrInvalidSKU is returned for SKUs with characters other than letters,
+	// digits, dots, dashes and underscores
+	ErrInvalidSKU = errors.New("sku may only contain letters, digits, '.', '-' and '_'")
+)
+
+// skuPattern matches the SKUs of products
+var skuPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
 // Product represents a product in the system
 type Product struct {
-	ID          string    `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Price       float64   `json:"price"`
-	Category    string    `json:"category"`
-	ImageURL    string    `json:"image_url,omitempty"`
-	CreatedBy   string    `json:"created_by"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-}
-
-// CreateProductRequest represents the request to create a new product
+	ID string `json:"id"`
+	// SKU identifies the product in imports and is unique when set
+	SKU         string          `json:"sku,omitempty"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Price       decimal.Decimal `json:"price"`
+	Currency    string          `json:"currency"`
+	CategoryID  string          `json:"category_id"`
+	Tags        []string        `json:"tags"`
+	// OptionAxes names the options, such as size and color, that tell the
+	// variants of the product apart
+	OptionAxes []string `json:"option_axes"`
+	ImageURL   string   `json:"image_url,omitempty"`
+	// Status is changed through status updates only, and PublishAt and
+	// UnpublishAt schedule the next changes
+	Status      ProductStatus `json:"status"`
+	PublishAt   *time.Time    `json:"publish_at"`
+	UnpublishAt *time.Time    `json:"unpublish_at"`
+	// Stock is changed through stock adjustments only, see StockMovement
+	StockQuantity     int `json:"stock_quantity"`
+	ReservedQuantity  int `json:"reserved_quantity"`
+	LowStockThreshold int `json:"low_stock_threshold"`
+	// AvailableQuantity is computed by the database and never written
+	AvailableQuantity *int      `json:"available_quantity,omitempty"`
+	CreatedBy         string    `json:"created_by"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+	// DeletedAt is set while the product is in the trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Images and Variants are filled in on reads and never written to the
+	// products table
+	Images   []ProductImage   `json:"images,omitempty"`
+	Variants []ProductVariant `json:"variants,omitempty"`
+}
+
+// CreateProductRequest represents the request to create a new product. An
+// empty currency is filled in with the configured default.
 type CreateProductRequest struct {
-	Name        string  `json:"name" binding:"required"`
-	Description string  `json:"description" binding:"required"`
-	Price       float64 `json:"price" binding:"required,gt=0"`
-	Category    string  `json:"category" binding:"required"`
-	ImageURL    string  `json:"image_url,omitempty"`
+	SKU         string          `json:"sku,omitempty" binding:"max=64"`
+	Name        string          `json:"name" binding:"required"`
+	Description string          `json:"description" binding:"required"`
+	Price       decimal.Decimal `json:"price"`
+	Currency    string          `json:"currency,omitempty" binding:"omitempty,len=3"`
+	CategoryID  string          `json:"category_id" binding:"required,uuid"`
+	Tags        []string        `json:"tags,omitempty" binding:"max=20,dive,max=50"`
+	OptionAxes  []string        `json:"option_axes,omitempty"`
+	ImageURL    string          `json:"image_url,omitempty"`
+	// LowStockThreshold is the available quantity at which stock is low
+	LowStockThreshold int `json:"low_stock_threshold,omitempty" binding:"min=0"`
+	// Status defaults to draft; PublishAt and UnpublishAt schedule the
+	// product like a status update does
+	Status      ProductStatus `json:"status,omitempty" binding:"omitempty,oneof=draft published"`
+	PublishAt   *time.Time    `json:"publish_at,omitempty"`
+	UnpublishAt *time.Time    `json:"unpublish_at,omitempty"`
+}
+
+// Validate checks the SKU, the price against its currency, the tags, the
+// option axes and the publishing schedule
+func (r CreateProductRequest) Validate(now time.Time) error {
+	if r.SKU != "" && !skuPattern.MatchString(r.SKU) {
+		return ErrInvalidSKU
+	}
+	if err := validatePrice(r.Price, r.Currency); err != nil {
+		return err
+	}
+	if err := validateTags(r.Tags); err != nil {
+		return err
+	}
+	if err := ValidateOptionAxes(r.OptionAxes); err != nil {
+		return err
+	}
+	return r.StatusUpdate().Validate(now)
 }
 
-// UpdateProductRequest represents the request to update a product
+// StatusUpdate returns the status and schedule the product is created with
+func (r CreateProductRequest) StatusUpdate() UpdateProductStatusRequest {
+	return UpdateProductStatusRequest{
+		Status:      r.Status,
+		PublishAt:   r.PublishAt,
+		UnpublishAt: r.UnpublishAt,
+	}
+}
+
+// UpdateProductRequest represents the request to replace the editable fields
+// of a product. Every field is written, so a null image_url clears it and
+// omitted tags remove all tags, except that omitted option axes are left
+// unchanged.
 type UpdateProductRequest struct {
-	Name        string  `json:"name,omitempty"`
-	Description string  `json:"description,omitempty"`
-	Price       float64 `json:"price,omitempty" binding:"omitempty,gt=0"`
-	Category    string  `json:"category,omitempty"`
-	ImageURL    string  `json:"image_url,omitempty"`
+	Name        *string          `json:"name" binding:"required,min=1"`
+	Description *string          `json:"description" binding:"required"`
+	Price       *decimal.Decimal `json:"price" binding:"required"`
+	Currency    *string          `json:"currency" binding:"required,len=3"`
+	CategoryID  *string          `json:"category_id" binding:"required,uuid"`
+	Tags        []string         `json:"tags" binding:"max=20,dive,max=50"`
+	OptionAxes  *[]string        `json:"option_axes,omitempty"`
+	ImageURL    *string          `json:"image_url"`
+}
+
+// Validate checks the price against its currency, the tags and the option
+// axes
+func (r UpdateProductRequest) Validate() error {
+	if err := validatePrice(*r.Price, *r.Currency); err != nil {
+		return err
+	}
+	if err := validateTags(r.Tags); err != nil {
+		return err
+	}
+	if r.OptionAxes != nil {
+		return ValidateOptionAxes(*r.OptionAxes)
+	}
+	return nil
+}
+
+// validatePrice checks that price is a positive amount of currency
+func validatePrice(price decimal.Decimal, currency string) error {
+	if !price.IsPositive() {
+		return ErrNonPositivePrice
+	}
+	return money.Validate(price, currency)
+}
+
+// validateTags checks that tags are normalized, see NormalizeTags
+func validateTags(tags []string) error {
+	for _, tag := range tags {
+		if !utils.ValidSlug(tag) {
+			return fmt.Errorf("%w: %q", ErrInvalidTag, tag)
+		}
+	}
+	return nil
+}
+
+// NormalizeTags turns free-form tags into their slug form, e.g. "Summer Sale"
+// into "summer-sale", dropping duplicates and sorting them. Tags without any
+// letters or digits are kept as they are so that validation rejects them.
+func NormalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		if slug := utils.Slugify(tag); slug != "" {
+			tag = slug
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized
 }
 
 // ProductResponse represents a product response with additional data
@@ -43,18 +188,52 @@ type ProductResponse struct {
 	CreatedByUser User `json:"created_by_user,omitempty"`
 }
 
+// ETag returns a strong entity tag for the current version of the product,
+// derived from its ID and last update time
+func (p Product) ETag() string {
+	sum := sha256.Sum256([]byte(p.ID + "@" + p.UpdatedAt.UTC().Format(time.RFC3339Nano)))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// UpdateRequest returns the editable fields of the product, the document
+// that patches are applied to
+func (p Product) UpdateRequest() UpdateProductRequest {
+	req := UpdateProductRequest{
+		Name:        &p.Name,
+		Description: &p.Description,
+		Price:       &p.Price,
+		Currency:    &p.Currency,
+		CategoryID:  &p.CategoryID,
+		Tags:        p.Tags,
+		OptionAxes:  &p.OptionAxes,
+	}
+	if p.ImageURL != "" {
+		req.ImageURL = &p.ImageURL
+	}
+	return req
+}
+
 // NewProduct creates a new product with default values
 func NewProduct(req CreateProductRequest, userID string) Product {
 	now := time.Now()
 	return Product{
 		ID:          uuid.New().String(),
+		SKU:         req.SKU,
 		Name:        req.Name,
 		Description: req.Description,
 		Price:       req.Price,
-		Category:    req.Category,
+		Currency:    req.Currency,
+		CategoryID:  req.CategoryID,
+		Tags:        req.Tags,
+		OptionAxes:  req.OptionAxes,
 		ImageURL:    req.ImageURL,
+		Status:      req.Status,
+		PublishAt:   req.PublishAt,
+		UnpublishAt: req.UnpublishAt,
 		CreatedBy:   userID,
 		CreatedAt:   now,
 		UpdatedAt:   now,
+		// Stock starts at zero until the product is restocked
+		LowStockThreshold: req.LowStockThreshold,
 	}
 }
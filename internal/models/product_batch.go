@@ -0,0 +1,55 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ProductBatchOp is the kind of an operation in a product batch
+type ProductBatchOp string
+
+// Supported batch operations
+const (
+	ProductBatchCreate ProductBatchOp = "create"
+	ProductBatchUpdate ProductBatchOp = "update"
+	ProductBatchDelete ProductBatchOp = "delete"
+)
+
+// ProductBatchRequest represents a batch of product writes. Atomic batches
+// are applied in one transaction or not at all; other batches apply every
+// operation that succeeds.
+type ProductBatchRequest struct {
+	Atomic     bool                    `json:"atomic"`
+	Operations []ProductBatchOperation `json:"operations" binding:"required,min=1,dive"`
+}
+
+// ProductBatchOperation is one write of a batch
+type ProductBatchOperation struct {
+	Op ProductBatchOp `json:"op" binding:"required,oneof=create update delete"`
+	// ID names the product of an update or delete
+	ID string `json:"id,omitempty" binding:"required_unless=Op create,omitempty,uuid"`
+	// Product is a create request for creates and a merge patch of the
+	// editable fields for updates
+	Product json.RawMessage `json:"product,omitempty"`
+	// IfMatch makes an update or delete conditional on the product's ETag,
+	// like the If-Match header of single writes
+	IfMatch string `json:"if_match,omitempty"`
+}
+
+// ProductBatchOutcome is the result of one operation of a batch: the
+// written product, or the error that stopped the operation
+type ProductBatchOutcome struct {
+	Product *Product
+	Err     error
+}
+
+// ProductBatchWrite is an operation of a batch that has been validated and
+// is ready to be written. Updates and deletes only apply to the version of
+// the product they were checked against.
+type ProductBatchWrite struct {
+	Op ProductBatchOp `json:"op"`
+	ID string         `json:"id"`
+	// Product is the new product of a create or the normalized update
+	Product           interface{} `json:"product,omitempty"`
+	ExpectedUpdatedAt *time.Time  `json:"expected_updated_at,omitempty"`
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ProductImage represents an image of a product kept in Supabase Storage
+type ProductImage struct {
+	ID          string         `json:"id"`
+	ProductID   string         `json:"product_id"`
+	Path        string         `json:"path"`
+	ContentType string         `json:"content_type"`
+	Size        int64          `json:"size"`
+	Position    int            `json:"position"`
+	Variants    []ImageVariant `json:"variants"`
+	URL         string         `json:"url,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+// ImageVariant is a resized copy of a product image stored next to it
+type ImageVariant struct {
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Path        string `json:"path"`
+	ContentType string `json:"content_type"`
+	URL         string `json:"url,omitempty"`
+}
+
+// ReorderImagesRequest represents the request to reorder the images of a
+// product; it must list every image ID once
+type ReorderImagesRequest struct {
+	ImageIDs []string `json:"image_ids" binding:"required,min=1,dive,required"`
+}
+
+// NewProductImage creates a new product image stored under
+// products/<product ID>/<image ID><ext>
+func NewProductImage(productID, contentType, ext string, size int64, position int) ProductImage {
+	id := uuid.New().String()
+	return ProductImage{
+		ID:          id,
+		ProductID:   productID,
+		Path:        "products/" + productID + "/" + id + ext,
+		ContentType: contentType,
+		Size:        size,
+		Position:    position,
+		CreatedAt:   time.Now(),
+	}
+}
+
+// AddVariant records a variant of the given size stored under
+// products/<product ID>/<image ID>_<width>w<ext>
+func (i *ProductImage) AddVariant(width, height int, contentType, ext string) ImageVariant {
+	variant := ImageVariant{
+		Width:       width,
+		Height:      height,
+		Path:        "products/" + i.ProductID + "/" + i.ID + "_" + strconv.Itoa(width) + "w" + ext,
+		ContentType: contentType,
+	}
+	i.Variants = append(i.Variants, variant)
+	return variant
+}
+
+// ObjectPaths returns the storage paths of the image and its variants
+func (i ProductImage) ObjectPaths() []string {
+	paths := []string{i.Path}
+	for _, v := range i.Variants {
+		paths = append(paths, v.Path)
+	}
+	return paths
+}
@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// ImportFormat is the file format of a product import
+type ImportFormat string
+
+// Supported import formats
+const (
+	ImportFormatCSV    ImportFormat = "csv"
+	ImportFormatNDJSON ImportFormat = "ndjson"
+)
+
+// ImportJobStatus is the progress of a product import job
+type ImportJobStatus string
+
+// Import job statuses
+const (
+	ImportJobPending   ImportJobStatus = "pending"
+	ImportJobRunning   ImportJobStatus = "running"
+	ImportJobCompleted ImportJobStatus = "completed"
+	ImportJobFailed    ImportJobStatus = "failed"
+)
+
+// ImportJob is a product import running in the background. Rows with a SKU
+// of an existing product update it, all others create new products. A dry run
+// validates every row and counts what would change without writing anything.
+type ImportJob struct {
+	ID        string          `json:"id"`
+	Status    ImportJobStatus `json:"status"`
+	Format    ImportFormat    `json:"format"`
+	DryRun    bool            `json:"dry_run"`
+	CreatedBy string          `json:"created_by"`
+	// Rows counts the rows read so far, each of which is created, updated or
+	// failed once its batch is processed
+	Rows    int `json:"rows"`
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Failed  int `json:"failed"`
+	// Error says why a failed job stopped before reading every row
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// Errors lists the rows that failed and is downloaded as a report
+	Errors []ImportRowError `json:"-"`
+}
+
+// Finished reports whether the job has stopped running
+func (j ImportJob) Finished() bool {
+	return j.Status == ImportJobCompleted || j.Status == ImportJobFailed
+}
+
+// ImportRowError says why a row of an import failed. Rows are numbered from
+// 1, not counting a CSV header.
+type ImportRowError struct {
+	Row   int    `json:"row"`
+	SKU   string `json:"sku,omitempty"`
+	Error string `json:"error"`
+}
@@ -0,0 +1,92 @@
+package models
+
+import "github.com/shopspring/decimal"
+
+// ProductFilter selects the products of a listing
+type ProductFilter struct {
+	// CategoryIDs limits the listing to products in any of these categories
+	CategoryIDs []string
+	// Tags limits the listing to products with any of these tags, or with all
+	// of them when MatchAllTags is set
+	Tags         []string
+	MatchAllTags bool
+	// InStock limits the listing to products with or without available stock
+	InStock *bool
+	// Status limits the listing to products in a status
+	Status ProductStatus
+	// CreatedBy limits the listing to products created by a user
+	CreatedBy string
+}
+
+// ProductQuery is a request for a page of products together with facet
+// counts over every product matching the filter
+type ProductQuery struct {
+	Page     int
+	PageSize int
+	// Category is a category ID or slug; its subcategories are included
+	Category     string
+	Tags         []string
+	MatchAllTags bool
+	InStock      *bool
+	// Currency is the currency that price ranges are counted in
+	Currency string
+	// Status defaults to published. Other statuses only list the products of
+	// UserID unless Admin is set.
+	Status ProductStatus
+	UserID string
+	Admin  bool
+}
+
+// ProductList is a page of products with the facets of the whole listing
+type ProductList struct {
+	Products []Product     `json:"products"`
+	Facets   ProductFacets `json:"facets"`
+}
+
+// ProductFacets counts the products of a listing per category, tag and price
+// range
+type ProductFacets struct {
+	Categories  []CategoryFacet   `json:"categories"`
+	Tags        []TagFacet        `json:"tags"`
+	PriceRanges []PriceRangeFacet `json:"price_ranges"`
+}
+
+// CategoryFacet is the number of listed products directly in a category
+type CategoryFacet struct {
+	CategoryID string `json:"category_id"`
+	Name       string `json:"name"`
+	Slug       string `json:"slug"`
+	Count      int    `json:"count"`
+}
+
+// TagFacet is the number of listed products with a tag
+type TagFacet struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// PriceRangeFacet is the number of listed products priced from Min up to but
+// excluding Max; a nil bound leaves the range open on that side
+type PriceRangeFacet struct {
+	Min      *decimal.Decimal `json:"min"`
+	Max      *decimal.Decimal `json:"max"`
+	Currency string           `json:"currency"`
+	Count    int              `json:"count"`
+}
+
+// ProductFacetCounts holds the product counts of a listing as counted by the
+// database: per category ID, per tag and per price range index
+type ProductFacetCounts struct {
+	Categories  map[string]int `json:"categories"`
+	Tags        map[string]int `json:"tags"`
+	PriceRanges map[int]int    `json:"price_ranges"`
+}
+
+// ProductSearchResult is a product matched by a full-text search. The name
+// and snippet mark matched terms with <mark> tags.
+type ProductSearchResult struct {
+	Product       Product `json:"product"`
+	Rank          float64 `json:"rank"`
+	NameHighlight string  `json:"name_highlight"`
+	Snippet       string  `json:"snippet"`
+}
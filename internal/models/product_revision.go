@@ -0,0 +1,87 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// ProductRevision is a snapshot of the editable fields of a product, taken
+// each time the product is created or changed
+type ProductRevision struct {
+	ID        string `json:"id"`
+	ProductID string `json:"product_id"`
+	// Revision numbers the revisions of a product from 1
+	Revision  int                  `json:"revision"`
+	Snapshot  UpdateProductRequest `json:"snapshot"`
+	CreatedBy string               `json:"created_by"`
+	CreatedAt time.Time            `json:"created_at"`
+	// Changes lists the fields that differ from the previous revision and is
+	// filled in on reads
+	Changes []FieldChange `json:"changes"`
+	// Previous is the snapshot of the previous revision, if any, which
+	// Changes are relative to
+	Previous *UpdateProductRequest `json:"-"`
+}
+
+// FieldChange is the old and new value of a changed field. From is null for
+// fields of the first revision.
+type FieldChange struct {
+	Field string          `json:"field"`
+	From  json.RawMessage `json:"from"`
+	To    json.RawMessage `json:"to"`
+}
+
+// DiffSnapshots lists the fields whose JSON values differ between two
+// snapshots, in field name order. A nil previous snapshot yields every field
+// of next.
+func DiffSnapshots(previous, next interface{}) ([]FieldChange, error) {
+	before := map[string]json.RawMessage{}
+	if err := snapshotFields(previous, &before); err != nil {
+		return nil, err
+	}
+	after := map[string]json.RawMessage{}
+	if err := snapshotFields(next, &after); err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, 0, len(after))
+	for field := range after {
+		fields = append(fields, field)
+	}
+	for field := range before {
+		if _, ok := after[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := []FieldChange{}
+	for _, field := range fields {
+		from, to := jsonOrNull(before[field]), jsonOrNull(after[field])
+		if bytes.Equal(from, to) {
+			continue
+		}
+		changes = append(changes, FieldChange{Field: field, From: from, To: to})
+	}
+	return changes, nil
+}
+
+// snapshotFields decodes the JSON form of a snapshot into its fields; a nil
+// snapshot has none
+func snapshotFields(snapshot interface{}, fields *map[string]json.RawMessage) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, fields)
+}
+
+// jsonOrNull returns JSON null for a missing value
+func jsonOrNull(value json.RawMessage) json.RawMessage {
+	if value == nil {
+		return json.RawMessage("null")
+	}
+	return value
+}
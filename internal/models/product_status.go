@@ -0,0 +1,95 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ProductStatus is the lifecycle state of a product. Only published products
+// are shown to everyone; drafts and archived products only to their creator.
+type ProductStatus string
+
+// Supported product statuses
+const (
+	ProductStatusDraft     ProductStatus = "draft"
+	ProductStatusPublished ProductStatus = "published"
+	ProductStatusArchived  ProductStatus = "archived"
+)
+
+var (
+	// ErrInvalidStatusTransition is returned for status changes the lifecycle
+	// does not allow, such as publishing an archived product
+	ErrInvalidStatusTransition = errors.New("invalid status transition")
+
+	// ErrInvalidSchedule is returned for publish and unpublish times that do
+	// not fit the status or each other
+	ErrInvalidSchedule = errors.New("invalid publishing schedule")
+)
+
+// statusTransitions lists the statuses each status may change to. Archived
+// products go back to draft before they can be published again.
+var statusTransitions = map[ProductStatus][]ProductStatus{
+	ProductStatusDraft:     {ProductStatusPublished, ProductStatusArchived},
+	ProductStatusPublished: {ProductStatusDraft, ProductStatusArchived},
+	ProductStatusArchived:  {ProductStatusDraft},
+}
+
+// CanTransitionTo reports whether a product may change from status s to
+// next. Keeping the current status is always allowed.
+func (s ProductStatus) CanTransitionTo(next ProductStatus) bool {
+	if s == next {
+		return true
+	}
+	for _, allowed := range statusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateProductStatusRequest represents the request to change the status of
+// a product and its publishing schedule. The schedule is replaced, so omitted
+// times are cleared.
+type UpdateProductStatusRequest struct {
+	Status ProductStatus `json:"status" binding:"required,oneof=draft published archived"`
+	// PublishAt publishes a draft at the given time
+	PublishAt *time.Time `json:"publish_at"`
+	// UnpublishAt moves a draft or published product back to draft at the
+	// given time, after it was published
+	UnpublishAt *time.Time `json:"unpublish_at"`
+}
+
+// Validate checks that the schedule fits the status and lies in the future
+func (r UpdateProductStatusRequest) Validate(now time.Time) error {
+	if r.PublishAt != nil {
+		if r.Status != ProductStatusDraft {
+			return fmt.Errorf("%w: publish_at is only allowed for drafts", ErrInvalidSchedule)
+		}
+		if !r.PublishAt.After(now) {
+			return fmt.Errorf("%w: publish_at must be in the future", ErrInvalidSchedule)
+		}
+	}
+	if r.UnpublishAt != nil {
+		if r.Status == ProductStatusArchived {
+			return fmt.Errorf("%w: unpublish_at is not allowed for archived products", ErrInvalidSchedule)
+		}
+		if r.Status == ProductStatusDraft && r.PublishAt == nil {
+			return fmt.Errorf("%w: unpublish_at needs publish_at for drafts", ErrInvalidSchedule)
+		}
+		if !r.UnpublishAt.After(now) {
+			return fmt.Errorf("%w: unpublish_at must be in the future", ErrInvalidSchedule)
+		}
+		if r.PublishAt != nil && !r.UnpublishAt.After(*r.PublishAt) {
+			return fmt.Errorf("%w: unpublish_at must be after publish_at", ErrInvalidSchedule)
+		}
+	}
+	return nil
+}
+
+// VisibleTo reports whether a user may see the product: published products
+// are visible to everyone, others only to their creator and admins
+func (p Product) VisibleTo(userID string, admin bool) bool {
+	return p.Status == ProductStatusPublished || p.CreatedBy == userID || admin
+}
@@ -0,0 +1,186 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/peterlimg/supabase-e/pkg/utils"
+	"github.com/shopspring/decimal"
+)
+
+// maxOptionAxes is the largest number of option axes a product may have
+const maxOptionAxes = 3
+
+var (
+	// ErrInvalidOptionAxes is returned for option axes that are not distinct
+	// slugs
+	ErrInvalidOptionAxes = errors.New("option axes must be at most 3 distinct lowercase names")
+
+	// ErrOptionsMismatch is returned for variant options that do not give
+	// exactly one value for each option axis of the product
+	ErrOptionsMismatch = errors.New("options must have a value for each option axis of the product")
+)
+
+// ProductVariant is a purchasable version of a product, such as a size and
+// color combination, with its own SKU, price and stock
+type ProductVariant struct {
+	ID        string `json:"id"`
+	ProductID string `json:"product_id"`
+	SKU       string `json:"sku"`
+	// Options maps each option axis of the product to this variant's value
+	Options map[string]string `json:"options"`
+	// Price overrides the product price when set; it is in the product's
+	// currency
+	Price *decimal.Decimal `json:"price"`
+	// Currency is filled in from the product on reads and never written
+	Currency string `json:"currency,omitempty"`
+	// ImageIDs refers to images of the product that show this variant
+	ImageIDs []string `json:"image_ids"`
+	// Stock is changed through stock adjustments only, see StockMovement
+	StockQuantity     int `json:"stock_quantity"`
+	ReservedQuantity  int `json:"reserved_quantity"`
+	LowStockThreshold int `json:"low_stock_threshold"`
+	// AvailableQuantity is computed by the database and never written
+	AvailableQuantity *int      `json:"available_quantity,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// CreateVariantRequest represents the request to create a variant. A null or
+// omitted price uses the product price.
+type CreateVariantRequest struct {
+	SKU               string            `json:"sku" binding:"required,max=64"`
+	Options           map[string]string `json:"options" binding:"dive,keys,required,endkeys,required,max=50"`
+	Price             *decimal.Decimal  `json:"price"`
+	ImageIDs          []string          `json:"image_ids" binding:"dive,uuid"`
+	LowStockThreshold int               `json:"low_stock_threshold,omitempty" binding:"min=0"`
+}
+
+// UpdateVariantRequest represents the request to replace the editable fields
+// of a variant. Every field is written, so a null price falls back to the
+// product price and omitted image_ids detach all images.
+type UpdateVariantRequest struct {
+	SKU               *string           `json:"sku" binding:"required,max=64"`
+	Options           map[string]string `json:"options" binding:"dive,keys,required,endkeys,required,max=50"`
+	Price             *decimal.Decimal  `json:"price"`
+	ImageIDs          []string          `json:"image_ids" binding:"dive,uuid"`
+	LowStockThreshold *int              `json:"low_stock_threshold" binding:"required,min=0"`
+}
+
+// NormalizeOptionAxes turns option axes into their slug form, e.g. "Color"
+// into "color". Axes without any letters or digits are kept as they are so
+// that validation rejects them.
+func NormalizeOptionAxes(axes []string) []string {
+	normalized := make([]string, 0, len(axes))
+	for _, axis := range axes {
+		if slug := utils.Slugify(axis); slug != "" {
+			axis = slug
+		}
+		normalized = append(normalized, axis)
+	}
+	return normalized
+}
+
+// ValidateOptionAxes checks that option axes are at most three distinct
+// slugs
+func ValidateOptionAxes(axes []string) error {
+	if len(axes) > maxOptionAxes {
+		return ErrInvalidOptionAxes
+	}
+	seen := make(map[string]bool, len(axes))
+	for _, axis := range axes {
+		if !utils.ValidSlug(axis) || seen[axis] {
+			return fmt.Errorf("%w: %q", ErrInvalidOptionAxes, axis)
+		}
+		seen[axis] = true
+	}
+	return nil
+}
+
+// NormalizeOptions trims option values and puts their axes into slug form
+func NormalizeOptions(options map[string]string) map[string]string {
+	normalized := make(map[string]string, len(options))
+	for axis, value := range options {
+		if slug := utils.Slugify(axis); slug != "" {
+			axis = slug
+		}
+		normalized[axis] = strings.TrimSpace(value)
+	}
+	return normalized
+}
+
+// ValidateOptions checks that options give a non-empty value for each of the
+// axes and nothing else
+func ValidateOptions(options map[string]string, axes []string) error {
+	if len(options) != len(axes) {
+		return fmt.Errorf("%w: expected %s", ErrOptionsMismatch, strings.Join(axes, ", "))
+	}
+	for _, axis := range axes {
+		if options[axis] == "" {
+			return fmt.Errorf("%w: expected %s", ErrOptionsMismatch, strings.Join(axes, ", "))
+		}
+	}
+	return nil
+}
+
+// OptionsKey returns a key that is equal for equal option combinations,
+// regardless of the axis order and the case of the values
+func OptionsKey(options map[string]string) string {
+	axes := make([]string, 0, len(options))
+	for axis := range options {
+		axes = append(axes, axis)
+	}
+	sort.Strings(axes)
+
+	var b strings.Builder
+	for _, axis := range axes {
+		b.WriteString(axis)
+		b.WriteByte('=')
+		b.WriteString(strings.ToLower(options[axis]))
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// StockLevel returns the current stock of the variant
+func (v ProductVariant) StockLevel() StockLevel {
+	available := v.StockQuantity - v.ReservedQuantity
+	return StockLevel{
+		ProductID:         v.ProductID,
+		VariantID:         v.ID,
+		StockQuantity:     v.StockQuantity,
+		ReservedQuantity:  v.ReservedQuantity,
+		AvailableQuantity: available,
+		LowStockThreshold: v.LowStockThreshold,
+		LowStock:          available <= v.LowStockThreshold,
+	}
+}
+
+// NewProductVariant creates a new variant of a product with no stock
+func NewProductVariant(productID string, req CreateVariantRequest) ProductVariant {
+	now := time.Now()
+	return ProductVariant{
+		ID:                uuid.New().String(),
+		ProductID:         productID,
+		SKU:               req.SKU,
+		Options:           req.Options,
+		Price:             req.Price,
+		ImageIDs:          req.ImageIDs,
+		LowStockThreshold: req.LowStockThreshold,
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+}
+
+// ValidateVariantPrice checks that a price override, if any, is a positive
+// amount of the product's currency
+func ValidateVariantPrice(price *decimal.Decimal, currency string) error {
+	if price == nil {
+		return nil
+	}
+	return validatePrice(*price, currency)
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// StockReason says why the stock of a product changed
+type StockReason string
+
+// Supported stock movement reasons
+const (
+	StockReasonRestock     StockReason = "restock"
+	StockReasonSale        StockReason = "sale"
+	StockReasonReturn      StockReason = "return"
+	StockReasonDamage      StockReason = "damage"
+	StockReasonCorrection  StockReason = "correction"
+	StockReasonReservation StockReason = "reservation"
+	StockReasonRelease     StockReason = "release"
+)
+
+// ErrEmptyStockAdjustment is returned for adjustments that change nothing
+var ErrEmptyStockAdjustment = errors.New("quantity_change or reserved_change must be non-zero")
+
+// StockMovement is an entry of the append-only stock ledger. The quantities
+// are the levels of the product, or of the variant if set, after the movement.
+type StockMovement struct {
+	ID               string      `json:"id"`
+	ProductID        string      `json:"product_id"`
+	VariantID        *string     `json:"variant_id"`
+	QuantityChange   int         `json:"quantity_change"`
+	ReservedChange   int         `json:"reserved_change"`
+	StockQuantity    int         `json:"stock_quantity"`
+	ReservedQuantity int         `json:"reserved_quantity"`
+	Reason           StockReason `json:"reason"`
+	Note             string      `json:"note,omitempty"`
+	CreatedBy        string      `json:"created_by"`
+	CreatedAt        time.Time   `json:"created_at"`
+}
+
+// AdjustStockRequest represents a request to change the stock of a product.
+// QuantityChange moves the stock on hand and ReservedChange the part of it
+// held for pending orders; a sale of reserved items lowers both.
+type AdjustStockRequest struct {
+	QuantityChange int         `json:"quantity_change"`
+	ReservedChange int         `json:"reserved_change"`
+	Reason         StockReason `json:"reason" binding:"required,oneof=restock sale return damage correction reservation release"`
+	Note           string      `json:"note,omitempty" binding:"max=500"`
+}
+
+// Validate checks that the adjustment changes something
+func (r AdjustStockRequest) Validate() error {
+	if r.QuantityChange == 0 && r.ReservedChange == 0 {
+		return ErrEmptyStockAdjustment
+	}
+	return nil
+}
+
+// UpdateStockSettingsRequest represents a request to change the low-stock
+// threshold of a product
+type UpdateStockSettingsRequest struct {
+	LowStockThreshold *int `json:"low_stock_threshold" binding:"required,min=0"`
+}
+
+// StockLevel is the current stock of a product or one of its variants
+type StockLevel struct {
+	ProductID         string `json:"product_id"`
+	VariantID         string `json:"variant_id,omitempty"`
+	StockQuantity     int    `json:"stock_quantity"`
+	ReservedQuantity  int    `json:"reserved_quantity"`
+	AvailableQuantity int    `json:"available_quantity"`
+	LowStockThreshold int    `json:"low_stock_threshold"`
+	LowStock          bool   `json:"low_stock"`
+}
+
+// StockLevel returns the current stock of the product, which for a product
+// with variants is the total of its variants. Stock is low once the available
+// quantity drops to the threshold.
+func (p Product) StockLevel() StockLevel {
+	available := p.StockQuantity - p.ReservedQuantity
+	return StockLevel{
+		ProductID:         p.ID,
+		StockQuantity:     p.StockQuantity,
+		ReservedQuantity:  p.ReservedQuantity,
+		AvailableQuantity: available,
+		LowStockThreshold: p.LowStockThreshold,
+		LowStock:          available <= p.LowStockThreshold,
+	}
+}
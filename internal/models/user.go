@@ -25,10 +25,12 @@ type CreateUserRequest struct {
 	LastName  string `json:"last_name" binding:"required"`
 }
 
-// UpdateUserRequest represents the request to update a user
+// UpdateUserRequest represents the request to replace the editable fields of
+// a user. Patches are merged into it and validated like a full update, so a
+// patch cannot clear a required field.
 type UpdateUserRequest struct {
-	FirstName string `json:"first_name,omitempty"`
-	LastName  string `json:"last_name,omitempty"`
+	FirstName string `json:"first_name" binding:"required"`
+	LastName  string `json:"last_name" binding:"required"`
 }
 
 // LoginRequest represents the request to login
@@ -37,12 +39,26 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// UnlockAccountRequest represents the request to clear an account lockout
+type UnlockAccountRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
 // LoginResponse represents the response to a successful login
 type LoginResponse struct {
 	User  User   `json:"user"`
 	Token string `json:"token"`
 }
 
+// UpdateRequest returns the editable fields of the user, the document that
+// patches are applied to
+func (u User) UpdateRequest() UpdateUserRequest {
+	return UpdateUserRequest{
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+	}
+}
+
 // NewUser creates a new user with default values
 func NewUser(email, firstName, lastName string) User {
 	now := time.Now()
@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/peterlimg/supabase-e/internal/models"
+	"github.com/peterlimg/supabase-e/pkg/database"
+	"github.com/peterlimg/supabase-e/pkg/metrics"
+)
+
+// categoryMetricsLabel identifies the category repository in Supabase call
+// metrics
+const categoryMetricsLabel = "category"
+
+// CategoryRepository handles category data operations
+type CategoryRepository struct {
+	db *database.Client
+}
+
+// NewCategoryRepository creates a new category repository
+func NewCategoryRepository(db *database.Client) *CategoryRepository {
+	return &CategoryRepository{
+		db: db,
+	}
+}
+
+// Create creates a new category. A duplicate slug yields ErrConflict.
+func (r *CategoryRepository) Create(ctx context.Context, category models.Category) (*models.Category, error) {
+	var result []models.Category
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("categories").Insert(category).ExecuteWithContext(callCtx, &result)
+	metrics.ObserveSupabaseCall(categoryMetricsLabel, "Create", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create category: %w", constraintError(err))
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no category returned after insert")
+	}
+
+	return &result[0], nil
+}
+
+// GetByID retrieves a category by ID
+func (r *CategoryRepository) GetByID(ctx context.Context, id string) (*models.Category, error) {
+	return r.getBy(ctx, "GetByID", "id", id)
+}
+
+// GetBySlug retrieves a category by slug
+func (r *CategoryRepository) GetBySlug(ctx context.Context, slug string) (*models.Category, error) {
+	return r.getBy(ctx, "GetBySlug", "slug", slug)
+}
+
+// getBy retrieves the category whose column equals value
+func (r *CategoryRepository) getBy(ctx context.Context, method, column, value string) (*models.Category, error) {
+	var categories []models.Category
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("categories").Select("*").Eq(column, value).ExecuteWithContext(callCtx, &categories)
+	metrics.ObserveSupabaseCall(categoryMetricsLabel, method, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get category: %w", err)
+	}
+
+	if len(categories) == 0 {
+		return nil, fmt.Errorf("category %w", ErrNotFound)
+	}
+
+	return &categories[0], nil
+}
+
+// List lists all categories ordered by name
+func (r *CategoryRepository) List(ctx context.Context) ([]models.Category, error) {
+	var categories []models.Category
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("categories").Select("*").OrderBy("name", "asc").ExecuteWithContext(callCtx, &categories)
+	metrics.ObserveSupabaseCall(categoryMetricsLabel, "List", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list categories: %w", err)
+	}
+
+	return categories, nil
+}
+
+// Update updates a category. A duplicate slug yields ErrConflict.
+func (r *CategoryRepository) Update(ctx context.Context, id string, category models.UpdateCategoryRequest) (*models.Category, error) {
+	var result []models.Category
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("categories").Update(category).Eq("id", id).ExecuteWithContext(callCtx, &result)
+	metrics.ObserveSupabaseCall(categoryMetricsLabel, "Update", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update category: %w", constraintError(err))
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("category %w", ErrNotFound)
+	}
+
+	return &result[0], nil
+}
+
+// Delete deletes a category. Categories still referenced by products or
+// subcategories yield ErrConflict.
+func (r *CategoryRepository) Delete(ctx context.Context, id string) error {
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("categories").Delete().Eq("id", id).ExecuteWithContext(callCtx, nil)
+	metrics.ObserveSupabaseCall(categoryMetricsLabel, "Delete", start, err)
+	if err != nil {
+		return fmt.Errorf("failed to delete category: %w", constraintError(err))
+	}
+
+	return nil
+}
+
+// ProductCounts returns the number of products directly in each category
+// that has any
+func (r *CategoryRepository) ProductCounts(ctx context.Context) ([]models.CategoryProductCount, error) {
+	var counts []models.CategoryProductCount
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.Rpc("category_product_counts", map[string]interface{}{}).ExecuteWithContext(callCtx, &counts)
+	metrics.ObserveSupabaseCall(categoryMetricsLabel, "ProductCounts", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count products per category: %w", err)
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	postgrest "github.com/nedpals/supabase-go/postgrest/pkg"
+)
+
+var (
+	// ErrNotFound is returned when the requested record does not exist
+	ErrNotFound = errors.New("not found")
+
+	// ErrPreconditionFailed is returned when a conditional write finds the
+	// record was changed since the caller read it
+	ErrPreconditionFailed = errors.New("record was modified concurrently")
+
+	// ErrConflict is returned when a write violates a unique, foreign key or
+	// check constraint
+	ErrConflict = errors.New("conflicts with existing data")
+
+	// ErrLimitExceeded is returned when a write would take a record past a
+	// limit enforced by a database function
+	ErrLimitExceeded = errors.New("limit exceeded")
+
+	// ErrInvalidArgument is returned when a database function rejects its
+	// arguments
+	ErrInvalidArgument = errors.New("invalid argument")
+)
+
+// PostgreSQL error codes reported by PostgREST
+const (
+	pgForeignKeyViolation = "23503"
+	pgUniqueViolation     = "23505"
+	pgCheckViolation      = "23514"
+	pgInvalidParameter    = "22023"
+	pgLimitExceeded       = "54000"
+	pgNoDataFound         = "P0002"
+	// pgPreconditionFailed is raised by database functions for conditional
+	// writes that find the record changed; PostgREST answers it with a 412
+	pgPreconditionFailed = "PT412"
+)
+
+// BatchError is returned when one write of a batch fails, which rolls back
+// the whole batch
+type BatchError struct {
+	// Index is the position of the failed write in the batch
+	Index int
+	Err   error
+}
+
+// Error implements error
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch write %d: %v", e.Index, e.Err)
+}
+
+// Unwrap returns the error of the failed write
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// constraintError wraps constraint violations reported by PostgREST in
+// ErrConflict, and the no_data_found, precondition, limit and invalid
+// argument errors raised by database functions in ErrNotFound,
+// ErrPreconditionFailed, ErrLimitExceeded and ErrInvalidArgument. Other
+// errors are returned unchanged.
+func constraintError(err error) error {
+	var reqErr *postgrest.RequestError
+	if !errors.As(err, &reqErr) {
+		return err
+	}
+	switch reqErr.Code {
+	case pgUniqueViolation, pgForeignKeyViolation, pgCheckViolation:
+		return fmt.Errorf("%w: %s", ErrConflict, reqErr.Message)
+	case pgNoDataFound:
+		return fmt.Errorf("%s: %w", reqErr.Message, ErrNotFound)
+	case pgPreconditionFailed:
+		return fmt.Errorf("%s: %w", reqErr.Message, ErrPreconditionFailed)
+	case pgLimitExceeded:
+		return fmt.Errorf("%s: %w", reqErr.Message, ErrLimitExceeded)
+	case pgInvalidParameter:
+		return fmt.Errorf("%s: %w", reqErr.Message, ErrInvalidArgument)
+	}
+	return err
+}
+
+// isRangeNotSatisfiable reports whether PostgREST rejected a page that starts
+// past the last row
+func isRangeNotSatisfiable(err error) bool {
+	var reqErr *postgrest.RequestError
+	return errors.As(err, &reqErr) && reqErr.HTTPStatusCode == http.StatusRequestedRangeNotSatisfiable
+}
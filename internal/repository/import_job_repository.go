@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	postgrest "github.com/nedpals/supabase-go/postgrest/pkg"
+	"github.com/peterlimg/supabase-e/internal/models"
+	"github.com/peterlimg/supabase-e/pkg/database"
+	"github.com/peterlimg/supabase-e/pkg/metrics"
+)
+
+// importJobMetricsLabel identifies the import job repository in Supabase
+// call metrics
+const importJobMetricsLabel = "import_job"
+
+// importJobRecord is an import job as stored, with the failed rows that job
+// responses leave out and the instance running the job
+type importJobRecord struct {
+	models.ImportJob
+	Errors []models.ImportRowError `json:"errors,omitempty"`
+	Worker string                  `json:"worker,omitempty"`
+}
+
+// ImportJobRepository handles the stored state of product import jobs
+type ImportJobRepository struct {
+	db *database.Client
+}
+
+// NewImportJobRepository creates a new import job repository
+func NewImportJobRepository(db *database.Client) *ImportJobRepository {
+	return &ImportJobRepository{
+		db: db,
+	}
+}
+
+// Create stores a new import job run by worker
+func (r *ImportJobRepository) Create(ctx context.Context, job *models.ImportJob, worker string) error {
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("import_jobs").
+		Insert(importJobRecord{ImportJob: *job, Worker: worker}).
+		ExecuteWithContext(callCtx, nil)
+	metrics.ObserveSupabaseCall(importJobMetricsLabel, "Create", start, err)
+	if err != nil {
+		return fmt.Errorf("failed to create import job: %w", constraintError(err))
+	}
+
+	return nil
+}
+
+// Update stores the status and progress of an import job. The failed rows
+// are only stored once the job has finished, so that saving the progress of
+// a running job stays cheap.
+func (r *ImportJobRepository) Update(ctx context.Context, job *models.ImportJob) error {
+	record := importJobRecord{ImportJob: *job}
+	if job.Finished() {
+		record.Errors = job.Errors
+	}
+
+	var result []importJobRecord
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("import_jobs").
+		Update(record).
+		Eq("id", job.ID).
+		ExecuteWithContext(callCtx, &result)
+	metrics.ObserveSupabaseCall(importJobMetricsLabel, "Update", start, err)
+	if err != nil {
+		return fmt.Errorf("failed to update import job: %w", err)
+	}
+
+	if len(result) == 0 {
+		return fmt.Errorf("import job %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// GetByID retrieves an import job along with its failed rows
+func (r *ImportJobRepository) GetByID(ctx context.Context, id string) (*models.ImportJob, error) {
+	var records []importJobRecord
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("import_jobs").Select("*").Eq("id", id).ExecuteWithContext(callCtx, &records)
+	metrics.ObserveSupabaseCall(importJobMetricsLabel, "GetByID", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get import job: %w", err)
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("import job %w", ErrNotFound)
+	}
+
+	job := records[0].ImportJob
+	job.Errors = records[0].Errors
+	if job.Errors == nil {
+		job.Errors = []models.ImportRowError{}
+	}
+	return &job, nil
+}
+
+// FailUnfinished fails the unfinished jobs of worker with reason and
+// returns how many there were
+func (r *ImportJobRepository) FailUnfinished(ctx context.Context, worker, reason string, now time.Time) (int, error) {
+	return r.fail(ctx, "FailUnfinished", reason, now, func(query *postgrest.FilterRequestBuilder) {
+		query.Eq("worker", worker)
+	})
+}
+
+// FailStale fails the unfinished jobs of any worker that made no progress
+// since a time with reason and returns how many there were
+func (r *ImportJobRepository) FailStale(ctx context.Context, updatedBefore time.Time, reason string, now time.Time) (int, error) {
+	return r.fail(ctx, "FailStale", reason, now, func(query *postgrest.FilterRequestBuilder) {
+		query.Lt("updated_at", formatTimestamp(updatedBefore))
+	})
+}
+
+// fail fails the unfinished jobs matching filter
+func (r *ImportJobRepository) fail(ctx context.Context, method, reason string, now time.Time, filter func(*postgrest.FilterRequestBuilder)) (int, error) {
+	var result []importJobRecord
+	query := r.db.ServiceClient.DB.From("import_jobs").
+		Update(map[string]interface{}{
+			"status":      models.ImportJobFailed,
+			"error":       reason,
+			"finished_at": formatTimestamp(now),
+		}).
+		IsNull("finished_at")
+	filter(query)
+
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := query.ExecuteWithContext(callCtx, &result)
+	metrics.ObserveSupabaseCall(importJobMetricsLabel, method, start, err)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fail unfinished import jobs: %w", err)
+	}
+
+	return len(result), nil
+}
+
+// DeleteFinishedBefore deletes the jobs that finished before a time
+func (r *ImportJobRepository) DeleteFinishedBefore(ctx context.Context, before time.Time) error {
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("import_jobs").
+		Delete().
+		Lt("finished_at", formatTimestamp(before)).
+		ExecuteWithContext(callCtx, nil)
+	metrics.ObserveSupabaseCall(importJobMetricsLabel, "DeleteFinishedBefore", start, err)
+	if err != nil {
+		return fmt.Errorf("failed to delete finished import jobs: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/peterlimg/supabase-e/internal/models"
+	"github.com/peterlimg/supabase-e/pkg/database"
+	"github.com/peterlimg/supabase-e/pkg/metrics"
+)
+
+// productImageMetricsLabel identifies the product image repository in
+// Supabase call metrics
+const productImageMetricsLabel = "product_image"
+
+// ProductImageRepository handles product image records. The image files
+// themselves live in Supabase Storage.
+type ProductImageRepository struct {
+	db *database.Client
+}
+
+// NewProductImageRepository creates a new product image repository
+func NewProductImageRepository(db *database.Client) *ProductImageRepository {
+	return &ProductImageRepository{
+		db: db,
+	}
+}
+
+// Create appends a new image record to the images of a product, giving it
+// the next position, unless the product already has maxImages images. The
+// product's update time is bumped.
+func (r *ProductImageRepository) Create(ctx context.Context, image models.ProductImage, maxImages int) (*models.ProductImage, error) {
+	var result models.ProductImage
+	params := map[string]interface{}{
+		"p_image":      image,
+		"p_max_images": maxImages,
+	}
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.Rpc("add_product_image", params).ExecuteWithContext(callCtx, &result)
+	metrics.ObserveSupabaseCall(productImageMetricsLabel, "Create", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create product image: %w", constraintError(err))
+	}
+
+	return &result, nil
+}
+
+// ListByProduct lists the images of a product in display order
+func (r *ProductImageRepository) ListByProduct(ctx context.Context, productID string) ([]models.ProductImage, error) {
+	var images []models.ProductImage
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("product_images").Select("*").
+		OrderBy("position", "asc").
+		Eq("product_id", productID).
+		ExecuteWithContext(callCtx, &images)
+	metrics.ObserveSupabaseCall(productImageMetricsLabel, "ListByProduct", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list product images: %w", err)
+	}
+
+	return images, nil
+}
+
+// GetByID retrieves an image of a product by ID
+func (r *ProductImageRepository) GetByID(ctx context.Context, productID, id string) (*models.ProductImage, error) {
+	var images []models.ProductImage
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("product_images").Select("*").
+		Eq("id", id).
+		Eq("product_id", productID).
+		ExecuteWithContext(callCtx, &images)
+	metrics.ObserveSupabaseCall(productImageMetricsLabel, "GetByID", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product image: %w", err)
+	}
+
+	if len(images) == 0 {
+		return nil, fmt.Errorf("product image %w", ErrNotFound)
+	}
+
+	return &images[0], nil
+}
+
+// Reorder sets the display order of the images of a product, which imageIDs
+// must list exactly once each, and returns them in their new order. The
+// product's update time is bumped.
+func (r *ProductImageRepository) Reorder(ctx context.Context, productID string, imageIDs []string) ([]models.ProductImage, error) {
+	var images []models.ProductImage
+	params := map[string]interface{}{
+		"p_product_id": productID,
+		"p_image_ids":  imageIDs,
+	}
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.Rpc("reorder_product_images", params).ExecuteWithContext(callCtx, &images)
+	metrics.ObserveSupabaseCall(productImageMetricsLabel, "Reorder", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reorder product images: %w", constraintError(err))
+	}
+
+	return images, nil
+}
+
+// Delete deletes a product image record
+func (r *ProductImageRepository) Delete(ctx context.Context, id string) error {
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("product_images").Delete().Eq("id", id).ExecuteWithContext(callCtx, nil)
+	metrics.ObserveSupabaseCall(productImageMetricsLabel, "Delete", start, err)
+	if err != nil {
+		return fmt.Errorf("failed to delete product image: %w", err)
+	}
+
+	return nil
+}
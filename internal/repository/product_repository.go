@@ -1,12 +1,22 @@
 package repository
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
+	postgrest "github.com/nedpals/supabase-go/postgrest/pkg"
 	"github.com/peterlimg/supabase-e/internal/models"
 	"github.com/peterlimg/supabase-e/pkg/database"
+	"github.com/peterlimg/supabase-e/pkg/metrics"
+	"github.com/shopspring/decimal"
 )
 
+// productMetricsLabel identifies the product repository in Supabase call metrics
+const productMetricsLabel = "product"
+
 // ProductRepository handles product data operations
 type ProductRepository struct {
 	db *database.Client
@@ -19,12 +29,17 @@ func NewProductRepository(db *database.Client) *ProductRepository {
 	}
 }
 
-// Create creates a new product
-func (r *ProductRepository) Create(product models.Product) (*models.Product, error) {
+// Create creates a new product, which the database records as its first
+// revision by its creator. A duplicate SKU fails with ErrConflict.
+func (r *ProductRepository) Create(ctx context.Context, product models.Product) (*models.Product, error) {
 	var result []models.Product
-	err := r.db.ServiceClient.DB.From("products").Insert(product).Execute(&result)
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("products").Insert(product).ExecuteWithContext(callCtx, &result)
+	metrics.ObserveSupabaseCall(productMetricsLabel, "Create", start, err)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create product: %w", err)
+		return nil, fmt.Errorf("failed to create product: %w", constraintError(err))
 	}
 
 	if len(result) == 0 {
@@ -34,107 +49,553 @@ func (r *ProductRepository) Create(product models.Product) (*models.Product, err
 	return &result[0], nil
 }
 
-// GetByID retrieves a product by ID
-func (r *ProductRepository) GetByID(id string) (*models.Product, error) {
+// CreateMany creates several products in one insert, which either creates
+// all of them or none, each with its first revision. A duplicate SKU fails
+// with ErrConflict.
+func (r *ProductRepository) CreateMany(ctx context.Context, products []models.Product) ([]models.Product, error) {
+	rows, err := uniformRows(products)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode products: %w", err)
+	}
+
+	var result []models.Product
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err = r.db.ServiceClient.DB.From("products").Insert(rows).ExecuteWithContext(callCtx, &result)
+	metrics.ObserveSupabaseCall(productMetricsLabel, "CreateMany", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create products: %w", constraintError(err))
+	}
+
+	return result, nil
+}
+
+// ListBySKUs retrieves the products with any of the given SKUs, including
+// products in the trash
+func (r *ProductRepository) ListBySKUs(ctx context.Context, skus []string) ([]models.Product, error) {
 	var products []models.Product
-	err := r.db.ServiceClient.DB.From("products").Select("*").Eq("id", id).Execute(&products)
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("products").Select("*").In("sku", skus).ExecuteWithContext(callCtx, &products)
+	metrics.ObserveSupabaseCall(productMetricsLabel, "ListBySKUs", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get products by sku: %w", err)
+	}
+
+	return products, nil
+}
+
+// ListByIDs retrieves the products with any of the given IDs, leaving out
+// products in the trash
+func (r *ProductRepository) ListByIDs(ctx context.Context, ids []string) ([]models.Product, error) {
+	var products []models.Product
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("products").Select("*").In("id", ids).IsNull("deleted_at").ExecuteWithContext(callCtx, &products)
+	metrics.ObserveSupabaseCall(productMetricsLabel, "ListByIDs", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get products: %w", err)
+	}
+
+	return products, nil
+}
+
+// BatchWrite applies prepared creates, updates and deletes in one
+// transaction, recording a revision for each create and update, and returns
+// the written products in the order of the writes. Deletes move products to
+// the trash. If any write fails, none are applied and a *BatchError names
+// the failed write.
+func (r *ProductRepository) BatchWrite(ctx context.Context, writes []models.ProductBatchWrite, userID string) ([]models.Product, error) {
+	var products []models.Product
+	params := map[string]interface{}{
+		"p_writes":  writes,
+		"p_user_id": userID,
+	}
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.Rpc("batch_write_products", params).ExecuteWithContext(callCtx, &products)
+	metrics.ObserveSupabaseCall(productMetricsLabel, "BatchWrite", start, err)
+	if err != nil {
+		// The function reports the index of the failed write as the detail
+		var reqErr *postgrest.RequestError
+		if errors.As(err, &reqErr) {
+			if index, convErr := strconv.Atoi(reqErr.Details); convErr == nil && index >= 0 && index < len(writes) {
+				return nil, &BatchError{Index: index, Err: constraintError(err)}
+			}
+		}
+		return nil, fmt.Errorf("failed to write product batch: %w", constraintError(err))
+	}
+
+	return products, nil
+}
+
+// GetByID retrieves a product by ID. Products in the trash are not found.
+func (r *ProductRepository) GetByID(ctx context.Context, id string) (*models.Product, error) {
+	var products []models.Product
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("products").Select("*").Eq("id", id).IsNull("deleted_at").ExecuteWithContext(callCtx, &products)
+	metrics.ObserveSupabaseCall(productMetricsLabel, "GetByID", start, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get product: %w", err)
 	}
 
 	if len(products) == 0 {
-		return nil, fmt.Errorf("product not found")
+		return nil, fmt.Errorf("product %w", ErrNotFound)
+	}
+
+	return &products[0], nil
+}
+
+// GetTrashedByID retrieves a product in the trash by ID
+func (r *ProductRepository) GetTrashedByID(ctx context.Context, id string) (*models.Product, error) {
+	var products []models.Product
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("products").Select("*").Eq("id", id).Not().IsNull("deleted_at").ExecuteWithContext(callCtx, &products)
+	metrics.ObserveSupabaseCall(productMetricsLabel, "GetTrashedByID", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trashed product: %w", err)
+	}
+
+	if len(products) == 0 {
+		return nil, fmt.Errorf("trashed product %w", ErrNotFound)
 	}
 
 	return &products[0], nil
 }
 
-// Update updates a product
-func (r *ProductRepository) Update(id string, product models.UpdateProductRequest) (*models.Product, error) {
+// productEdit is an update of the editable fields of a product by a user
+type productEdit struct {
+	models.UpdateProductRequest
+	EditedBy string `json:"edited_by"`
+}
+
+// Update updates the editable fields of a product on behalf of userID, which
+// the database records as a new revision together with the update. If
+// expectedUpdatedAt is set the update only applies while the product is
+// still at that version, otherwise ErrPreconditionFailed is returned.
+func (r *ProductRepository) Update(ctx context.Context, id string, product models.UpdateProductRequest, expectedUpdatedAt *time.Time, userID string) (*models.Product, error) {
 	var result []models.Product
-	err := r.db.ServiceClient.DB.From("products").Update(product).Eq("id", id).Execute(&result)
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	query := r.db.ServiceClient.DB.From("products").
+		Update(productEdit{UpdateProductRequest: product, EditedBy: userID}).
+		Eq("id", id).
+		IsNull("deleted_at")
+	if expectedUpdatedAt != nil {
+		query = query.Eq("updated_at", formatTimestamp(*expectedUpdatedAt))
+	}
+	start := time.Now()
+	err := query.ExecuteWithContext(callCtx, &result)
+	metrics.ObserveSupabaseCall(productMetricsLabel, "Update", start, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update product: %w", err)
 	}
 
 	if len(result) == 0 {
-		return nil, fmt.Errorf("product not found")
+		if expectedUpdatedAt != nil {
+			return nil, r.preconditionError(ctx, id)
+		}
+		return nil, fmt.Errorf("product %w", ErrNotFound)
 	}
 
 	return &result[0], nil
 }
 
-// Delete deletes a product
-func (r *ProductRepository) Delete(id string) error {
-	err := r.db.ServiceClient.DB.From("products").Delete().Eq("id", id).Execute(nil)
+// Touch bumps the update time of a product, giving it a new version after
+// changes to related records such as its images
+func (r *ProductRepository) Touch(ctx context.Context, id string) error {
+	var result []models.Product
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("products").
+		Update(map[string]string{"updated_at": formatTimestamp(time.Now())}).
+		Eq("id", id).
+		IsNull("deleted_at").
+		ExecuteWithContext(callCtx, &result)
+	metrics.ObserveSupabaseCall(productMetricsLabel, "Touch", start, err)
 	if err != nil {
-		return fmt.Errorf("failed to delete product: %w", err)
+		return fmt.Errorf("failed to touch product: %w", err)
+	}
+
+	if len(result) == 0 {
+		return fmt.Errorf("product %w", ErrNotFound)
 	}
 
 	return nil
 }
 
-// List lists all products with pagination and optional filtering
-func (r *ProductRepository) List(page, pageSize int, category string) ([]models.Product, error) {
-	var products []models.Product
-	
-	// Calculate offset
-	offset := (page - 1) * pageSize
-	limit := pageSize
-	
-	// Build query
-	query := r.db.ServiceClient.DB.From("products").Select("*")
-	
-	// Add category filter if provided
-	if category != "" {
-		// Need to handle the filter differently
-		filterQuery := query.Eq("category", category)
-		err := filterQuery.Execute(&products)
-		if err != nil {
-			return nil, fmt.Errorf("failed to filter products: %w", err)
+// Trash moves a product to the trash. If expectedUpdatedAt is set the
+// product is only trashed while it is still at that version, otherwise
+// ErrPreconditionFailed is returned.
+func (r *ProductRepository) Trash(ctx context.Context, id string, expectedUpdatedAt *time.Time) error {
+	var result []models.Product
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	query := r.db.ServiceClient.DB.From("products").
+		Update(map[string]string{"deleted_at": formatTimestamp(time.Now())}).
+		Eq("id", id).
+		IsNull("deleted_at")
+	if expectedUpdatedAt != nil {
+		query = query.Eq("updated_at", formatTimestamp(*expectedUpdatedAt))
+	}
+	start := time.Now()
+	err := query.ExecuteWithContext(callCtx, &result)
+	metrics.ObserveSupabaseCall(productMetricsLabel, "Trash", start, err)
+	if err != nil {
+		return fmt.Errorf("failed to trash product: %w", err)
+	}
+
+	if len(result) == 0 {
+		if expectedUpdatedAt != nil {
+			return r.preconditionError(ctx, id)
 		}
-	} else {
-		// If no filter, just execute the base query with limit
-		query = query.Limit(limit)
-		err := query.Execute(&products)
-		if err != nil {
-			return nil, fmt.Errorf("failed to list products: %w", err)
+		return fmt.Errorf("product %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// Restore takes a product out of the trash
+func (r *ProductRepository) Restore(ctx context.Context, id string) (*models.Product, error) {
+	var result []models.Product
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("products").
+		Update(map[string]interface{}{"deleted_at": nil}).
+		Eq("id", id).
+		Not().IsNull("deleted_at").
+		ExecuteWithContext(callCtx, &result)
+	metrics.ObserveSupabaseCall(productMetricsLabel, "Restore", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore product: %w", err)
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("trashed product %w", ErrNotFound)
+	}
+
+	return &result[0], nil
+}
+
+// ListTrash lists a page of the trashed products created by a user, most
+// recently trashed first
+func (r *ProductRepository) ListTrash(ctx context.Context, userID string, page, pageSize int) ([]models.Product, error) {
+	var products []models.Product
+	query := r.db.ServiceClient.DB.From("products").
+		Select("*").
+		OrderBy("deleted_at", "desc").
+		LimitWithOffset(pageSize, (page-1)*pageSize)
+	query.Eq("created_by", userID).Not().IsNull("deleted_at")
+
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := query.ExecuteWithContext(callCtx, &products)
+	metrics.ObserveSupabaseCall(productMetricsLabel, "ListTrash", start, err)
+	if isRangeNotSatisfiable(err) {
+		return []models.Product{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trashed products: %w", err)
+	}
+
+	return products, nil
+}
+
+// ListTrashedBefore lists up to limit products that were trashed before a
+// time, longest trashed first
+func (r *ProductRepository) ListTrashedBefore(ctx context.Context, before time.Time, limit int) ([]models.Product, error) {
+	var products []models.Product
+	query := r.db.ServiceClient.DB.From("products").
+		Select("*").
+		OrderBy("deleted_at", "asc").
+		Limit(limit)
+	query.Lt("deleted_at", formatTimestamp(before))
+
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := query.ExecuteWithContext(callCtx, &products)
+	metrics.ObserveSupabaseCall(productMetricsLabel, "ListTrashedBefore", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trashed products: %w", err)
+	}
+
+	return products, nil
+}
+
+// Purge permanently deletes a product that was trashed before a time, along
+// with its images, variants and stock movements. A product restored in the
+// meantime is left alone.
+func (r *ProductRepository) Purge(ctx context.Context, id string, trashedBefore time.Time) error {
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("products").
+		Delete().
+		Eq("id", id).
+		Lt("deleted_at", formatTimestamp(trashedBefore)).
+		ExecuteWithContext(callCtx, nil)
+	metrics.ObserveSupabaseCall(productMetricsLabel, "Purge", start, err)
+	if err != nil {
+		return fmt.Errorf("failed to purge product: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateStatus changes the status and publishing schedule of a product while
+// it is still at the version expectedUpdatedAt, otherwise
+// ErrPreconditionFailed is returned
+func (r *ProductRepository) UpdateStatus(ctx context.Context, id string, req models.UpdateProductStatusRequest, expectedUpdatedAt time.Time) (*models.Product, error) {
+	var result []models.Product
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("products").
+		Update(req).
+		Eq("id", id).
+		IsNull("deleted_at").
+		Eq("updated_at", formatTimestamp(expectedUpdatedAt)).
+		ExecuteWithContext(callCtx, &result)
+	metrics.ObserveSupabaseCall(productMetricsLabel, "UpdateStatus", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update product status: %w", err)
+	}
+
+	if len(result) == 0 {
+		return nil, r.preconditionError(ctx, id)
+	}
+
+	return &result[0], nil
+}
+
+// PublishDue publishes the drafts whose publish time has come and returns
+// them
+func (r *ProductRepository) PublishDue(ctx context.Context, now time.Time) ([]models.Product, error) {
+	var result []models.Product
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("products").
+		Update(map[string]interface{}{"status": models.ProductStatusPublished, "publish_at": nil}).
+		Eq("status", string(models.ProductStatusDraft)).
+		Lte("publish_at", formatTimestamp(now)).
+		IsNull("deleted_at").
+		ExecuteWithContext(callCtx, &result)
+	metrics.ObserveSupabaseCall(productMetricsLabel, "PublishDue", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to publish scheduled products: %w", err)
+	}
+
+	return result, nil
+}
+
+// UnpublishDue moves the published products whose unpublish time has come
+// back to draft and returns them
+func (r *ProductRepository) UnpublishDue(ctx context.Context, now time.Time) ([]models.Product, error) {
+	var result []models.Product
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("products").
+		Update(map[string]interface{}{"status": models.ProductStatusDraft, "unpublish_at": nil}).
+		Eq("status", string(models.ProductStatusPublished)).
+		Lte("unpublish_at", formatTimestamp(now)).
+		IsNull("deleted_at").
+		ExecuteWithContext(callCtx, &result)
+	metrics.ObserveSupabaseCall(productMetricsLabel, "UnpublishDue", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpublish scheduled products: %w", err)
+	}
+
+	return result, nil
+}
+
+// preconditionError tells apart a conditional write that missed because the
+// product changed from one that missed because it no longer exists
+func (r *ProductRepository) preconditionError(ctx context.Context, id string) error {
+	if _, err := r.GetByID(ctx, id); err != nil {
+		return err
+	}
+	return fmt.Errorf("product %w", ErrPreconditionFailed)
+}
+
+// List lists a page of the products matching filter, newest first
+func (r *ProductRepository) List(ctx context.Context, page, pageSize int, filter models.ProductFilter) ([]models.Product, error) {
+	var products []models.Product
+	query := r.db.ServiceClient.DB.From("products").
+		Select("*").
+		OrderBy("created_at", "desc").
+		LimitWithOffset(pageSize, (page-1)*pageSize)
+	applyProductFilter(&query.FilterRequestBuilder, filter)
+
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := query.ExecuteWithContext(callCtx, &products)
+	metrics.ObserveSupabaseCall(productMetricsLabel, "List", start, err)
+	if isRangeNotSatisfiable(err) {
+		return []models.Product{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list products: %w", err)
+	}
+
+	return products, nil
+}
+
+// ListAfter lists up to limit products matching filter in ID order, starting
+// after the product with ID afterID, or from the first product when afterID
+// is empty. Unlike page offsets, this keeps walking a listing consistent
+// while products are added or removed.
+func (r *ProductRepository) ListAfter(ctx context.Context, afterID string, limit int, filter models.ProductFilter) ([]models.Product, error) {
+	var products []models.Product
+	query := r.db.ServiceClient.DB.From("products").
+		Select("*").
+		OrderBy("id", "asc").
+		Limit(limit)
+	applyProductFilter(&query.FilterRequestBuilder, filter)
+	if afterID != "" {
+		query.Gt("id", afterID)
+	}
+
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := query.ExecuteWithContext(callCtx, &products)
+	metrics.ObserveSupabaseCall(productMetricsLabel, "ListAfter", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list products: %w", err)
+	}
+
+	return products, nil
+}
+
+// FacetCounts counts the products matching filter per category, tag and
+// price range. Prices are converted with rates, the factors into the listing
+// currency keyed by currency code, and rounded to exponent decimal places
+// before they are put into the ranges delimited by bounds.
+func (r *ProductRepository) FacetCounts(ctx context.Context, filter models.ProductFilter, rates map[string]decimal.Decimal, exponent int32, bounds []decimal.Decimal) (*models.ProductFacetCounts, error) {
+	params := map[string]interface{}{
+		"p_category_ids":   nil,
+		"p_tags":           nil,
+		"p_match_all_tags": filter.MatchAllTags,
+		"p_in_stock":       filter.InStock,
+		"p_status":         nil,
+		"p_created_by":     nil,
+		"p_rates":          rates,
+		"p_exponent":       exponent,
+		"p_bounds":         bounds,
+	}
+	if len(filter.CategoryIDs) > 0 {
+		params["p_category_ids"] = filter.CategoryIDs
+	}
+	if len(filter.Tags) > 0 {
+		params["p_tags"] = filter.Tags
+	}
+	if filter.Status != "" {
+		params["p_status"] = filter.Status
+	}
+	if filter.CreatedBy != "" {
+		params["p_created_by"] = filter.CreatedBy
+	}
+
+	var counts models.ProductFacetCounts
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.Rpc("product_facet_counts", params).ExecuteWithContext(callCtx, &counts)
+	metrics.ObserveSupabaseCall(productMetricsLabel, "FacetCounts", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count product facets: %w", err)
+	}
+
+	return &counts, nil
+}
+
+// Search returns a page of the products matching a full-text search, most
+// relevant first. Names within minSimilarity trigram word similarity of the
+// query match even when misspelled.
+func (r *ProductRepository) Search(ctx context.Context, query string, minSimilarity float64, page, pageSize int) ([]models.ProductSearchResult, error) {
+	var results []models.ProductSearchResult
+	params := map[string]interface{}{
+		"search_query":   query,
+		"min_similarity": minSimilarity,
+		"result_limit":   pageSize,
+		"result_offset":  (page - 1) * pageSize,
+	}
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.Rpc("search_products", params).ExecuteWithContext(callCtx, &results)
+	metrics.ObserveSupabaseCall(productMetricsLabel, "Search", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search products: %w", err)
+	}
+
+	return results, nil
+}
+
+// applyProductFilter adds the conditions of filter to a products query.
+// Products in the trash never match.
+func applyProductFilter(query *postgrest.FilterRequestBuilder, filter models.ProductFilter) {
+	query.IsNull("deleted_at")
+	if len(filter.CategoryIDs) > 0 {
+		query.In("category_id", filter.CategoryIDs)
+	}
+	if len(filter.Tags) > 0 {
+		if filter.MatchAllTags {
+			query.Cs("tags", filter.Tags)
+		} else {
+			query.Ov("tags", filter.Tags)
 		}
 	}
-	
-	// Apply offset and limit manually
-	if len(products) > offset {
-		end := offset + limit
-		if end > len(products) {
-			end = len(products)
+	if filter.Status != "" {
+		query.Eq("status", string(filter.Status))
+	}
+	if filter.CreatedBy != "" {
+		query.Eq("created_by", filter.CreatedBy)
+	}
+	if filter.InStock != nil {
+		if *filter.InStock {
+			query.Gt("available_quantity", "0")
+		} else {
+			query.Lte("available_quantity", "0")
 		}
-		products = products[offset:end]
-	} else {
-		products = []models.Product{}
-	}
-	
-	// Sort manually by created_at in descending order
-	// Note: In a real application, you might want to use a proper sorting function
-	
-	return products, nil
+	}
 }
 
 // GetProductWithUser retrieves a product with its creator's information
-func (r *ProductRepository) GetProductWithUser(id string) (*models.ProductResponse, error) {
+func (r *ProductRepository) GetProductWithUser(ctx context.Context, id string) (*models.ProductResponse, error) {
 	// First get the product
-	product, err := r.GetByID(id)
+	product, err := r.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
-	
+
 	// Then get the user who created it
 	var users []models.User
-	err = r.db.ServiceClient.DB.From("users").Select("*").Eq("id", product.CreatedBy).Execute(&users)
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err = r.db.ServiceClient.DB.From("users").Select("*").Eq("id", product.CreatedBy).ExecuteWithContext(callCtx, &users)
+	metrics.ObserveSupabaseCall(productMetricsLabel, "GetProductWithUser", start, err)
 	if err != nil || len(users) == 0 {
 		// If we can't get the user, just return the product without user info
 		return &models.ProductResponse{Product: *product}, nil
 	}
-	
+
 	// Return both
 	return &models.ProductResponse{
 		Product:       *product,
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/peterlimg/supabase-e/internal/models"
+	"github.com/peterlimg/supabase-e/pkg/database"
+	"github.com/peterlimg/supabase-e/pkg/metrics"
+)
+
+// productRevisionMetricsLabel identifies the product revision repository in
+// Supabase call metrics
+const productRevisionMetricsLabel = "product_revision"
+
+// ProductRevisionRepository handles the revision history of products
+type ProductRevisionRepository struct {
+	db *database.Client
+}
+
+// NewProductRevisionRepository creates a new product revision repository
+func NewProductRevisionRepository(db *database.Client) *ProductRevisionRepository {
+	return &ProductRevisionRepository{
+		db: db,
+	}
+}
+
+// ListByProduct lists the revisions of a product newest first, from offset
+// on and up to limit of them
+func (r *ProductRevisionRepository) ListByProduct(ctx context.Context, productID string, offset, limit int) ([]models.ProductRevision, error) {
+	var revisions []models.ProductRevision
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("product_revisions").Select("*").
+		OrderBy("revision", "desc").
+		LimitWithOffset(limit, offset).
+		Eq("product_id", productID).
+		ExecuteWithContext(callCtx, &revisions)
+	metrics.ObserveSupabaseCall(productRevisionMetricsLabel, "ListByProduct", start, err)
+	if isRangeNotSatisfiable(err) {
+		return []models.ProductRevision{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list product revisions: %w", err)
+	}
+
+	return revisions, nil
+}
+
+// GetByNumber retrieves a revision of a product by its number
+func (r *ProductRevisionRepository) GetByNumber(ctx context.Context, productID string, revision int) (*models.ProductRevision, error) {
+	var revisions []models.ProductRevision
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("product_revisions").Select("*").
+		Eq("product_id", productID).
+		Eq("revision", strconv.Itoa(revision)).
+		ExecuteWithContext(callCtx, &revisions)
+	metrics.ObserveSupabaseCall(productRevisionMetricsLabel, "GetByNumber", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product revision: %w", err)
+	}
+
+	if len(revisions) == 0 {
+		return nil, fmt.Errorf("product revision %w", ErrNotFound)
+	}
+
+	return &revisions[0], nil
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/peterlimg/supabase-e/internal/models"
+	"github.com/peterlimg/supabase-e/pkg/database"
+	"github.com/peterlimg/supabase-e/pkg/metrics"
+)
+
+// productVariantMetricsLabel identifies the product variant repository in
+// Supabase call metrics
+const productVariantMetricsLabel = "product_variant"
+
+// ProductVariantRepository handles product variant data operations
+type ProductVariantRepository struct {
+	db *database.Client
+}
+
+// NewProductVariantRepository creates a new product variant repository
+func NewProductVariantRepository(db *database.Client) *ProductVariantRepository {
+	return &ProductVariantRepository{
+		db: db,
+	}
+}
+
+// Create creates a new variant. A duplicate SKU or option combination fails
+// with ErrConflict.
+func (r *ProductVariantRepository) Create(ctx context.Context, variant models.ProductVariant) (*models.ProductVariant, error) {
+	var result []models.ProductVariant
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("product_variants").Insert(variant).ExecuteWithContext(callCtx, &result)
+	metrics.ObserveSupabaseCall(productVariantMetricsLabel, "Create", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create product variant: %w", constraintError(err))
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no product variant returned after insert")
+	}
+
+	return &result[0], nil
+}
+
+// ListByProduct lists the variants of a product in creation order
+func (r *ProductVariantRepository) ListByProduct(ctx context.Context, productID string) ([]models.ProductVariant, error) {
+	var variants []models.ProductVariant
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("product_variants").Select("*").
+		OrderBy("created_at", "asc").
+		Eq("product_id", productID).
+		ExecuteWithContext(callCtx, &variants)
+	metrics.ObserveSupabaseCall(productVariantMetricsLabel, "ListByProduct", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list product variants: %w", err)
+	}
+
+	return variants, nil
+}
+
+// GetByID retrieves a variant of a product by ID
+func (r *ProductVariantRepository) GetByID(ctx context.Context, productID, id string) (*models.ProductVariant, error) {
+	var variants []models.ProductVariant
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("product_variants").Select("*").
+		Eq("id", id).
+		Eq("product_id", productID).
+		ExecuteWithContext(callCtx, &variants)
+	metrics.ObserveSupabaseCall(productVariantMetricsLabel, "GetByID", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product variant: %w", err)
+	}
+
+	if len(variants) == 0 {
+		return nil, fmt.Errorf("product variant %w", ErrNotFound)
+	}
+
+	return &variants[0], nil
+}
+
+// Update updates a variant. A duplicate SKU or option combination fails with
+// ErrConflict.
+func (r *ProductVariantRepository) Update(ctx context.Context, id string, req models.UpdateVariantRequest) (*models.ProductVariant, error) {
+	var result []models.ProductVariant
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("product_variants").Update(req).Eq("id", id).ExecuteWithContext(callCtx, &result)
+	metrics.ObserveSupabaseCall(productVariantMetricsLabel, "Update", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update product variant: %w", constraintError(err))
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("product variant %w", ErrNotFound)
+	}
+
+	return &result[0], nil
+}
+
+// Delete deletes a variant. A variant with stock on hand or reserved fails
+// with ErrConflict.
+func (r *ProductVariantRepository) Delete(ctx context.Context, id string) error {
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("product_variants").Delete().Eq("id", id).ExecuteWithContext(callCtx, nil)
+	metrics.ObserveSupabaseCall(productVariantMetricsLabel, "Delete", start, err)
+	if err != nil {
+		return fmt.Errorf("failed to delete product variant: %w", constraintError(err))
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// formatTimestamp formats a timestamp for equality filters. UTC avoids a "+"
+// offset, which the PostgREST client would send unescaped.
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// uniformRows encodes records for a bulk insert. PostgREST requires every
+// object of a bulk insert to have the same keys, so keys that some records
+// omit are set to null on them.
+func uniformRows[T any](records []T) ([]map[string]interface{}, error) {
+	rows := make([]map[string]interface{}, 0, len(records))
+	keys := map[string]bool{}
+	for _, record := range records {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+		var row map[string]interface{}
+		if err := json.Unmarshal(data, &row); err != nil {
+			return nil, err
+		}
+		for key := range row {
+			keys[key] = true
+		}
+		rows = append(rows, row)
+	}
+
+	for _, row := range rows {
+		for key := range keys {
+			if _, ok := row[key]; !ok {
+				row[key] = nil
+			}
+		}
+	}
+	return rows, nil
+}
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/peterlimg/supabase-e/internal/models"
+	"github.com/peterlimg/supabase-e/pkg/database"
+	"github.com/peterlimg/supabase-e/pkg/metrics"
+)
+
+// stockMetricsLabel identifies the stock repository in Supabase call metrics
+const stockMetricsLabel = "stock"
+
+// StockRepository handles product stock levels and the stock movement ledger
+type StockRepository struct {
+	db *database.Client
+}
+
+// NewStockRepository creates a new stock repository
+func NewStockRepository(db *database.Client) *StockRepository {
+	return &StockRepository{
+		db: db,
+	}
+}
+
+// Adjust atomically changes the stock of a product, or of one of its variants
+// if variantID is set, and records the movement in the ledger. A variant's
+// change also applies to the totals of its product. A change that would leave
+// the stock negative or below the reserved quantity fails with ErrConflict and
+// changes nothing.
+func (r *StockRepository) Adjust(ctx context.Context, productID, variantID string, req models.AdjustStockRequest, userID string) (*models.StockMovement, error) {
+	var movement models.StockMovement
+	var variant interface{}
+	if variantID != "" {
+		variant = variantID
+	}
+	params := map[string]interface{}{
+		"p_product_id":      productID,
+		"p_variant_id":      variant,
+		"p_quantity_change": req.QuantityChange,
+		"p_reserved_change": req.ReservedChange,
+		"p_reason":          req.Reason,
+		"p_note":            req.Note,
+		"p_created_by":      userID,
+	}
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.Rpc("adjust_stock", params).ExecuteWithContext(callCtx, &movement)
+	metrics.ObserveSupabaseCall(stockMetricsLabel, "Adjust", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to adjust stock: %w", constraintError(err))
+	}
+
+	return &movement, nil
+}
+
+// ListMovements lists a page of the stock movements of a product, newest
+// first
+func (r *StockRepository) ListMovements(ctx context.Context, productID string, page, pageSize int) ([]models.StockMovement, error) {
+	var movements []models.StockMovement
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("stock_movements").Select("*").
+		OrderBy("created_at", "desc").
+		LimitWithOffset(pageSize, (page-1)*pageSize).
+		Eq("product_id", productID).
+		ExecuteWithContext(callCtx, &movements)
+	metrics.ObserveSupabaseCall(stockMetricsLabel, "ListMovements", start, err)
+	if isRangeNotSatisfiable(err) {
+		return []models.StockMovement{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stock movements: %w", err)
+	}
+
+	return movements, nil
+}
+
+// SetLowStockThreshold sets the available quantity at which the stock of a
+// product counts as low
+func (r *StockRepository) SetLowStockThreshold(ctx context.Context, productID string, threshold int) (*models.Product, error) {
+	var result []models.Product
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("products").
+		Update(map[string]int{"low_stock_threshold": threshold}).
+		Eq("id", productID).
+		ExecuteWithContext(callCtx, &result)
+	metrics.ObserveSupabaseCall(stockMetricsLabel, "SetLowStockThreshold", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set low stock threshold: %w", err)
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("product %w", ErrNotFound)
+	}
+
+	return &result[0], nil
+}
@@ -3,12 +3,17 @@ package repository
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/nedpals/supabase-go"
 	"github.com/peterlimg/supabase-e/internal/models"
 	"github.com/peterlimg/supabase-e/pkg/database"
+	"github.com/peterlimg/supabase-e/pkg/metrics"
 )
 
+// userMetricsLabel identifies the user repository in Supabase call metrics
+const userMetricsLabel = "user"
+
 // UserRepository handles user data operations
 type UserRepository struct {
 	db *database.Client
@@ -22,14 +27,18 @@ func NewUserRepository(db *database.Client) *UserRepository {
 }
 
 // Create creates a new user in Supabase Auth and database
-func (r *UserRepository) Create(user models.CreateUserRequest) (*models.User, error) {
+func (r *UserRepository) Create(ctx context.Context, user models.CreateUserRequest) (*models.User, error) {
 	// First, create the user in Supabase Auth
 	creds := supabase.UserCredentials{
 		Email:    user.Email,
 		Password: user.Password,
 	}
-	
-	authResp, err := r.db.ServiceClient.Auth.SignUp(context.Background(), creds)
+
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	authResp, err := r.db.ServiceClient.Auth.SignUp(callCtx, creds)
+	metrics.ObserveSupabaseCall(userMetricsLabel, "Create", start, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user in auth: %w", err)
 	}
@@ -40,7 +49,11 @@ func (r *UserRepository) Create(user models.CreateUserRequest) (*models.User, er
 
 	// Insert the user into the users table
 	var result []models.User
-	err = r.db.ServiceClient.DB.From("users").Insert(newUser).Execute(&result)
+	callCtx, cancel = r.db.WithTimeout(ctx)
+	defer cancel()
+	start = time.Now()
+	err = r.db.ServiceClient.DB.From("users").Insert(newUser).ExecuteWithContext(callCtx, &result)
+	metrics.ObserveSupabaseCall(userMetricsLabel, "Create", start, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user in database: %w", err)
 	}
@@ -53,54 +66,70 @@ func (r *UserRepository) Create(user models.CreateUserRequest) (*models.User, er
 }
 
 // GetByID retrieves a user by ID
-func (r *UserRepository) GetByID(id string) (*models.User, error) {
+func (r *UserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
 	var users []models.User
-	err := r.db.ServiceClient.DB.From("users").Select("*").Eq("id", id).Execute(&users)
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("users").Select("*").Eq("id", id).ExecuteWithContext(callCtx, &users)
+	metrics.ObserveSupabaseCall(userMetricsLabel, "GetByID", start, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
 	if len(users) == 0 {
-		return nil, fmt.Errorf("user not found")
+		return nil, fmt.Errorf("user %w", ErrNotFound)
 	}
 
 	return &users[0], nil
 }
 
 // GetByEmail retrieves a user by email
-func (r *UserRepository) GetByEmail(email string) (*models.User, error) {
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
 	var users []models.User
-	err := r.db.ServiceClient.DB.From("users").Select("*").Eq("email", email).Execute(&users)
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("users").Select("*").Eq("email", email).ExecuteWithContext(callCtx, &users)
+	metrics.ObserveSupabaseCall(userMetricsLabel, "GetByEmail", start, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user by email: %w", err)
 	}
 
 	if len(users) == 0 {
-		return nil, fmt.Errorf("user not found")
+		return nil, fmt.Errorf("user %w", ErrNotFound)
 	}
 
 	return &users[0], nil
 }
 
 // Update updates a user
-func (r *UserRepository) Update(id string, user models.UpdateUserRequest) (*models.User, error) {
+func (r *UserRepository) Update(ctx context.Context, id string, user models.UpdateUserRequest) (*models.User, error) {
 	var result []models.User
-	err := r.db.ServiceClient.DB.From("users").Update(user).Eq("id", id).Execute(&result)
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("users").Update(user).Eq("id", id).ExecuteWithContext(callCtx, &result)
+	metrics.ObserveSupabaseCall(userMetricsLabel, "Update", start, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update user: %w", err)
 	}
 
 	if len(result) == 0 {
-		return nil, fmt.Errorf("user not found")
+		return nil, fmt.Errorf("user %w", ErrNotFound)
 	}
 
 	return &result[0], nil
 }
 
 // Delete deletes a user
-func (r *UserRepository) Delete(id string) error {
+func (r *UserRepository) Delete(ctx context.Context, id string) error {
 	// Delete from the database
-	err := r.db.ServiceClient.DB.From("users").Delete().Eq("id", id).Execute(nil)
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := r.db.ServiceClient.DB.From("users").Delete().Eq("id", id).ExecuteWithContext(callCtx, nil)
+	metrics.ObserveSupabaseCall(userMetricsLabel, "Delete", start, err)
 	if err != nil {
 		return fmt.Errorf("failed to delete user from database: %w", err)
 	}
@@ -111,31 +140,35 @@ func (r *UserRepository) Delete(id string) error {
 }
 
 // List lists all users with pagination
-func (r *UserRepository) List(page, pageSize int) ([]models.User, error) {
+func (r *UserRepository) List(ctx context.Context, page, pageSize int) ([]models.User, error) {
 	var users []models.User
-	
+
 	// Calculate offset
 	offset := (page - 1) * pageSize
 	limit := pageSize
-	
+
 	// Use the pagination parameters
 	query := r.db.ServiceClient.DB.From("users").Select("*")
-	
+
 	// Add limit
 	query = query.Limit(limit)
-	
+
 	// Execute query
-	err := query.Execute(&users)
+	callCtx, cancel := r.db.WithTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err := query.ExecuteWithContext(callCtx, &users)
+	metrics.ObserveSupabaseCall(userMetricsLabel, "List", start, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list users: %w", err)
 	}
-	
+
 	// Apply offset manually if needed (for older versions of the client)
 	if len(users) > offset {
 		users = users[offset:]
 	} else {
 		users = []models.User{}
 	}
-	
+
 	return users, nil
 }
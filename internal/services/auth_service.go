@@ -2,36 +2,53 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"time"
 
-	"github.com/nedpals/supabase-go"
 	"github.com/peterlimg/supabase-e/config"
 	"github.com/peterlimg/supabase-e/internal/models"
 	"github.com/peterlimg/supabase-e/internal/repository"
 	"github.com/peterlimg/supabase-e/pkg/database"
+	"github.com/peterlimg/supabase-e/pkg/logger"
+	"github.com/peterlimg/supabase-e/pkg/mailer"
+	"github.com/peterlimg/supabase-e/pkg/metrics"
+	"github.com/peterlimg/supabase-e/pkg/tracing"
 	"github.com/peterlimg/supabase-e/pkg/utils"
 )
 
+// ErrInvalidCredentials is returned for every rejected login so that the
+// response does not reveal whether the email exists
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
 // AuthService handles authentication operations
 type AuthService struct {
 	userRepo *repository.UserRepository
 	db       *database.Client
+	mailer   mailer.Mailer
+	guard    *loginGuard
 	config   *config.Config
 }
 
 // NewAuthService creates a new auth service
-func NewAuthService(userRepo *repository.UserRepository, db *database.Client, config *config.Config) *AuthService {
+func NewAuthService(userRepo *repository.UserRepository, db *database.Client, mailer mailer.Mailer, config *config.Config) *AuthService {
 	return &AuthService{
 		userRepo: userRepo,
 		db:       db,
+		mailer:   mailer,
+		guard:    newLoginGuard(config),
 		config:   config,
 	}
 }
 
 // Register registers a new user
-func (s *AuthService) Register(req models.CreateUserRequest) (*models.User, error) {
+func (s *AuthService) Register(ctx context.Context, req models.CreateUserRequest) (_ *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "AuthService.Register")
+	defer func() { tracing.End(span, err) }()
+
 	// Create the user
-	user, err := s.userRepo.Create(req)
+	user, err := s.userRepo.Create(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to register user: %w", err)
 	}
@@ -39,31 +56,59 @@ func (s *AuthService) Register(req models.CreateUserRequest) (*models.User, erro
 	return user, nil
 }
 
-// Login authenticates a user and returns a JWT token
-func (s *AuthService) Login(req models.LoginRequest) (*models.LoginResponse, error) {
-	// Authenticate with Supabase Auth
-	creds := supabase.UserCredentials{
-		Email:    req.Email,
-		Password: req.Password,
+// Login authenticates a user and returns a JWT token. Repeated failures for
+// an account or client IP are throttled and eventually locked out.
+func (s *AuthService) Login(ctx context.Context, req models.LoginRequest, clientIP string) (_ *models.LoginResponse, err error) {
+	ctx, span := tracing.Start(ctx, "AuthService.Login")
+	defer func() { tracing.End(span, err) }()
+
+	// Reject attempts for throttled or locked accounts and IPs up front
+	if err := s.guard.Check(req.Email, clientIP); err != nil {
+		metrics.ObserveLogin(false)
+		return nil, err
 	}
 
-	authResp, err := s.db.Client.Auth.SignIn(context.Background(), creds)
+	// Authenticate with Supabase Auth
+	callCtx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+	authResp, err := s.db.SignIn(callCtx, req.Email, req.Password)
 	if err != nil {
-		return nil, fmt.Errorf("authentication failed: %w", err)
+		metrics.ObserveLogin(false)
+
+		// Only rejected credentials count towards a lockout. Transport
+		// failures and Auth outages say nothing about them, and neither do
+		// other rejections such as an unconfirmed email.
+		var authErr *database.AuthError
+		if !errors.As(err, &authErr) || authErr.StatusCode >= http.StatusInternalServerError || authErr.StatusCode == http.StatusTooManyRequests {
+			return nil, fmt.Errorf("authentication failed: %w", err)
+		}
+		if !authErr.InvalidCredentials() {
+			return nil, ErrInvalidCredentials
+		}
+
+		if s.guard.RecordFailure(req.Email, clientIP) {
+			s.notifyLockout(ctx, req.Email)
+		}
+		return nil, ErrInvalidCredentials
 	}
+	s.guard.RecordSuccess(req.Email)
 
 	// Get the user from the database
-	user, err := s.userRepo.GetByID(authResp.User.ID)
+	user, err := s.userRepo.GetByID(ctx, authResp.User.ID)
 	if err != nil {
+		metrics.ObserveLogin(false)
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
 	// Generate a JWT token
 	token, err := utils.GenerateJWT(user.ID, user.Email, user.Role, s.config.JWTSecret, s.config.JWTExpiry)
 	if err != nil {
+		metrics.ObserveLogin(false)
 		return nil, fmt.Errorf("failed to generate token: %w", err)
 	}
 
+	metrics.ObserveLogin(true)
+
 	// Return the user and token
 	return &models.LoginResponse{
 		User:  *user,
@@ -71,12 +116,73 @@ func (s *AuthService) Login(req models.LoginRequest) (*models.LoginResponse, err
 	}, nil
 }
 
+// UnlockAccount clears the failed login attempts and any lockout of the
+// account with the given email, reporting whether there was anything to clear
+func (s *AuthService) UnlockAccount(ctx context.Context, email string) bool {
+	_, span := tracing.Start(ctx, "AuthService.UnlockAccount")
+	defer span.End()
+
+	return s.guard.Unlock(email)
+}
+
+// notifyLockout emails the account owner about a lockout. Unknown emails are
+// skipped silently; the caller's response is the same either way.
+func (s *AuthService) notifyLockout(ctx context.Context, email string) {
+	log := logger.GetLogger("auth")
+
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			log.Error().Err(err).Msg("Failed to look up locked account")
+		}
+		return
+	}
+
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Your account has been temporarily locked",
+		Body: fmt.Sprintf(
+			"We detected several failed sign-in attempts on your account, so it has been locked for %s. "+
+				"If this was not you, consider changing your password.",
+			s.config.LoginLockoutDuration.Round(time.Minute),
+		),
+	}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		log.Error().Err(err).Str("user_id", user.ID).Msg("Failed to send lockout notification")
+	}
+}
+
 // GetUserByID gets a user by ID
-func (s *AuthService) GetUserByID(id string) (*models.User, error) {
-	return s.userRepo.GetByID(id)
+func (s *AuthService) GetUserByID(ctx context.Context, id string) (_ *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "AuthService.GetUserByID")
+	defer func() { tracing.End(span, err) }()
+
+	return s.userRepo.GetByID(ctx, id)
 }
 
 // UpdateUser updates a user
-func (s *AuthService) UpdateUser(id string, req models.UpdateUserRequest) (*models.User, error) {
-	return s.userRepo.Update(id, req)
+func (s *AuthService) UpdateUser(ctx context.Context, id string, req models.UpdateUserRequest) (_ *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "AuthService.UpdateUser")
+	defer func() { tracing.End(span, err) }()
+
+	return s.userRepo.Update(ctx, id, req)
+}
+
+// PatchUser applies a merge patch or JSON patch to a user. The patched user
+// is validated like a full update.
+func (s *AuthService) PatchUser(ctx context.Context, id string, patch utils.Patch) (_ *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "AuthService.PatchUser")
+	defer func() { tracing.End(span, err) }()
+
+	current, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var req models.UpdateUserRequest
+	if err := patch.ApplyTo(current.UpdateRequest(), &req); err != nil {
+		return nil, err
+	}
+
+	return s.userRepo.Update(ctx, id, req)
 }
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/peterlimg/supabase-e/internal/models"
+	"github.com/peterlimg/supabase-e/internal/repository"
+	"github.com/peterlimg/supabase-e/pkg/tracing"
+	"github.com/peterlimg/supabase-e/pkg/utils"
+)
+
+var (
+	// ErrCategoryInUse is returned when deleting a category that still has
+	// products or subcategories
+	ErrCategoryInUse = errors.New("category still has products or subcategories")
+
+	// ErrUnknownCategory is returned when a request references a category
+	// that does not exist
+	ErrUnknownCategory = errors.New("unknown category")
+)
+
+// CategoryService handles category operations
+type CategoryService struct {
+	categoryRepo *repository.CategoryRepository
+}
+
+// NewCategoryService creates a new category service
+func NewCategoryService(categoryRepo *repository.CategoryRepository) *CategoryService {
+	return &CategoryService{
+		categoryRepo: categoryRepo,
+	}
+}
+
+// ListCategories lists all categories with their product counts
+func (s *CategoryService) ListCategories(ctx context.Context) (_ []models.Category, err error) {
+	ctx, span := tracing.Start(ctx, "CategoryService.ListCategories")
+	defer func() { tracing.End(span, err) }()
+
+	categories, err := s.categoryRepo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := s.categoryRepo.ProductCounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	direct := make(map[string]int, len(counts))
+	for _, c := range counts {
+		direct[c.CategoryID] = c.ProductCount
+	}
+
+	children := childrenByParent(categories)
+	for i := range categories {
+		count := direct[categories[i].ID]
+		total := 0
+		for _, id := range subtree(categories[i].ID, children) {
+			total += direct[id]
+		}
+		categories[i].ProductCount = &count
+		categories[i].TotalProductCount = &total
+	}
+
+	return categories, nil
+}
+
+// GetCategory gets a category with its product counts by ID or slug
+func (s *CategoryService) GetCategory(ctx context.Context, ref string) (_ *models.Category, err error) {
+	ctx, span := tracing.Start(ctx, "CategoryService.GetCategory")
+	defer func() { tracing.End(span, err) }()
+
+	category, err := s.resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := s.ListCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range categories {
+		if categories[i].ID == category.ID {
+			return &categories[i], nil
+		}
+	}
+	return category, nil
+}
+
+// CreateCategory creates a new category
+func (s *CategoryService) CreateCategory(ctx context.Context, req models.CreateCategoryRequest) (_ *models.Category, err error) {
+	ctx, span := tracing.Start(ctx, "CategoryService.CreateCategory")
+	defer func() { tracing.End(span, err) }()
+
+	if req.Slug == "" {
+		req.Slug = utils.Slugify(req.Name)
+	}
+	if !utils.ValidSlug(req.Slug) {
+		return nil, fmt.Errorf("%w: invalid slug %q", utils.ErrValidation, req.Slug)
+	}
+	if req.ParentID != nil {
+		if err := s.CheckExists(ctx, *req.ParentID); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.categoryRepo.Create(ctx, models.NewCategory(req))
+}
+
+// UpdateCategory updates a category. A category cannot be moved below itself
+// or one of its subcategories.
+func (s *CategoryService) UpdateCategory(ctx context.Context, id string, req models.UpdateCategoryRequest) (_ *models.Category, err error) {
+	ctx, span := tracing.Start(ctx, "CategoryService.UpdateCategory")
+	defer func() { tracing.End(span, err) }()
+
+	if !utils.ValidSlug(req.Slug) {
+		return nil, fmt.Errorf("%w: invalid slug %q", utils.ErrValidation, req.Slug)
+	}
+
+	if _, err := s.categoryRepo.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+
+	if req.ParentID != nil {
+		if err := s.CheckExists(ctx, *req.ParentID); err != nil {
+			return nil, err
+		}
+
+		descendants, err := s.SubtreeIDs(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range descendants {
+			if d == *req.ParentID {
+				return nil, fmt.Errorf("%w: a category cannot be moved below itself", utils.ErrValidation)
+			}
+		}
+	}
+
+	return s.categoryRepo.Update(ctx, id, req)
+}
+
+// DeleteCategory deletes a category that has no products or subcategories
+func (s *CategoryService) DeleteCategory(ctx context.Context, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "CategoryService.DeleteCategory")
+	defer func() { tracing.End(span, err) }()
+
+	category, err := s.GetCategory(ctx, id)
+	if err != nil {
+		return err
+	}
+	if category.TotalProductCount != nil && *category.TotalProductCount > 0 {
+		return ErrCategoryInUse
+	}
+
+	err = s.categoryRepo.Delete(ctx, category.ID)
+	if errors.Is(err, repository.ErrConflict) {
+		return fmt.Errorf("%w: %v", ErrCategoryInUse, err)
+	}
+	return err
+}
+
+// CheckExists returns a validation error if no category has the given ID
+func (s *CategoryService) CheckExists(ctx context.Context, id string) error {
+	_, err := s.categoryRepo.GetByID(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("%w: %w %s", utils.ErrValidation, ErrUnknownCategory, id)
+	}
+	return err
+}
+
+// SubtreeIDs returns the IDs of a category, given by ID or slug, and of all
+// its subcategories
+func (s *CategoryService) SubtreeIDs(ctx context.Context, ref string) ([]string, error) {
+	category, err := s.resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := s.categoryRepo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return subtree(category.ID, childrenByParent(categories)), nil
+}
+
+// byID returns all categories indexed by their ID
+func (s *CategoryService) byID(ctx context.Context) (map[string]models.Category, error) {
+	categories, err := s.categoryRepo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[string]models.Category, len(categories))
+	for _, c := range categories {
+		index[c.ID] = c
+	}
+	return index, nil
+}
+
+// resolve looks a category up by ID or, failing that, by slug
+func (s *CategoryService) resolve(ctx context.Context, ref string) (*models.Category, error) {
+	if _, err := uuid.Parse(ref); err == nil {
+		return s.categoryRepo.GetByID(ctx, ref)
+	}
+	return s.categoryRepo.GetBySlug(ctx, ref)
+}
+
+// childrenByParent indexes the IDs of categories by their parent ID
+func childrenByParent(categories []models.Category) map[string][]string {
+	children := map[string][]string{}
+	for _, c := range categories {
+		if c.ParentID != nil {
+			children[*c.ParentID] = append(children[*c.ParentID], c.ID)
+		}
+	}
+	return children
+}
+
+// subtree returns id followed by the IDs of all its descendants
+func subtree(id string, children map[string][]string) []string {
+	ids := []string{id}
+	seen := map[string]bool{id: true}
+	for i := 0; i < len(ids); i++ {
+		for _, child := range children[ids[i]] {
+			if !seen[child] {
+				seen[child] = true
+				ids = append(ids, child)
+			}
+		}
+	}
+	return ids
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/peterlimg/supabase-e/config"
+)
+
+// LoginBlockedError is returned when a login attempt is rejected because of
+// previous failures, either by a progressive delay or by a lockout
+type LoginBlockedError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+// Error implements error
+func (e *LoginBlockedError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("too many failed login attempts, locked for %s", e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("too many failed login attempts, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+// attempts tracks consecutive failed logins for one account or IP
+type attempts struct {
+	failures    int
+	lastFailure time.Time
+	nextAllowed time.Time
+	lockedUntil time.Time
+}
+
+// loginGuard tracks failed logins per account and per IP, enforcing
+// progressive delays and temporary lockouts
+type loginGuard struct {
+	maxFailures   int
+	ipMaxFailures int
+	window        time.Duration
+	lockout       time.Duration
+	delayBase     time.Duration
+	delayMax      time.Duration
+
+	mu        sync.Mutex
+	accounts  map[string]*attempts
+	ips       map[string]*attempts
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// loginGuardSweepInterval controls how often expired entries are dropped
+const loginGuardSweepInterval = time.Minute
+
+// newLoginGuard creates a login guard from the configuration
+func newLoginGuard(cfg *config.Config) *loginGuard {
+	return &loginGuard{
+		maxFailures:   cfg.LoginMaxFailures,
+		ipMaxFailures: cfg.LoginIPMaxFailures,
+		window:        cfg.LoginFailureWindow,
+		lockout:       cfg.LoginLockoutDuration,
+		delayBase:     cfg.LoginDelayBase,
+		delayMax:      cfg.LoginDelayMax,
+		accounts:      map[string]*attempts{},
+		ips:           map[string]*attempts{},
+		lastSweep:     time.Now(),
+		now:           time.Now,
+	}
+}
+
+// normalizeEmail makes account keys case-insensitive
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Check returns a LoginBlockedError if the account or IP may not attempt a
+// login right now
+func (g *loginGuard) Check(email, ip string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	for _, a := range []*attempts{g.get(g.accounts, normalizeEmail(email), now), g.get(g.ips, ip, now)} {
+		if a == nil {
+			continue
+		}
+		if now.Before(a.lockedUntil) {
+			return &LoginBlockedError{RetryAfter: a.lockedUntil.Sub(now), Locked: true}
+		}
+		if now.Before(a.nextAllowed) {
+			return &LoginBlockedError{RetryAfter: a.nextAllowed.Sub(now)}
+		}
+	}
+	return nil
+}
+
+// RecordFailure records a failed login and reports whether it locked the
+// account
+func (g *loginGuard) RecordFailure(email, ip string) (locked bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	if now.Sub(g.lastSweep) > loginGuardSweepInterval {
+		for _, m := range []map[string]*attempts{g.accounts, g.ips} {
+			for key := range m {
+				g.get(m, key, now)
+			}
+		}
+		g.lastSweep = now
+	}
+
+	locked = g.fail(g.accounts, normalizeEmail(email), g.maxFailures, now)
+	g.fail(g.ips, ip, g.ipMaxFailures, now)
+	return locked
+}
+
+// RecordSuccess clears the failures of the account. The IP counter is kept so
+// that logging into one's own account does not reset an attack budget.
+func (g *loginGuard) RecordSuccess(email string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.accounts, normalizeEmail(email))
+}
+
+// Unlock clears the failures and lockout of the account
+func (g *loginGuard) Unlock(email string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	key := normalizeEmail(email)
+	_, ok := g.accounts[key]
+	delete(g.accounts, key)
+	return ok
+}
+
+// get returns the attempts for key, dropping them once the failure window
+// and any lockout have expired. Callers must hold g.mu.
+func (g *loginGuard) get(m map[string]*attempts, key string, now time.Time) *attempts {
+	a, ok := m[key]
+	if !ok {
+		return nil
+	}
+	if now.After(a.lockedUntil) && now.Sub(a.lastFailure) > g.window {
+		delete(m, key)
+		return nil
+	}
+	return a
+}
+
+// fail increments the failures for key, applying the progressive delay and
+// the lockout once max is reached. Callers must hold g.mu.
+func (g *loginGuard) fail(m map[string]*attempts, key string, max int, now time.Time) bool {
+	a := g.get(m, key, now)
+	if a == nil {
+		a = &attempts{}
+		m[key] = a
+	}
+
+	a.failures++
+	a.lastFailure = now
+
+	if max > 0 && a.failures >= max {
+		a.failures = 0
+		a.lockedUntil = now.Add(g.lockout)
+		return true
+	}
+
+	// Double the delay with every failure after the first
+	if a.failures > 1 && g.delayBase > 0 {
+		delay := g.delayBase << (a.failures - 2)
+		if delay <= 0 || delay > g.delayMax {
+			delay = g.delayMax
+		}
+		a.nextAllowed = now.Add(delay)
+	}
+	return false
+}
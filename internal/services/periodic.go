@@ -0,0 +1,26 @@
+package services
+
+import (
+	"context"
+	"time"
+)
+
+// runEvery calls run once per interval until ctx is cancelled. It returns
+// right away for a non-positive interval, which disables the job.
+func runEvery(ctx context.Context, interval time.Duration, run func(context.Context)) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			run(ctx)
+		}
+	}
+}
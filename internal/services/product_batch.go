@@ -0,0 +1,193 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/peterlimg/supabase-e/internal/models"
+	"github.com/peterlimg/supabase-e/internal/repository"
+	"github.com/peterlimg/supabase-e/pkg/tracing"
+	"github.com/peterlimg/supabase-e/pkg/utils"
+)
+
+// ErrBatchAborted is reported for the operations of an atomic batch that
+// were not applied because another operation of the batch failed
+var ErrBatchAborted = errors.New("not applied because another operation of the batch failed")
+
+// ErrIfMatchRequired is returned for batch updates and deletes without
+// if_match when If-Match is required
+var ErrIfMatchRequired = errors.New("if_match is required")
+
+// BatchProducts applies a batch of creates, updates and deletes on behalf of
+// userID, returning the outcome of each operation in order. Updates and
+// deletes only apply to the user's own products unless admin is set. Every
+// operation is validated before anything is written. An atomic batch is then
+// written in one transaction, and if any operation fails none are applied;
+// other batches apply each valid operation on its own.
+func (s *ProductService) BatchProducts(ctx context.Context, req models.ProductBatchRequest, userID string, admin bool) (_ []models.ProductBatchOutcome, err error) {
+	ctx, span := tracing.Start(ctx, "ProductService.BatchProducts")
+	defer func() { tracing.End(span, err) }()
+
+	if len(req.Operations) > s.config.BatchMaxOperations {
+		return nil, fmt.Errorf("%w: a batch may have at most %d operations", utils.ErrValidation, s.config.BatchMaxOperations)
+	}
+
+	writes, outcomes, err := s.prepareBatch(ctx, req.Operations, userID, admin)
+	if err != nil {
+		return nil, err
+	}
+
+	if !req.Atomic {
+		for i, write := range writes {
+			if outcomes[i].Err == nil {
+				outcomes[i].Product, outcomes[i].Err = s.applyWrite(ctx, write, userID)
+			}
+		}
+		return outcomes, nil
+	}
+
+	for _, outcome := range outcomes {
+		if outcome.Err != nil {
+			return abortBatch(outcomes), nil
+		}
+	}
+
+	products, err := s.productRepo.BatchWrite(ctx, writes, userID)
+	var batchErr *repository.BatchError
+	if errors.As(err, &batchErr) {
+		outcomes[batchErr.Index].Err = batchErr.Err
+		if writes[batchErr.Index].Op == models.ProductBatchCreate && errors.Is(batchErr.Err, repository.ErrConflict) {
+			outcomes[batchErr.Index].Err = fmt.Errorf("%w: %v", ErrDuplicateSKU, batchErr.Err)
+		}
+		return abortBatch(outcomes), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range products {
+		outcomes[i].Product = &products[i]
+	}
+	return outcomes, nil
+}
+
+// prepareBatch validates the operations of a batch and turns them into
+// writes. The outcome of an operation that cannot be written holds the
+// reason.
+func (s *ProductService) prepareBatch(ctx context.Context, ops []models.ProductBatchOperation, userID string, admin bool) ([]models.ProductBatchWrite, []models.ProductBatchOutcome, error) {
+	// The products to update and delete are read in one go
+	var ids []string
+	for _, op := range ops {
+		if op.ID != "" {
+			ids = append(ids, op.ID)
+		}
+	}
+	current := map[string]models.Product{}
+	if len(ids) > 0 {
+		products, err := s.productRepo.ListByIDs(ctx, ids)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, product := range products {
+			current[product.ID] = product
+		}
+	}
+
+	categories, err := s.categories.byID(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	writes := make([]models.ProductBatchWrite, len(ops))
+	outcomes := make([]models.ProductBatchOutcome, len(ops))
+	seen := map[string]bool{}
+	for i, op := range ops {
+		writes[i], outcomes[i].Err = s.prepareOperation(ctx, op, current, categories, seen, userID, admin)
+	}
+	return writes, outcomes, nil
+}
+
+// prepareOperation validates one operation of a batch like the matching
+// single write, and checks that the user may change the product. Each
+// product may be updated or deleted only once per batch.
+func (s *ProductService) prepareOperation(ctx context.Context, op models.ProductBatchOperation, current map[string]models.Product, categories map[string]models.Category, seen map[string]bool, userID string, admin bool) (models.ProductBatchWrite, error) {
+	if op.Op == models.ProductBatchCreate {
+		var req models.CreateProductRequest
+		if err := json.Unmarshal(op.Product, &req); err != nil {
+			return models.ProductBatchWrite{}, fmt.Errorf("%w: %v", utils.ErrValidation, err)
+		}
+		if err := binding.Validator.ValidateStruct(&req); err != nil {
+			return models.ProductBatchWrite{}, fmt.Errorf("%w: %v", utils.ErrValidation, err)
+		}
+		if err := s.normalizeCreate(&req); err != nil {
+			return models.ProductBatchWrite{}, err
+		}
+		if _, ok := categories[req.CategoryID]; !ok {
+			return models.ProductBatchWrite{}, fmt.Errorf("%w: %w %s", utils.ErrValidation, ErrUnknownCategory, req.CategoryID)
+		}
+		product := models.NewProduct(req, userID)
+		return models.ProductBatchWrite{Op: op.Op, ID: product.ID, Product: product}, nil
+	}
+
+	if seen[op.ID] {
+		return models.ProductBatchWrite{}, fmt.Errorf("%w: product %s appears more than once in the batch", utils.ErrValidation, op.ID)
+	}
+	seen[op.ID] = true
+
+	if op.IfMatch == "" && s.config.RequireIfMatch {
+		return models.ProductBatchWrite{}, ErrIfMatchRequired
+	}
+
+	product, ok := current[op.ID]
+	if !ok {
+		return models.ProductBatchWrite{}, fmt.Errorf("product %w", repository.ErrNotFound)
+	}
+	if product.CreatedBy != userID && !admin {
+		return models.ProductBatchWrite{}, ErrNotProductOwner
+	}
+	if op.IfMatch != "" && !utils.MatchETag(op.IfMatch, product.ETag(), false) {
+		return models.ProductBatchWrite{}, fmt.Errorf("product %w", repository.ErrPreconditionFailed)
+	}
+
+	write := models.ProductBatchWrite{Op: op.Op, ID: op.ID, ExpectedUpdatedAt: &product.UpdatedAt}
+	if op.Op == models.ProductBatchDelete {
+		return write, nil
+	}
+
+	if len(op.Product) == 0 {
+		return models.ProductBatchWrite{}, fmt.Errorf("%w: product is required for updates", utils.ErrValidation)
+	}
+	req, err := s.applyPatch(ctx, product, utils.Patch{ContentType: utils.MergePatchContentType, Body: op.Product})
+	if err != nil {
+		return models.ProductBatchWrite{}, err
+	}
+	write.Product = req
+	return write, nil
+}
+
+// applyWrite applies one prepared write of a batch on its own
+func (s *ProductService) applyWrite(ctx context.Context, write models.ProductBatchWrite, userID string) (*models.Product, error) {
+	switch write.Op {
+	case models.ProductBatchCreate:
+		return s.create(ctx, write.Product.(models.Product))
+	case models.ProductBatchUpdate:
+		return s.update(ctx, write.ID, write.Product.(models.UpdateProductRequest), write.ExpectedUpdatedAt, userID)
+	default:
+		return nil, s.productRepo.Trash(ctx, write.ID, write.ExpectedUpdatedAt)
+	}
+}
+
+// abortBatch marks every operation of an atomic batch that did not fail
+// itself as aborted
+func abortBatch(outcomes []models.ProductBatchOutcome) []models.ProductBatchOutcome {
+	for i := range outcomes {
+		outcomes[i].Product = nil
+		if outcomes[i].Err == nil {
+			outcomes[i].Err = ErrBatchAborted
+		}
+	}
+	return outcomes
+}
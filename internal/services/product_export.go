@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/peterlimg/supabase-e/internal/models"
+	"github.com/peterlimg/supabase-e/internal/repository"
+	"github.com/peterlimg/supabase-e/pkg/tracing"
+)
+
+// ExportProducts walks every product matching the filters of a listing
+// query in ID order, pageSize at a time, and passes each page to write, so
+// that a whole catalog is never held in memory. The paging and currency of
+// the query are ignored. It stops at the first error returned by write.
+func (s *ProductService) ExportProducts(ctx context.Context, query models.ProductQuery, pageSize int, write func([]models.Product) error) (err error) {
+	ctx, span := tracing.Start(ctx, "ProductService.ExportProducts")
+	defer func() { tracing.End(span, err) }()
+
+	if pageSize < 1 {
+		pageSize = 1
+	}
+
+	filter, err := s.listFilter(ctx, query)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	afterID := ""
+	for {
+		products, err := s.productRepo.ListAfter(ctx, afterID, pageSize, filter)
+		if err != nil {
+			return err
+		}
+		if len(products) > 0 {
+			if err := write(products); err != nil {
+				return err
+			}
+		}
+		if len(products) < pageSize {
+			return nil
+		}
+		afterID = products[len(products)-1].ID
+	}
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"sort"
+
+	"github.com/peterlimg/supabase-e/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// emptyFacets returns the facets of a listing without products
+func emptyFacets() models.ProductFacets {
+	return models.ProductFacets{
+		Categories:  []models.CategoryFacet{},
+		Tags:        []models.TagFacet{},
+		PriceRanges: []models.PriceRangeFacet{},
+	}
+}
+
+// buildFacets turns the counts of a listing into its facets, naming the
+// categories and delimiting the price ranges in currency by bounds.
+// Categories and tags are ordered by descending count.
+func buildFacets(counts models.ProductFacetCounts, categories map[string]models.Category, bounds []decimal.Decimal, currency string) models.ProductFacets {
+	facets := emptyFacets()
+
+	for id, count := range counts.Categories {
+		category := categories[id]
+		facets.Categories = append(facets.Categories, models.CategoryFacet{
+			CategoryID: id,
+			Name:       category.Name,
+			Slug:       category.Slug,
+			Count:      count,
+		})
+	}
+	sort.Slice(facets.Categories, func(i, j int) bool {
+		a, b := facets.Categories[i], facets.Categories[j]
+		return a.Count > b.Count || (a.Count == b.Count && a.Name < b.Name)
+	})
+
+	for tag, count := range counts.Tags {
+		facets.Tags = append(facets.Tags, models.TagFacet{Tag: tag, Count: count})
+	}
+	sort.Slice(facets.Tags, func(i, j int) bool {
+		a, b := facets.Tags[i], facets.Tags[j]
+		return a.Count > b.Count || (a.Count == b.Count && a.Tag < b.Tag)
+	})
+
+	for i := 0; i <= len(bounds); i++ {
+		facet := models.PriceRangeFacet{Currency: currency, Count: counts.PriceRanges[i]}
+		if i > 0 {
+			facet.Min = &bounds[i-1]
+		}
+		if i < len(bounds) {
+			facet.Max = &bounds[i]
+		}
+		facets.PriceRanges = append(facets.PriceRanges, facet)
+	}
+
+	return facets
+}
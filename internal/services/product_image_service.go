@@ -0,0 +1,292 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/peterlimg/supabase-e/config"
+	"github.com/peterlimg/supabase-e/internal/models"
+	"github.com/peterlimg/supabase-e/internal/repository"
+	"github.com/peterlimg/supabase-e/pkg/database"
+	"github.com/peterlimg/supabase-e/pkg/imaging"
+	"github.com/peterlimg/supabase-e/pkg/logger"
+	"github.com/peterlimg/supabase-e/pkg/tracing"
+)
+
+var (
+	// ErrUnsupportedImageType is returned for uploads whose content is not a
+	// supported image format
+	ErrUnsupportedImageType = errors.New("unsupported image type")
+
+	// ErrImageTooLarge is returned for uploads above the configured size limit
+	ErrImageTooLarge = errors.New("image is too large")
+
+	// ErrTooManyImages is returned when a product already has the maximum
+	// number of images
+	ErrTooManyImages = errors.New("product has too many images")
+
+	// ErrInvalidImageOrder is returned when a reorder request does not list
+	// every image of the product exactly once
+	ErrInvalidImageOrder = errors.New("image order must list every image of the product exactly once")
+)
+
+// imageExtensions maps the supported sniffed image types to file extensions
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// ProductImageService handles product images kept in Supabase Storage
+type ProductImageService struct {
+	productRepo *repository.ProductRepository
+	imageRepo   *repository.ProductImageRepository
+	db          *database.Client
+	processor   *imaging.Processor
+	config      *config.Config
+}
+
+// NewProductImageService creates a new product image service
+func NewProductImageService(productRepo *repository.ProductRepository, imageRepo *repository.ProductImageRepository, db *database.Client, config *config.Config) *ProductImageService {
+	return &ProductImageService{
+		productRepo: productRepo,
+		imageRepo:   imageRepo,
+		db:          db,
+		processor:   imaging.NewProcessor(config.ImageVariantWidths, config.ImageMaxPixels),
+		config:      config,
+	}
+}
+
+// UploadImage stores an image and its resized variants and appends it to the
+// images of a product. The content type is sniffed from the data rather than
+// trusted from the client, and metadata such as EXIF is stripped. Only the
+// owner of the product or an admin may add images.
+func (s *ProductImageService) UploadImage(ctx context.Context, productID string, data io.Reader, userID string, admin bool) (_ *models.ProductImage, err error) {
+	ctx, span := tracing.Start(ctx, "ProductImageService.UploadImage")
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.checkOwner(ctx, productID, userID, admin); err != nil {
+		return nil, err
+	}
+
+	// Fail fast before processing the upload; the limit is enforced again
+	// when the image is added
+	images, err := s.imageRepo.ListByProduct(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	if len(images) >= s.config.ImageMaxPerProduct {
+		return nil, fmt.Errorf("%w: the limit is %d", ErrTooManyImages, s.config.ImageMaxPerProduct)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(data, int64(s.config.ImageMaxBytes)+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	if len(content) > s.config.ImageMaxBytes {
+		return nil, fmt.Errorf("%w: the limit is %d bytes", ErrImageTooLarge, s.config.ImageMaxBytes)
+	}
+
+	contentType := http.DetectContentType(content)
+	ext, ok := imageExtensions[contentType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedImageType, contentType)
+	}
+
+	original, variants, err := s.processor.Process(content, contentType)
+	switch {
+	case errors.Is(err, imaging.ErrUnsupportedFormat):
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedImageType, err)
+	case errors.Is(err, imaging.ErrTooManyPixels):
+		return nil, fmt.Errorf("%w: %v", ErrImageTooLarge, err)
+	case err != nil:
+		return nil, err
+	}
+
+	// The position is assigned when the image is added
+	image := models.NewProductImage(productID, contentType, ext, int64(len(original)), 0)
+	objects := []imaging.Variant{{ContentType: contentType, Data: original}}
+	paths := []string{image.Path}
+	for _, v := range variants {
+		objects = append(objects, v)
+		paths = append(paths, image.AddVariant(v.Width, v.Height, v.ContentType, v.Ext).Path)
+	}
+
+	for i, object := range objects {
+		if err := s.db.UploadObject(ctx, s.config.StorageBucket, paths[i], bytes.NewReader(object.Data), object.ContentType); err != nil {
+			s.removeObjects(ctx, paths[:i])
+			return nil, err
+		}
+	}
+
+	result, err := s.imageRepo.Create(ctx, image, s.config.ImageMaxPerProduct)
+	if err != nil {
+		// Do not leave objects behind that no record points to
+		s.removeObjects(ctx, paths)
+		if errors.Is(err, repository.ErrLimitExceeded) {
+			return nil, fmt.Errorf("%w: the limit is %d", ErrTooManyImages, s.config.ImageMaxPerProduct)
+		}
+		return nil, err
+	}
+
+	if err := s.setURLs(ctx, []*models.ProductImage{result}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ListImages lists the images of a product in display order. Products that
+// are not visible to the user are not found.
+func (s *ProductImageService) ListImages(ctx context.Context, productID, userID string, admin bool) (_ []models.ProductImage, err error) {
+	ctx, span := tracing.Start(ctx, "ProductImageService.ListImages")
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := visibleProduct(ctx, s.productRepo, productID, userID, admin); err != nil {
+		return nil, err
+	}
+
+	return s.imagesOf(ctx, productID)
+}
+
+// imagesOf lists the images of a product with their URLs filled in
+func (s *ProductImageService) imagesOf(ctx context.Context, productID string) ([]models.ProductImage, error) {
+	images, err := s.imageRepo.ListByProduct(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.setListURLs(ctx, images); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// ReorderImages sets the display order of the images of a product on behalf
+// of its owner or an admin
+func (s *ProductImageService) ReorderImages(ctx context.Context, productID string, imageIDs []string, userID string, admin bool) (_ []models.ProductImage, err error) {
+	ctx, span := tracing.Start(ctx, "ProductImageService.ReorderImages")
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.checkOwner(ctx, productID, userID, admin); err != nil {
+		return nil, err
+	}
+
+	images, err := s.imageRepo.Reorder(ctx, productID, imageIDs)
+	if errors.Is(err, repository.ErrInvalidArgument) {
+		return nil, ErrInvalidImageOrder
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.setListURLs(ctx, images); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// DeleteImage deletes an image of a product and its stored objects on behalf
+// of the product's owner or an admin
+func (s *ProductImageService) DeleteImage(ctx context.Context, productID, imageID, userID string, admin bool) (err error) {
+	ctx, span := tracing.Start(ctx, "ProductImageService.DeleteImage")
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.checkOwner(ctx, productID, userID, admin); err != nil {
+		return err
+	}
+
+	image, err := s.imageRepo.GetByID(ctx, productID, imageID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.imageRepo.Delete(ctx, image.ID); err != nil {
+		return err
+	}
+
+	s.removeObjects(ctx, image.ObjectPaths())
+	return s.productRepo.Touch(ctx, productID)
+}
+
+// checkOwner returns ErrNotProductOwner unless the product was created by
+// userID or admin is set
+func (s *ProductImageService) checkOwner(ctx context.Context, productID, userID string, admin bool) error {
+	product, err := s.productRepo.GetByID(ctx, productID)
+	if err != nil {
+		return err
+	}
+	if product.CreatedBy != userID && !admin {
+		return ErrNotProductOwner
+	}
+	return nil
+}
+
+// objectPaths returns the storage paths of the images of a product and their
+// variants
+func (s *ProductImageService) objectPaths(ctx context.Context, productID string) ([]string, error) {
+	images, err := s.imageRepo.ListByProduct(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, image := range images {
+		paths = append(paths, image.ObjectPaths()...)
+	}
+	return paths, nil
+}
+
+// removeObjects deletes stored objects. Failures are only logged since the
+// records pointing at the objects are already gone.
+func (s *ProductImageService) removeObjects(ctx context.Context, paths []string) {
+	if err := s.db.RemoveObjects(ctx, s.config.StorageBucket, paths); err != nil {
+		log := logger.GetLogger("images")
+		log.Error().Err(err).Strs("paths", paths).Msg("Failed to remove stored images")
+	}
+}
+
+// setListURLs fills in the URLs of a list of images like setURLs
+func (s *ProductImageService) setListURLs(ctx context.Context, images []models.ProductImage) error {
+	refs := make([]*models.ProductImage, len(images))
+	for i := range images {
+		refs[i] = &images[i]
+	}
+	return s.setURLs(ctx, refs)
+}
+
+// setURLs fills in the URLs of images and their variants, signing them for
+// private buckets
+func (s *ProductImageService) setURLs(ctx context.Context, images []*models.ProductImage) error {
+	var urls map[string]string
+	if !s.config.StoragePublicBucket {
+		var paths []string
+		for _, image := range images {
+			paths = append(paths, image.ObjectPaths()...)
+		}
+
+		var err error
+		urls, err = s.db.SignedURLs(ctx, s.config.StorageBucket, paths, s.config.StorageSignedURLTTL)
+		if err != nil {
+			return err
+		}
+	}
+
+	url := func(path string) string {
+		if urls == nil {
+			return s.db.PublicURL(s.config.StorageBucket, path)
+		}
+		return urls[path]
+	}
+	for _, image := range images {
+		image.URL = url(image.Path)
+		for i := range image.Variants {
+			image.Variants[i].URL = url(image.Variants[i].Path)
+		}
+	}
+	return nil
+}
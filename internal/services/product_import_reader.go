@@ -0,0 +1,226 @@
+package services
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/peterlimg/supabase-e/internal/models"
+	"github.com/peterlimg/supabase-e/pkg/utils"
+	"github.com/shopspring/decimal"
+)
+
+// maxImportLineBytes limits the length of an NDJSON line
+const maxImportLineBytes = 1 << 20
+
+// importListSeparator separates the tags and option axes in a CSV cell
+const importListSeparator = "|"
+
+var (
+	// ErrUnsupportedImportFormat is returned for imports in formats other
+	// than CSV and NDJSON
+	ErrUnsupportedImportFormat = errors.New("unsupported import format")
+
+	// ErrMalformedImport is returned for uploads that cannot be read any
+	// further, such as CSV files with unknown columns
+	ErrMalformedImport = errors.New("malformed import file")
+
+	// errMalformedRow fails a single row that cannot be parsed into a
+	// product
+	errMalformedRow = errors.New("malformed row")
+)
+
+// importColumns lists the CSV columns of an import. Tags and option axes are
+// separated by "|" and times are in RFC 3339 format.
+var importColumns = map[string]func(*models.CreateProductRequest, string) error{
+	"sku":         func(r *models.CreateProductRequest, v string) error { r.SKU = v; return nil },
+	"name":        func(r *models.CreateProductRequest, v string) error { r.Name = v; return nil },
+	"description": func(r *models.CreateProductRequest, v string) error { r.Description = v; return nil },
+	"price": func(r *models.CreateProductRequest, v string) (err error) {
+		r.Price, err = decimal.NewFromString(v)
+		return err
+	},
+	"currency":    func(r *models.CreateProductRequest, v string) error { r.Currency = v; return nil },
+	"category_id": func(r *models.CreateProductRequest, v string) error { r.CategoryID = v; return nil },
+	"tags":        func(r *models.CreateProductRequest, v string) error { r.Tags = splitImportList(v); return nil },
+	"option_axes": func(r *models.CreateProductRequest, v string) error { r.OptionAxes = splitImportList(v); return nil },
+	"image_url":   func(r *models.CreateProductRequest, v string) error { r.ImageURL = v; return nil },
+	"status": func(r *models.CreateProductRequest, v string) error {
+		r.Status = models.ProductStatus(v)
+		return nil
+	},
+	"publish_at": func(r *models.CreateProductRequest, v string) (err error) {
+		r.PublishAt, err = parseImportTime(v)
+		return err
+	},
+	"unpublish_at": func(r *models.CreateProductRequest, v string) (err error) {
+		r.UnpublishAt, err = parseImportTime(v)
+		return err
+	},
+	"low_stock_threshold": func(r *models.CreateProductRequest, v string) (err error) {
+		if v != "" {
+			r.LowStockThreshold, err = strconv.Atoi(v)
+		}
+		return err
+	},
+}
+
+// importRow is a row of an import, numbered from 1. A row that could not be
+// parsed carries the reason in err.
+type importRow struct {
+	number int
+	req    models.CreateProductRequest
+	err    error
+}
+
+// importReader reads the rows of an upload one at a time. next returns
+// io.EOF after the last row and other errors when the upload cannot be read
+// any further.
+type importReader interface {
+	next() (importRow, error)
+}
+
+// newImportReader creates a reader for an upload in the given format
+func newImportReader(format models.ImportFormat, r io.Reader) (importReader, error) {
+	switch format {
+	case models.ImportFormatCSV:
+		return newCSVImportReader(r)
+	case models.ImportFormatNDJSON:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64<<10), maxImportLineBytes)
+		return &ndjsonImportReader{scanner: scanner}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedImportFormat, format)
+	}
+}
+
+// csvImportReader reads CSV files whose first record names the columns
+type csvImportReader struct {
+	reader  *csv.Reader
+	columns []string
+	rows    int
+}
+
+// newCSVImportReader reads the header of a CSV file. An empty file has no
+// rows.
+func newCSVImportReader(r io.Reader) (*csvImportReader, error) {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return &csvImportReader{reader: reader}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedImport, err)
+	}
+
+	columns := make([]string, len(header))
+	seen := make(map[string]bool, len(header))
+	for i, name := range header {
+		// Spreadsheet programs often start UTF-8 files with a byte order mark
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := importColumns[name]; !ok {
+			return nil, fmt.Errorf("%w: unknown column %q", ErrMalformedImport, name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%w: duplicate column %q", ErrMalformedImport, name)
+		}
+		seen[name] = true
+		columns[i] = name
+	}
+	reader.FieldsPerRecord = len(columns)
+
+	return &csvImportReader{reader: reader, columns: columns}, nil
+}
+
+// next implements importReader
+func (r *csvImportReader) next() (importRow, error) {
+	if r.columns == nil {
+		return importRow{}, io.EOF
+	}
+
+	record, err := r.reader.Read()
+	if errors.Is(err, io.EOF) {
+		return importRow{}, io.EOF
+	}
+	r.rows++
+	row := importRow{number: r.rows}
+	if errors.Is(err, csv.ErrFieldCount) {
+		row.err = fmt.Errorf("%w: expected %d fields, got %d", errMalformedRow, len(r.columns), len(record))
+		return row, nil
+	}
+	if err != nil {
+		return importRow{}, fmt.Errorf("%w: %v", ErrMalformedImport, err)
+	}
+
+	for i, value := range record {
+		column := r.columns[i]
+		if err := importColumns[column](&row.req, utils.UnescapeCSVCell(strings.TrimSpace(value))); err != nil {
+			row.err = fmt.Errorf("%w: invalid %s %q", errMalformedRow, column, value)
+			break
+		}
+	}
+	return row, nil
+}
+
+// ndjsonImportReader reads files with one JSON product per line, in the
+// format of a create request. Blank lines are skipped but counted, so that
+// rows are numbered by line.
+type ndjsonImportReader struct {
+	scanner *bufio.Scanner
+	lines   int
+}
+
+// next implements importReader
+func (r *ndjsonImportReader) next() (importRow, error) {
+	for r.scanner.Scan() {
+		r.lines++
+		line := r.scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+
+		row := importRow{number: r.lines}
+		if err := json.Unmarshal(line, &row.req); err != nil {
+			row.err = fmt.Errorf("%w: %v", errMalformedRow, err)
+		}
+		return row, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return importRow{}, fmt.Errorf("%w: line %d: %v", ErrMalformedImport, r.lines+1, err)
+	}
+	return importRow{}, io.EOF
+}
+
+// splitImportList splits a CSV cell of tags or option axes
+func splitImportList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, importListSeparator) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseImportTime parses an optional RFC 3339 time
+func parseImportTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
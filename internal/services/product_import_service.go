@@ -0,0 +1,631 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"github.com/peterlimg/supabase-e/config"
+	"github.com/peterlimg/supabase-e/internal/models"
+	"github.com/peterlimg/supabase-e/internal/repository"
+	"github.com/peterlimg/supabase-e/pkg/logger"
+	"github.com/peterlimg/supabase-e/pkg/tracing"
+	"github.com/peterlimg/supabase-e/pkg/utils"
+)
+
+var (
+	// ErrImportJobNotFound is returned for unknown or expired import jobs and
+	// for jobs of other users
+	ErrImportJobNotFound = errors.New("import job not found")
+
+	// ErrTooManyImports is returned when a user starts an import while
+	// already having the maximum number of unfinished imports
+	ErrTooManyImports = errors.New("too many unfinished imports")
+
+	// ErrImportsStopped is returned for imports started during shutdown
+	ErrImportsStopped = errors.New("imports are shutting down")
+
+	// errTrashedSKU fails import rows whose SKU belongs to a product in the
+	// trash, which has to be restored or purged first
+	errTrashedSKU = errors.New("a product with this sku is in the trash")
+
+	// errImportInterrupted fails jobs that a shutdown or crash of the server
+	// stopped before they finished
+	errImportInterrupted = errors.New("import was interrupted by a restart of the server")
+)
+
+// ProductImportService imports products in bulk from CSV or NDJSON files.
+// Each upload becomes an import job that runs in the background, with at
+// most the configured number running at once. Jobs are stored until they
+// have been finished for the configured TTL, so that their progress and
+// error reports outlive the process; the jobs running in this process are
+// also kept in memory.
+type ProductImportService struct {
+	productService *ProductService
+	productRepo    *repository.ProductRepository
+	jobRepo        *repository.ImportJobRepository
+	categories     *CategoryService
+	batchSize      int
+	jobTTL         time.Duration
+	maxJobsPerUser int
+	// dir holds the spooled uploads of this instance, named by job ID
+	dir string
+	// worker names this instance in the jobs it runs
+	worker string
+	// slots bounds the number of imports running at once
+	slots chan struct{}
+
+	// ctx is cancelled by Shutdown to interrupt the jobs, which wg tracks
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu   sync.Mutex
+	jobs map[string]*models.ImportJob
+}
+
+// NewProductImportService creates a new product import service
+func NewProductImportService(productService *ProductService, productRepo *repository.ProductRepository, jobRepo *repository.ImportJobRepository, categories *CategoryService, config *config.Config) *ProductImportService {
+	batchSize := config.ImportBatchSize
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	concurrency := config.ImportConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	worker, err := os.Hostname()
+	if err != nil {
+		worker = "localhost"
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ProductImportService{
+		productService: productService,
+		productRepo:    productRepo,
+		jobRepo:        jobRepo,
+		categories:     categories,
+		batchSize:      batchSize,
+		jobTTL:         config.ImportJobTTL,
+		maxJobsPerUser: config.ImportMaxJobsPerUser,
+		dir:            filepath.Join(os.TempDir(), "product-imports"),
+		worker:         worker,
+		slots:          make(chan struct{}, concurrency),
+		ctx:            ctx,
+		cancel:         cancel,
+		jobs:           map[string]*models.ImportJob{},
+	}
+}
+
+// Recover fails the jobs that an earlier run of this instance left
+// unfinished, for example by crashing, and removes their spooled uploads.
+// It is meant to be called on startup before any import is started.
+func (s *ProductImportService) Recover(ctx context.Context) error {
+	if err := os.RemoveAll(s.dir); err != nil {
+		return fmt.Errorf("failed to remove import files: %w", err)
+	}
+
+	failed, err := s.jobRepo.FailUnfinished(ctx, s.worker, errImportInterrupted.Error(), time.Now())
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		log := logger.GetLogger("import")
+		log.Warn().Int("jobs", failed).Msg("Failed import jobs interrupted by a restart")
+	}
+	return nil
+}
+
+// Shutdown interrupts the running imports and waits until they have recorded
+// that they failed, or until ctx is done. Imports started afterwards are
+// refused.
+func (s *ProductImportService) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.cancel()
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// StartImport copies an upload to a file and imports it in the background on
+// behalf of userID. Rows may only update products of the user unless admin
+// is set. The returned job is a snapshot; poll GetJob for progress.
+func (s *ProductImportService) StartImport(ctx context.Context, upload io.Reader, format models.ImportFormat, dryRun bool, userID string, admin bool) (_ *models.ImportJob, err error) {
+	ctx, span := tracing.Start(ctx, "ProductImportService.StartImport")
+	defer func() { tracing.End(span, err) }()
+
+	now := time.Now()
+	s.pruneJobs(ctx, now)
+
+	job := &models.ImportJob{
+		ID:        uuid.New().String(),
+		Status:    models.ImportJobPending,
+		Format:    format,
+		DryRun:    dryRun,
+		CreatedBy: userID,
+		CreatedAt: now,
+		Errors:    []models.ImportRowError{},
+	}
+	if err := s.register(job); err != nil {
+		return nil, err
+	}
+
+	file, err := s.spool(job.ID, upload)
+	if err == nil {
+		if err = s.jobRepo.Create(ctx, job, s.worker); err != nil {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}
+	if err != nil {
+		s.unregister(job)
+		return nil, err
+	}
+
+	snapshot := *job
+
+	// The import outlives the request, but keeps its trace and logger values
+	go s.run(context.WithoutCancel(ctx), job, file, admin)
+
+	return &snapshot, nil
+}
+
+// GetJob returns a snapshot of an import job of userID, or of any user if
+// admin is set
+func (s *ProductImportService) GetJob(ctx context.Context, id, userID string, admin bool) (*models.ImportJob, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrImportJobNotFound
+	}
+
+	s.mu.Lock()
+	running, ok := s.jobs[id]
+	var job *models.ImportJob
+	if ok {
+		job = snapshotJob(running)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		stored, err := s.jobRepo.GetByID(ctx, id)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrImportJobNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		job = stored
+	}
+
+	if job.CreatedBy != userID && !admin {
+		return nil, ErrImportJobNotFound
+	}
+	if job.FinishedAt != nil && time.Since(*job.FinishedAt) > s.jobTTL {
+		return nil, ErrImportJobNotFound
+	}
+	return job, nil
+}
+
+// snapshotJob copies a job so that it can be read without holding s.mu. The
+// caller must hold s.mu.
+func snapshotJob(job *models.ImportJob) *models.ImportJob {
+	snapshot := *job
+	snapshot.Errors = append([]models.ImportRowError(nil), job.Errors...)
+	return &snapshot
+}
+
+// register adds a job to the jobs running in this process, unless imports
+// are shutting down or its user already has too many unfinished jobs
+func (s *ProductImportService) register(job *models.ImportJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ctx.Err() != nil {
+		return ErrImportsStopped
+	}
+	unfinished := 0
+	for _, other := range s.jobs {
+		if other.CreatedBy == job.CreatedBy && !other.Finished() {
+			unfinished++
+		}
+	}
+	if unfinished >= s.maxJobsPerUser {
+		return ErrTooManyImports
+	}
+
+	s.jobs[job.ID] = job
+	s.wg.Add(1)
+	return nil
+}
+
+// unregister removes a job that finished or never started from the jobs
+// running in this process
+func (s *ProductImportService) unregister(job *models.ImportJob) {
+	s.mu.Lock()
+	delete(s.jobs, job.ID)
+	s.mu.Unlock()
+	s.wg.Done()
+}
+
+// spool copies an upload to a file named by its job, so that the request can
+// finish while the rows are read from disk
+func (s *ProductImportService) spool(id string, upload io.Reader) (*os.File, error) {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create import file: %w", err)
+	}
+	file, err := os.OpenFile(filepath.Join(s.dir, id), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create import file: %w", err)
+	}
+	if _, err := io.Copy(file, upload); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, fmt.Errorf("failed to read import file: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, fmt.Errorf("failed to read import file: %w", err)
+	}
+	return file, nil
+}
+
+// pruneJobs deletes jobs that finished more than the TTL ago, including
+// those kept in memory because they could not be saved, and fails jobs
+// that made no progress for as long, such as those of an instance that
+// crashed and never came back. Errors are only logged since they do not
+// affect new imports.
+func (s *ProductImportService) pruneJobs(ctx context.Context, now time.Time) {
+	log := logger.GetLogger("import")
+	expired := now.Add(-s.jobTTL)
+
+	s.mu.Lock()
+	for id, job := range s.jobs {
+		if job.FinishedAt != nil && job.FinishedAt.Before(expired) {
+			delete(s.jobs, id)
+		}
+	}
+	s.mu.Unlock()
+
+	if err := s.jobRepo.DeleteFinishedBefore(ctx, expired); err != nil {
+		log.Error().Err(err).Msg("Failed to delete expired import jobs")
+	}
+	if _, err := s.jobRepo.FailStale(ctx, expired, errImportInterrupted.Error(), now); err != nil {
+		log.Error().Err(err).Msg("Failed to fail stale import jobs")
+	}
+}
+
+// updateJob changes a job while holding s.mu, so that snapshots never see a
+// half-updated job
+func (s *ProductImportService) updateJob(job *models.ImportJob, change func(*models.ImportJob)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	change(job)
+}
+
+// saveJob stores a snapshot of a job. A failed save is only logged: the job
+// goes on and stays readable from memory while it runs.
+func (s *ProductImportService) saveJob(ctx context.Context, job *models.ImportJob) error {
+	s.mu.Lock()
+	snapshot := snapshotJob(job)
+	s.mu.Unlock()
+
+	err := s.jobRepo.Update(ctx, snapshot)
+	if err != nil {
+		log := logger.GetLogger("import")
+		log.Error().Err(err).Str("job_id", job.ID).Msg("Failed to save import job")
+	}
+	return err
+}
+
+// run waits for a free slot, imports the rows of a spooled upload and
+// removes the file afterwards. Shutdown interrupts it, failing the job.
+func (s *ProductImportService) run(ctx context.Context, job *models.ImportJob, file *os.File, admin bool) {
+	defer s.wg.Done()
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(s.ctx, cancel)
+	defer stop()
+
+	log := logger.GetLogger("import")
+
+	var err error
+	select {
+	case s.slots <- struct{}{}:
+		s.updateJob(job, func(j *models.ImportJob) { j.Status = models.ImportJobRunning })
+		s.saveJob(ctx, job)
+		err = s.importRows(ctx, job, file, admin)
+		<-s.slots
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil && s.ctx.Err() != nil {
+		err = errImportInterrupted
+	}
+
+	finished := time.Now()
+	s.updateJob(job, func(j *models.ImportJob) {
+		j.Status = models.ImportJobCompleted
+		if err != nil {
+			j.Status = models.ImportJobFailed
+			j.Error = err.Error()
+		}
+		j.FinishedAt = &finished
+	})
+
+	// The final state is saved even when the job was interrupted. A job
+	// that could not be saved stays in memory until it expires.
+	if s.saveJob(context.WithoutCancel(ctx), job) == nil {
+		s.mu.Lock()
+		delete(s.jobs, job.ID)
+		s.mu.Unlock()
+	}
+
+	event := log.Info()
+	if err != nil {
+		event = log.Error().Err(err)
+	}
+	event.Str("job_id", job.ID).Bool("dry_run", job.DryRun).
+		Int("rows", job.Rows).Int("created", job.Created).Int("updated", job.Updated).Int("failed", job.Failed).
+		Msg("Product import finished")
+}
+
+// importRows reads the rows of an upload, validating each as it is read and
+// writing them in batches
+func (s *ProductImportService) importRows(ctx context.Context, job *models.ImportJob, file io.Reader, admin bool) (err error) {
+	ctx, span := tracing.Start(ctx, "ProductImportService.importRows")
+	defer func() { tracing.End(span, err) }()
+
+	reader, err := newImportReader(job.Format, file)
+	if err != nil {
+		return err
+	}
+
+	// Categories rarely change during an import, so they are looked up once
+	// instead of once per row
+	categories, err := s.categories.byID(ctx)
+	if err != nil {
+		return err
+	}
+
+	seen := map[string]int{}
+	batch := make([]importRow, 0, s.batchSize)
+	for {
+		row, err := reader.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		s.updateJob(job, func(j *models.ImportJob) { j.Rows++ })
+
+		if row.err == nil {
+			row.err = s.checkRow(&row, categories, seen)
+		}
+		if row.err != nil {
+			s.failRow(job, row, row.err)
+			continue
+		}
+
+		batch = append(batch, row)
+		if len(batch) == s.batchSize {
+			if err := s.writeBatch(ctx, job, batch, admin); err != nil {
+				return err
+			}
+			s.saveJob(ctx, job)
+			batch = batch[:0]
+		}
+	}
+
+	if len(batch) > 0 {
+		return s.writeBatch(ctx, job, batch, admin)
+	}
+	return nil
+}
+
+// checkRow validates a row like a create request, checks its category and
+// rejects SKUs that an earlier row of the upload already used
+func (s *ProductImportService) checkRow(row *importRow, categories map[string]models.Category, seen map[string]int) error {
+	if err := binding.Validator.ValidateStruct(&row.req); err != nil {
+		return fmt.Errorf("%w: %v", utils.ErrValidation, err)
+	}
+	if err := s.productService.normalizeCreate(&row.req); err != nil {
+		return err
+	}
+	if _, ok := categories[row.req.CategoryID]; !ok {
+		return fmt.Errorf("%w: %w %s", utils.ErrValidation, ErrUnknownCategory, row.req.CategoryID)
+	}
+	if row.req.SKU != "" {
+		if first, ok := seen[row.req.SKU]; ok {
+			return fmt.Errorf("%w: sku is already used by row %d", utils.ErrValidation, first)
+		}
+		seen[row.req.SKU] = row.number
+	}
+	return nil
+}
+
+// writeBatch updates the products whose SKUs already exist and creates the
+// rest. Rows that cannot be written are reported as failed; only errors that
+// stop the whole import are returned.
+func (s *ProductImportService) writeBatch(ctx context.Context, job *models.ImportJob, batch []importRow, admin bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	skus := make([]string, 0, len(batch))
+	for _, row := range batch {
+		if row.req.SKU != "" {
+			skus = append(skus, row.req.SKU)
+		}
+	}
+	existing := map[string]models.Product{}
+	if len(skus) > 0 {
+		products, err := s.productRepo.ListBySKUs(ctx, skus)
+		if err != nil {
+			return err
+		}
+		for _, product := range products {
+			existing[product.SKU] = product
+		}
+	}
+
+	var creates, updates []importRow
+	var writes []models.ProductBatchWrite
+	for _, row := range batch {
+		product, ok := existing[row.req.SKU]
+		if row.req.SKU == "" || !ok {
+			creates = append(creates, row)
+			continue
+		}
+		write, err := s.updateWrite(ctx, job, row, product, admin)
+		if err != nil {
+			s.failRow(job, row, err)
+			continue
+		}
+		updates = append(updates, row)
+		writes = append(writes, write)
+	}
+
+	if err := s.updateRows(ctx, job, updates, writes); err != nil {
+		return err
+	}
+	return s.createRows(ctx, job, creates)
+}
+
+// updateWrite prepares the update of an existing product with a row, which
+// replaces its editable fields like a full update does. Empty option axes
+// leave the product's axes unchanged, and the status, schedule and stock
+// settings are never changed by an import.
+func (s *ProductImportService) updateWrite(ctx context.Context, job *models.ImportJob, row importRow, product models.Product, admin bool) (models.ProductBatchWrite, error) {
+	if product.DeletedAt != nil {
+		return models.ProductBatchWrite{}, errTrashedSKU
+	}
+	if product.CreatedBy != job.CreatedBy && !admin {
+		return models.ProductBatchWrite{}, ErrNotProductOwner
+	}
+
+	req := models.UpdateProductRequest{
+		Name:        &row.req.Name,
+		Description: &row.req.Description,
+		Price:       &row.req.Price,
+		Currency:    &row.req.Currency,
+		CategoryID:  &row.req.CategoryID,
+		Tags:        row.req.Tags,
+	}
+	if len(row.req.OptionAxes) > 0 {
+		req.OptionAxes = &row.req.OptionAxes
+	}
+	if row.req.ImageURL != "" {
+		req.ImageURL = &row.req.ImageURL
+	}
+
+	// The row's price is already in major units, so only the remaining
+	// checks of an update apply
+	if err := s.productService.checkUpdate(ctx, product.ID, &req); err != nil {
+		return models.ProductBatchWrite{}, err
+	}
+	return models.ProductBatchWrite{
+		Op:                models.ProductBatchUpdate,
+		ID:                product.ID,
+		Product:           req,
+		ExpectedUpdatedAt: &product.UpdatedAt,
+	}, nil
+}
+
+// updateRows applies the prepared updates of rows in one batch write. If the
+// write fails on a row, for example because its product changed meanwhile,
+// that row is reported as failed and the others are written again without
+// it.
+func (s *ProductImportService) updateRows(ctx context.Context, job *models.ImportJob, rows []importRow, writes []models.ProductBatchWrite) error {
+	if job.DryRun {
+		s.updateJob(job, func(j *models.ImportJob) { j.Updated += len(rows) })
+		return nil
+	}
+
+	for len(writes) > 0 {
+		_, err := s.productRepo.BatchWrite(ctx, writes, job.CreatedBy)
+		var batchErr *repository.BatchError
+		if !errors.As(err, &batchErr) {
+			if err != nil {
+				return err
+			}
+			s.updateJob(job, func(j *models.ImportJob) { j.Updated += len(writes) })
+			return nil
+		}
+
+		i := batchErr.Index
+		s.failRow(job, rows[i], batchErr.Err)
+		rows = append(rows[:i:i], rows[i+1:]...)
+		writes = append(writes[:i:i], writes[i+1:]...)
+	}
+	return nil
+}
+
+// createRows creates products from rows in one insert. If the insert fails,
+// for example because another request took one of the SKUs meanwhile, the
+// rows are created one at a time so that only the offending rows fail.
+func (s *ProductImportService) createRows(ctx context.Context, job *models.ImportJob, rows []importRow) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	if job.DryRun {
+		s.updateJob(job, func(j *models.ImportJob) { j.Created += len(rows) })
+		return nil
+	}
+
+	products := make([]models.Product, len(rows))
+	for i, row := range rows {
+		products[i] = models.NewProduct(row.req, job.CreatedBy)
+	}
+
+	created, err := s.productRepo.CreateMany(ctx, products)
+	if err == nil {
+		s.updateJob(job, func(j *models.ImportJob) { j.Created += len(created) })
+		return nil
+	}
+
+	for i, product := range products {
+		_, err := s.productRepo.Create(ctx, product)
+		if errors.Is(err, repository.ErrConflict) {
+			err = ErrDuplicateSKU
+		}
+		if err != nil {
+			s.failRow(job, rows[i], err)
+			continue
+		}
+		s.updateJob(job, func(j *models.ImportJob) { j.Created++ })
+	}
+	return nil
+}
+
+// failRow records why a row failed
+func (s *ProductImportService) failRow(job *models.ImportJob, row importRow, err error) {
+	s.updateJob(job, func(j *models.ImportJob) {
+		j.Failed++
+		j.Errors = append(j.Errors, models.ImportRowError{
+			Row:   row.number,
+			SKU:   row.req.SKU,
+			Error: err.Error(),
+		})
+	})
+}
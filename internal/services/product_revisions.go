@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+
+	"github.com/peterlimg/supabase-e/internal/models"
+	"github.com/peterlimg/supabase-e/pkg/tracing"
+)
+
+// ListRevisions lists a page of the revisions of a product, newest first,
+// each with the fields it changed relative to the revision before it.
+// Products that are not visible to the user are not found.
+func (s *ProductService) ListRevisions(ctx context.Context, id string, page, pageSize int, userID string, admin bool) (_ []models.ProductRevision, err error) {
+	ctx, span := tracing.Start(ctx, "ProductService.ListRevisions")
+	defer func() { tracing.End(span, err) }()
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	// An unknown product is reported as such rather than as an empty history
+	if _, err := visibleProduct(ctx, s.productRepo, id, userID, admin); err != nil {
+		return nil, err
+	}
+
+	// Fetch one more revision to diff the last one of the page against
+	revisions, err := s.revisionRepo.ListByProduct(ctx, id, (page-1)*pageSize, pageSize+1)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range revisions {
+		if i+1 < len(revisions) {
+			revisions[i].Previous = &revisions[i+1].Snapshot
+		}
+		if revisions[i].Changes, err = models.DiffSnapshots(revisions[i].Previous, revisions[i].Snapshot); err != nil {
+			return nil, err
+		}
+	}
+	if len(revisions) > pageSize {
+		revisions = revisions[:pageSize]
+	}
+
+	return revisions, nil
+}
+
+// RestoreRevision rolls a product back to the fields of one of its
+// revisions, recording the result as a new revision by userID. Only the
+// product's creator or an admin may roll it back. A non-empty ifMatch makes
+// the rollback conditional on the product's current ETag.
+func (s *ProductService) RestoreRevision(ctx context.Context, id string, revision int, ifMatch, userID string, admin bool) (_ *models.Product, err error) {
+	ctx, span := tracing.Start(ctx, "ProductService.RestoreRevision")
+	defer func() { tracing.End(span, err) }()
+
+	current, err := s.productRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if current.CreatedBy != userID && !admin {
+		return nil, ErrNotProductOwner
+	}
+
+	expectedUpdatedAt, err := checkIfMatch(current, ifMatch)
+	if err != nil {
+		return nil, err
+	}
+
+	rev, err := s.revisionRepo.GetByNumber(ctx, id, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	// The category or variants may have changed since, so the snapshot is
+	// checked like any other update
+	req := rev.Snapshot
+	if err := s.checkUpdate(ctx, id, &req); err != nil {
+		return nil, err
+	}
+
+	return s.update(ctx, id, req, expectedUpdatedAt, userID)
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/peterlimg/supabase-e/config"
+	"github.com/peterlimg/supabase-e/pkg/logger"
+)
+
+// ProductScheduler periodically publishes and unpublishes products whose
+// scheduled publish_at or unpublish_at time has come
+type ProductScheduler struct {
+	productService *ProductService
+	interval       time.Duration
+}
+
+// NewProductScheduler creates a new product scheduler
+func NewProductScheduler(productService *ProductService, config *config.Config) *ProductScheduler {
+	return &ProductScheduler{
+		productService: productService,
+		interval:       config.PublishScheduleInterval,
+	}
+}
+
+// Run applies the publishing schedule once per interval until ctx is
+// cancelled. It returns right away if scheduling is disabled.
+func (p *ProductScheduler) Run(ctx context.Context) {
+	log := logger.GetLogger("scheduler")
+	runEvery(ctx, p.interval, func(ctx context.Context) {
+		published, unpublished, err := p.productService.ApplySchedule(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Msg("Failed to apply the publishing schedule")
+			return
+		}
+		if published > 0 || unpublished > 0 {
+			log.Info().Int("published", published).Int("unpublished", unpublished).Msg("Applied the publishing schedule")
+		}
+	})
+}
@@ -1,31 +1,90 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"html"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/peterlimg/supabase-e/config"
 	"github.com/peterlimg/supabase-e/internal/models"
 	"github.com/peterlimg/supabase-e/internal/repository"
+	"github.com/peterlimg/supabase-e/pkg/money"
+	"github.com/peterlimg/supabase-e/pkg/tracing"
+	"github.com/peterlimg/supabase-e/pkg/utils"
+	"github.com/shopspring/decimal"
 )
 
+// maxSearchQueryLength is the longest accepted search query in characters
+const maxSearchQueryLength = 200
+
+// Markers that search_products puts around matched terms
+const (
+	highlightStart = "<mark>"
+	highlightStop  = "</mark>"
+)
+
+// purgeBatchSize is the number of trashed products purged per query
+const purgeBatchSize = 100
+
+// ErrDuplicateSKU is returned when creating a product with the SKU of
+// another product
+var ErrDuplicateSKU = errors.New("another product has this sku")
+
+// ErrNotProductOwner is returned when a user changes a product created by
+// someone else
+var ErrNotProductOwner = errors.New("product belongs to another user")
+
 // ProductService handles product operations
 type ProductService struct {
-	productRepo *repository.ProductRepository
+	productRepo  *repository.ProductRepository
+	revisionRepo *repository.ProductRevisionRepository
+	images       *ProductImageService
+	categories   *CategoryService
+	variants     *ProductVariantService
+	config       *config.Config
 }
 
 // NewProductService creates a new product service
-func NewProductService(productRepo *repository.ProductRepository) *ProductService {
+func NewProductService(productRepo *repository.ProductRepository, revisionRepo *repository.ProductRevisionRepository, images *ProductImageService, categories *CategoryService, variants *ProductVariantService, config *config.Config) *ProductService {
 	return &ProductService{
-		productRepo: productRepo,
+		productRepo:  productRepo,
+		revisionRepo: revisionRepo,
+		images:       images,
+		categories:   categories,
+		variants:     variants,
+		config:       config,
 	}
 }
 
-// CreateProduct creates a new product
-func (s *ProductService) CreateProduct(req models.CreateProductRequest, userID string) (*models.Product, error) {
+// CreateProduct creates a new product and records it as its first revision
+func (s *ProductService) CreateProduct(ctx context.Context, req models.CreateProductRequest, userID string) (_ *models.Product, err error) {
+	ctx, span := tracing.Start(ctx, "ProductService.CreateProduct")
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.normalizeCreate(&req); err != nil {
+		return nil, err
+	}
+	if err := s.categories.CheckExists(ctx, req.CategoryID); err != nil {
+		return nil, err
+	}
+
 	// Create a new product model
 	product := models.NewProduct(req, userID)
 
-	// Save to the database
-	result, err := s.productRepo.Create(product)
+	return s.create(ctx, product)
+}
+
+// create saves a new product, which is recorded as its first revision by its
+// creator
+func (s *ProductService) create(ctx context.Context, product models.Product) (*models.Product, error) {
+	result, err := s.productRepo.Create(ctx, product)
+	if errors.Is(err, repository.ErrConflict) {
+		return nil, fmt.Errorf("%w: %v", ErrDuplicateSKU, err)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create product: %w", err)
 	}
@@ -33,33 +92,520 @@ func (s *ProductService) CreateProduct(req models.CreateProductRequest, userID s
 	return result, nil
 }
 
-// GetProductByID gets a product by ID
-func (s *ProductService) GetProductByID(id string) (*models.Product, error) {
-	return s.productRepo.GetByID(id)
+// normalizeCreate fills in the default currency and status of a new product,
+// converts its price into major units and its tags and option axes into
+// their slug form, and validates it apart from its category
+func (s *ProductService) normalizeCreate(req *models.CreateProductRequest) error {
+	if req.Currency == "" {
+		req.Currency = s.config.DefaultCurrency
+	}
+	req.Currency = strings.ToUpper(req.Currency)
+	price, err := priceFromRequest(s.config, req.Price, req.Currency)
+	if err != nil {
+		return err
+	}
+	req.Price = price
+	req.Tags = models.NormalizeTags(req.Tags)
+	req.OptionAxes = models.NormalizeOptionAxes(req.OptionAxes)
+	if req.Status == "" {
+		req.Status = models.ProductStatusDraft
+	}
+	if err := req.Validate(time.Now()); err != nil {
+		return fmt.Errorf("%w: %v", utils.ErrValidation, err)
+	}
+	return nil
+}
+
+// GetProductByID gets a product by ID along with its images and variants.
+// Products that are not visible to the user are not found.
+func (s *ProductService) GetProductByID(ctx context.Context, id, userID string, admin bool) (_ *models.Product, err error) {
+	ctx, span := tracing.Start(ctx, "ProductService.GetProductByID")
+	defer func() { tracing.End(span, err) }()
+
+	product, err := visibleProduct(ctx, s.productRepo, id, userID, admin)
+	if err != nil {
+		return nil, err
+	}
+
+	if product.Images, err = s.images.imagesOf(ctx, id); err != nil {
+		return nil, err
+	}
+	if product.Variants, err = s.variants.variantsOf(ctx, product); err != nil {
+		return nil, err
+	}
+	return product, nil
 }
 
-// GetProductWithUser gets a product with its creator's information
-func (s *ProductService) GetProductWithUser(id string) (*models.ProductResponse, error) {
-	return s.productRepo.GetProductWithUser(id)
+// visibleProduct gets a product by ID for a user. Products that are not
+// visible to the user are not found, so that reads of a product and of its
+// images, variants, stock and revisions do not reveal other users' drafts.
+func visibleProduct(ctx context.Context, productRepo *repository.ProductRepository, id, userID string, admin bool) (*models.Product, error) {
+	product, err := productRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !product.VisibleTo(userID, admin) {
+		return nil, fmt.Errorf("product %w", repository.ErrNotFound)
+	}
+	return product, nil
 }
 
-// UpdateProduct updates a product
-func (s *ProductService) UpdateProduct(id string, req models.UpdateProductRequest) (*models.Product, error) {
-	return s.productRepo.Update(id, req)
+// GetProductWithUser gets a product with its creator's information. Products
+// that are not visible to the user are not found.
+func (s *ProductService) GetProductWithUser(ctx context.Context, id, userID string, admin bool) (_ *models.ProductResponse, err error) {
+	ctx, span := tracing.Start(ctx, "ProductService.GetProductWithUser")
+	defer func() { tracing.End(span, err) }()
+
+	product, err := s.productRepo.GetProductWithUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !product.VisibleTo(userID, admin) {
+		return nil, fmt.Errorf("product %w", repository.ErrNotFound)
+	}
+	return product, nil
 }
 
-// DeleteProduct deletes a product
-func (s *ProductService) DeleteProduct(id string) error {
-	return s.productRepo.Delete(id)
+// UpdateProduct updates a product and records the result as a new revision
+// by userID. Only the product's creator or an admin may update it. A
+// non-empty ifMatch makes the update conditional on the product's current
+// ETag.
+func (s *ProductService) UpdateProduct(ctx context.Context, id string, req models.UpdateProductRequest, ifMatch, userID string, admin bool) (_ *models.Product, err error) {
+	ctx, span := tracing.Start(ctx, "ProductService.UpdateProduct")
+	defer func() { tracing.End(span, err) }()
+
+	current, err := s.productRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if current.CreatedBy != userID && !admin {
+		return nil, ErrNotProductOwner
+	}
+
+	if err := s.normalizeUpdate(ctx, id, &req); err != nil {
+		return nil, err
+	}
+
+	expectedUpdatedAt, err := checkIfMatch(current, ifMatch)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.update(ctx, id, req, expectedUpdatedAt, userID)
 }
 
-// ListProducts lists all products with pagination and optional filtering
-func (s *ProductService) ListProducts(page, pageSize int, category string) ([]models.Product, error) {
+// PatchProduct applies a merge patch or JSON patch to a product. The patched
+// product is validated like a full update and written only if the product
+// has not changed since it was read; a non-empty ifMatch must also match the
+// product's current ETag. Only the product's creator or an admin may patch
+// it. The result is recorded as a new revision by userID.
+func (s *ProductService) PatchProduct(ctx context.Context, id string, patch utils.Patch, ifMatch, userID string, admin bool) (_ *models.Product, err error) {
+	ctx, span := tracing.Start(ctx, "ProductService.PatchProduct")
+	defer func() { tracing.End(span, err) }()
+
+	current, err := s.productRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if current.CreatedBy != userID && !admin {
+		return nil, ErrNotProductOwner
+	}
+
+	if ifMatch != "" && !utils.MatchETag(ifMatch, current.ETag(), false) {
+		return nil, fmt.Errorf("product %w", repository.ErrPreconditionFailed)
+	}
+
+	req, err := s.applyPatch(ctx, *current, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.update(ctx, id, req, &current.UpdatedAt, userID)
+}
+
+// applyPatch applies a patch to the editable fields of a product and returns
+// them normalized like a full update
+func (s *ProductService) applyPatch(ctx context.Context, current models.Product, patch utils.Patch) (models.UpdateProductRequest, error) {
+	// Patches see the price in the same format as API responses
+	doc := current.UpdateRequest()
+	if s.config.PriceFormat == money.FormatMinor {
+		minor, err := money.RoundToMinor(current.Price, current.Currency)
+		if err != nil {
+			return models.UpdateProductRequest{}, err
+		}
+		price := decimal.NewFromInt(minor)
+		doc.Price = &price
+	}
+
+	var req models.UpdateProductRequest
+	if err := patch.ApplyTo(doc, &req); err != nil {
+		return models.UpdateProductRequest{}, err
+	}
+
+	if err := s.normalizeUpdate(ctx, current.ID, &req); err != nil {
+		return models.UpdateProductRequest{}, err
+	}
+	return req, nil
+}
+
+// update writes a normalized update by userID, which is recorded as a new
+// revision in the same transaction
+func (s *ProductService) update(ctx context.Context, id string, req models.UpdateProductRequest, expectedUpdatedAt *time.Time, userID string) (*models.Product, error) {
+	return s.productRepo.Update(ctx, id, req, expectedUpdatedAt, userID)
+}
+
+// DeleteProduct moves a product to the trash, from which it can be restored
+// until it is purged. Only the product's creator or an admin may delete it.
+// A non-empty ifMatch makes the delete conditional on the product's current
+// ETag.
+func (s *ProductService) DeleteProduct(ctx context.Context, id, ifMatch, userID string, admin bool) (err error) {
+	ctx, span := tracing.Start(ctx, "ProductService.DeleteProduct")
+	defer func() { tracing.End(span, err) }()
+
+	current, err := s.productRepo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if current.CreatedBy != userID && !admin {
+		return ErrNotProductOwner
+	}
+
+	expectedUpdatedAt, err := checkIfMatch(current, ifMatch)
+	if err != nil {
+		return err
+	}
+
+	return s.productRepo.Trash(ctx, id, expectedUpdatedAt)
+}
+
+// UpdateStatus moves a product to another status of its lifecycle and
+// replaces its publishing schedule. Only the product's creator or an admin
+// may do so. A non-empty ifMatch makes the change conditional on the
+// product's current ETag.
+func (s *ProductService) UpdateStatus(ctx context.Context, id string, req models.UpdateProductStatusRequest, ifMatch, userID string, admin bool) (_ *models.Product, err error) {
+	ctx, span := tracing.Start(ctx, "ProductService.UpdateStatus")
+	defer func() { tracing.End(span, err) }()
+
+	current, err := s.productRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if current.CreatedBy != userID && !admin {
+		return nil, ErrNotProductOwner
+	}
+	if ifMatch != "" && !utils.MatchETag(ifMatch, current.ETag(), false) {
+		return nil, fmt.Errorf("product %w", repository.ErrPreconditionFailed)
+	}
+
+	if !current.Status.CanTransitionTo(req.Status) {
+		return nil, fmt.Errorf("%w from %s to %s", models.ErrInvalidStatusTransition, current.Status, req.Status)
+	}
+	if err := req.Validate(time.Now()); err != nil {
+		return nil, fmt.Errorf("%w: %v", utils.ErrValidation, err)
+	}
+
+	return s.productRepo.UpdateStatus(ctx, id, req, current.UpdatedAt)
+}
+
+// ApplySchedule publishes the drafts and unpublishes the products whose
+// scheduled time has come, and returns how many of each it changed
+func (s *ProductService) ApplySchedule(ctx context.Context) (published, unpublished int, err error) {
+	ctx, span := tracing.Start(ctx, "ProductService.ApplySchedule")
+	defer func() { tracing.End(span, err) }()
+
+	now := time.Now()
+	publishedProducts, err := s.productRepo.PublishDue(ctx, now)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	unpublishedProducts, err := s.productRepo.UnpublishDue(ctx, now)
+	if err != nil {
+		return len(publishedProducts), 0, err
+	}
+
+	return len(publishedProducts), len(unpublishedProducts), nil
+}
+
+// ListTrash lists a page of the user's trashed products, most recently
+// trashed first
+func (s *ProductService) ListTrash(ctx context.Context, userID string, page, pageSize int) (_ []models.Product, err error) {
+	ctx, span := tracing.Start(ctx, "ProductService.ListTrash")
+	defer func() { tracing.End(span, err) }()
+
 	if page < 1 {
 		page = 1
 	}
 	if pageSize < 1 || pageSize > 100 {
 		pageSize = 10
 	}
-	return s.productRepo.List(page, pageSize, category)
+
+	return s.productRepo.ListTrash(ctx, userID, page, pageSize)
+}
+
+// RestoreProduct takes a product out of the trash. Only its creator or an
+// admin may restore it.
+func (s *ProductService) RestoreProduct(ctx context.Context, id, userID string, admin bool) (_ *models.Product, err error) {
+	ctx, span := tracing.Start(ctx, "ProductService.RestoreProduct")
+	defer func() { tracing.End(span, err) }()
+
+	product, err := s.productRepo.GetTrashedByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if product.CreatedBy != userID && !admin {
+		return nil, ErrNotProductOwner
+	}
+
+	return s.productRepo.Restore(ctx, id)
+}
+
+// PurgeTrash permanently deletes the products that have been in the trash
+// for longer than the configured retention, along with their stored images,
+// and returns how many were purged
+func (s *ProductService) PurgeTrash(ctx context.Context) (purged int, err error) {
+	ctx, span := tracing.Start(ctx, "ProductService.PurgeTrash")
+	defer func() { tracing.End(span, err) }()
+
+	before := time.Now().Add(-s.config.TrashRetention)
+	for {
+		products, err := s.productRepo.ListTrashedBefore(ctx, before, purgeBatchSize)
+		if err != nil {
+			return purged, err
+		}
+
+		for _, product := range products {
+			ok, err := s.purge(ctx, product.ID, before)
+			if err != nil {
+				return purged, err
+			}
+			if ok {
+				purged++
+			}
+		}
+
+		if len(products) < purgeBatchSize {
+			return purged, nil
+		}
+	}
+}
+
+// purge permanently deletes a trashed product and its stored images and
+// reports whether it was deleted, which it is not if it was restored in the
+// meantime
+func (s *ProductService) purge(ctx context.Context, id string, trashedBefore time.Time) (bool, error) {
+	// Image records are removed with the product, so collect their objects
+	// first
+	paths, err := s.images.objectPaths(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	if err := s.productRepo.Purge(ctx, id, trashedBefore); err != nil {
+		return false, err
+	}
+
+	// PostgREST does not report affected rows for deletes, so check that the
+	// product is really gone, neither restored nor trashed again
+	if _, err := s.productRepo.GetByID(ctx, id); !errors.Is(err, repository.ErrNotFound) {
+		return false, err
+	}
+	if _, err := s.productRepo.GetTrashedByID(ctx, id); !errors.Is(err, repository.ErrNotFound) {
+		return false, err
+	}
+
+	s.images.removeObjects(ctx, paths)
+	return true, nil
+}
+
+// checkIfMatch compares an If-Match header value with the ETag of the
+// product as it was read and returns the version a conditional write must
+// still find, or nil for an unconditional write
+func checkIfMatch(current *models.Product, ifMatch string) (*time.Time, error) {
+	if ifMatch == "" {
+		return nil, nil
+	}
+
+	if !utils.MatchETag(ifMatch, current.ETag(), false) {
+		return nil, fmt.Errorf("product %w", repository.ErrPreconditionFailed)
+	}
+
+	return &current.UpdatedAt, nil
+}
+
+// normalizeUpdate converts the price of an update into major units and the
+// tags and option axes into their slug form, and validates them along with
+// the category
+func (s *ProductService) normalizeUpdate(ctx context.Context, id string, req *models.UpdateProductRequest) error {
+	currency := strings.ToUpper(*req.Currency)
+	price, err := priceFromRequest(s.config, *req.Price, currency)
+	if err != nil {
+		return err
+	}
+	req.Currency, req.Price = &currency, &price
+	return s.checkUpdate(ctx, id, req)
+}
+
+// checkUpdate puts the tags and option axes of an update with its price in
+// major units into their slug form, and validates them along with the
+// category
+func (s *ProductService) checkUpdate(ctx context.Context, id string, req *models.UpdateProductRequest) error {
+	req.Tags = models.NormalizeTags(req.Tags)
+	if req.OptionAxes != nil {
+		axes := models.NormalizeOptionAxes(*req.OptionAxes)
+		req.OptionAxes = &axes
+	}
+
+	if err := req.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", utils.ErrValidation, err)
+	}
+	if err := s.categories.CheckExists(ctx, *req.CategoryID); err != nil {
+		return err
+	}
+	if req.OptionAxes != nil {
+		return s.variants.checkOptionAxes(ctx, id, *req.OptionAxes)
+	}
+	return nil
+}
+
+// priceFromRequest converts a request price into major units according to
+// the configured price format
+func priceFromRequest(cfg *config.Config, price decimal.Decimal, currency string) (decimal.Decimal, error) {
+	if cfg.PriceFormat != money.FormatMinor {
+		return price, nil
+	}
+	major, err := money.FromMinor(price, currency)
+	if err != nil {
+		return decimal.Decimal{}, fmt.Errorf("%w: %v", utils.ErrValidation, err)
+	}
+	return major, nil
+}
+
+// ListProducts lists a page of products matching the query, optionally
+// filtered to a category given by ID or slug and its subcategories and to
+// products with any or all of the given tags. Only published products are
+// listed unless another status is asked for, which lists the user's own
+// products in it, or everyone's for admins. The facets count every matching
+// product, not only the page.
+func (s *ProductService) ListProducts(ctx context.Context, query models.ProductQuery) (_ *models.ProductList, err error) {
+	ctx, span := tracing.Start(ctx, "ProductService.ListProducts")
+	defer func() { tracing.End(span, err) }()
+
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.PageSize < 1 || query.PageSize > 100 {
+		query.PageSize = 10
+	}
+	if query.Currency == "" {
+		query.Currency = s.config.DefaultCurrency
+	}
+	currency, err := money.Lookup(query.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := s.listFilter(ctx, query)
+	if errors.Is(err, repository.ErrNotFound) {
+		return &models.ProductList{
+			Products: []models.Product{},
+			Facets:   buildFacets(models.ProductFacetCounts{}, nil, s.config.FacetPriceBounds, currency.Code),
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	products, err := s.productRepo.List(ctx, query.Page, query.PageSize, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	rates, err := s.config.ExchangeRates.Factors(currency.Code)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := s.productRepo.FacetCounts(ctx, filter, rates, currency.Exponent, s.config.FacetPriceBounds)
+	if err != nil {
+		return nil, err
+	}
+	categories, err := s.categories.byID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.ProductList{
+		Products: products,
+		Facets:   buildFacets(*counts, categories, s.config.FacetPriceBounds, currency.Code),
+	}, nil
+}
+
+// listFilter turns the filters of a listing query into a product filter. It
+// returns ErrNotFound for an unknown category, which matches no products.
+func (s *ProductService) listFilter(ctx context.Context, query models.ProductQuery) (models.ProductFilter, error) {
+	if query.Status == "" {
+		query.Status = models.ProductStatusPublished
+	}
+
+	filter := models.ProductFilter{
+		Tags:         models.NormalizeTags(query.Tags),
+		MatchAllTags: query.MatchAllTags,
+		InStock:      query.InStock,
+		Status:       query.Status,
+	}
+	if query.Status != models.ProductStatusPublished && !query.Admin {
+		filter.CreatedBy = query.UserID
+	}
+	if query.Category != "" {
+		categoryIDs, err := s.categories.SubtreeIDs(ctx, query.Category)
+		if err != nil {
+			return models.ProductFilter{}, err
+		}
+		filter.CategoryIDs = categoryIDs
+	}
+	return filter, nil
+}
+
+// SearchProducts returns a page of the products matching a free-text query,
+// ranked by relevance. Terms match by prefix, and product names also match
+// misspelled queries. Highlights are returned as HTML.
+func (s *ProductService) SearchProducts(ctx context.Context, query string, page, pageSize int) (_ []models.ProductSearchResult, err error) {
+	ctx, span := tracing.Start(ctx, "ProductService.SearchProducts")
+	defer func() { tracing.End(span, err) }()
+
+	query = strings.TrimSpace(query)
+	if query == "" || utf8.RuneCountInString(query) > maxSearchQueryLength {
+		return nil, fmt.Errorf("%w: query must have 1 to %d characters", utils.ErrValidation, maxSearchQueryLength)
+	}
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	results, err := s.productRepo.Search(ctx, query, s.config.SearchMinSimilarity, page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		results[i].NameHighlight = escapeHighlight(results[i].NameHighlight)
+		results[i].Snippet = escapeHighlight(results[i].Snippet)
+	}
+	return results, nil
+}
+
+// escapeHighlight HTML-escapes a highlighted text from the database while
+// keeping the <mark> tags around matched terms
+func escapeHighlight(text string) string {
+	parts := strings.Split(text, highlightStart)
+	for i, part := range parts {
+		inner := strings.Split(part, highlightStop)
+		for j := range inner {
+			inner[j] = html.EscapeString(inner[j])
+		}
+		parts[i] = strings.Join(inner, highlightStop)
+	}
+	return strings.Join(parts, highlightStart)
 }
@@ -0,0 +1,307 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/peterlimg/supabase-e/config"
+	"github.com/peterlimg/supabase-e/internal/models"
+	"github.com/peterlimg/supabase-e/internal/repository"
+	"github.com/peterlimg/supabase-e/pkg/tracing"
+	"github.com/peterlimg/supabase-e/pkg/utils"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	// ErrDuplicateVariant is returned when a variant would share its SKU or
+	// option combination with another variant
+	ErrDuplicateVariant = errors.New("a variant with this SKU or these options already exists")
+
+	// ErrVariantHasStock is returned when deleting a variant that still has
+	// stock on hand or reserved
+	ErrVariantHasStock = errors.New("variant still has stock")
+
+	// ErrProductHasStock is returned when adding the first variant to a
+	// product whose own stock is not zero
+	ErrProductHasStock = errors.New("product stock must be zero before adding variants")
+
+	// ErrVariantsExist is returned when changing the option axes of a product
+	// that has variants
+	ErrVariantsExist = errors.New("option axes cannot change while the product has variants")
+
+	// ErrUnknownImage is returned when a variant refers to an image that is
+	// not an image of its product
+	ErrUnknownImage = errors.New("unknown image")
+)
+
+// ProductVariantService handles product variants
+type ProductVariantService struct {
+	productRepo *repository.ProductRepository
+	variantRepo *repository.ProductVariantRepository
+	imageRepo   *repository.ProductImageRepository
+	config      *config.Config
+}
+
+// NewProductVariantService creates a new product variant service
+func NewProductVariantService(productRepo *repository.ProductRepository, variantRepo *repository.ProductVariantRepository, imageRepo *repository.ProductImageRepository, config *config.Config) *ProductVariantService {
+	return &ProductVariantService{
+		productRepo: productRepo,
+		variantRepo: variantRepo,
+		imageRepo:   imageRepo,
+		config:      config,
+	}
+}
+
+// ListVariants lists the variants of a product. Products that are not
+// visible to the user are not found.
+func (s *ProductVariantService) ListVariants(ctx context.Context, productID, userID string, admin bool) (_ []models.ProductVariant, err error) {
+	ctx, span := tracing.Start(ctx, "ProductVariantService.ListVariants")
+	defer func() { tracing.End(span, err) }()
+
+	product, err := visibleProduct(ctx, s.productRepo, productID, userID, admin)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.variantsOf(ctx, product)
+}
+
+// GetVariant gets a variant of a product. Products that are not visible to
+// the user are not found.
+func (s *ProductVariantService) GetVariant(ctx context.Context, productID, id, userID string, admin bool) (_ *models.ProductVariant, err error) {
+	ctx, span := tracing.Start(ctx, "ProductVariantService.GetVariant")
+	defer func() { tracing.End(span, err) }()
+
+	product, err := visibleProduct(ctx, s.productRepo, productID, userID, admin)
+	if err != nil {
+		return nil, err
+	}
+
+	variant, err := s.variantRepo.GetByID(ctx, productID, id)
+	if err != nil {
+		return nil, err
+	}
+	variant.Currency = product.Currency
+	return variant, nil
+}
+
+// CreateVariant adds a variant to a product. Its options must give a value
+// for each option axis of the product, in a combination no other variant of
+// the product has. Only the owner of the product or an admin may add
+// variants.
+func (s *ProductVariantService) CreateVariant(ctx context.Context, productID string, req models.CreateVariantRequest, userID string, admin bool) (_ *models.ProductVariant, err error) {
+	ctx, span := tracing.Start(ctx, "ProductVariantService.CreateVariant")
+	defer func() { tracing.End(span, err) }()
+
+	product, err := s.productRepo.GetByID(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	if product.CreatedBy != userID && !admin {
+		return nil, ErrNotProductOwner
+	}
+
+	req.SKU = strings.TrimSpace(req.SKU)
+	req.Options = models.NormalizeOptions(req.Options)
+	if req.ImageIDs == nil {
+		req.ImageIDs = []string{}
+	}
+	if req.Price, err = s.normalizePrice(req.Price, product.Currency); err != nil {
+		return nil, err
+	}
+	if err := s.validate(ctx, product, "", req.Options, req.ImageIDs); err != nil {
+		return nil, err
+	}
+
+	variants, err := s.variantRepo.ListByProduct(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	if len(variants) == 0 && (product.StockQuantity != 0 || product.ReservedQuantity != 0) {
+		return nil, ErrProductHasStock
+	}
+
+	variant, err := s.variantRepo.Create(ctx, models.NewProductVariant(productID, req))
+	if errors.Is(err, repository.ErrConflict) {
+		return nil, fmt.Errorf("%w: %v", ErrDuplicateVariant, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.productRepo.Touch(ctx, productID); err != nil {
+		return nil, err
+	}
+
+	variant.Currency = product.Currency
+	return variant, nil
+}
+
+// UpdateVariant replaces the editable fields of a variant on behalf of the
+// product's owner or an admin
+func (s *ProductVariantService) UpdateVariant(ctx context.Context, productID, id string, req models.UpdateVariantRequest, userID string, admin bool) (_ *models.ProductVariant, err error) {
+	ctx, span := tracing.Start(ctx, "ProductVariantService.UpdateVariant")
+	defer func() { tracing.End(span, err) }()
+
+	product, err := s.productRepo.GetByID(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	if product.CreatedBy != userID && !admin {
+		return nil, ErrNotProductOwner
+	}
+	if _, err := s.variantRepo.GetByID(ctx, productID, id); err != nil {
+		return nil, err
+	}
+
+	sku := strings.TrimSpace(*req.SKU)
+	req.SKU = &sku
+	req.Options = models.NormalizeOptions(req.Options)
+	if req.ImageIDs == nil {
+		req.ImageIDs = []string{}
+	}
+	if req.Price, err = s.normalizePrice(req.Price, product.Currency); err != nil {
+		return nil, err
+	}
+	if err := s.validate(ctx, product, id, req.Options, req.ImageIDs); err != nil {
+		return nil, err
+	}
+
+	variant, err := s.variantRepo.Update(ctx, id, req)
+	if errors.Is(err, repository.ErrConflict) {
+		return nil, fmt.Errorf("%w: %v", ErrDuplicateVariant, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.productRepo.Touch(ctx, productID); err != nil {
+		return nil, err
+	}
+
+	variant.Currency = product.Currency
+	return variant, nil
+}
+
+// DeleteVariant deletes a variant of a product. Its stock has to be adjusted
+// to zero first so that the stock ledger stays complete. Only the owner of
+// the product or an admin may delete variants.
+func (s *ProductVariantService) DeleteVariant(ctx context.Context, productID, id, userID string, admin bool) (err error) {
+	ctx, span := tracing.Start(ctx, "ProductVariantService.DeleteVariant")
+	defer func() { tracing.End(span, err) }()
+
+	product, err := s.productRepo.GetByID(ctx, productID)
+	if err != nil {
+		return err
+	}
+	if product.CreatedBy != userID && !admin {
+		return ErrNotProductOwner
+	}
+
+	variant, err := s.variantRepo.GetByID(ctx, productID, id)
+	if err != nil {
+		return err
+	}
+	if variant.StockQuantity != 0 || variant.ReservedQuantity != 0 {
+		return ErrVariantHasStock
+	}
+
+	err = s.variantRepo.Delete(ctx, id)
+	if errors.Is(err, repository.ErrConflict) {
+		return fmt.Errorf("%w: %v", ErrVariantHasStock, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.productRepo.Touch(ctx, productID)
+}
+
+// variantsOf lists the variants of a product with their currency filled in
+func (s *ProductVariantService) variantsOf(ctx context.Context, product *models.Product) ([]models.ProductVariant, error) {
+	variants, err := s.variantRepo.ListByProduct(ctx, product.ID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range variants {
+		variants[i].Currency = product.Currency
+	}
+	return variants, nil
+}
+
+// checkOptionAxes returns ErrVariantsExist if axes differ from the current
+// option axes of a product that has variants
+func (s *ProductVariantService) checkOptionAxes(ctx context.Context, productID string, axes []string) error {
+	product, err := s.productRepo.GetByID(ctx, productID)
+	if err != nil {
+		return err
+	}
+	if strings.Join(axes, ",") == strings.Join(product.OptionAxes, ",") {
+		return nil
+	}
+
+	variants, err := s.variantRepo.ListByProduct(ctx, productID)
+	if err != nil {
+		return err
+	}
+	if len(variants) > 0 {
+		return ErrVariantsExist
+	}
+	return nil
+}
+
+// normalizePrice converts the price override of a variant, if any, into
+// major units and validates it against the product's currency
+func (s *ProductVariantService) normalizePrice(price *decimal.Decimal, currency string) (*decimal.Decimal, error) {
+	if price == nil {
+		return nil, nil
+	}
+	major, err := priceFromRequest(s.config, *price, currency)
+	if err != nil {
+		return nil, err
+	}
+	if err := models.ValidateVariantPrice(&major, currency); err != nil {
+		return nil, fmt.Errorf("%w: %v", utils.ErrValidation, err)
+	}
+	return &major, nil
+}
+
+// validate checks the options and images of a variant of product. The
+// variant with ID skipID, if any, is the one being updated and may keep its
+// own options.
+func (s *ProductVariantService) validate(ctx context.Context, product *models.Product, skipID string, options map[string]string, imageIDs []string) error {
+	if err := models.ValidateOptions(options, product.OptionAxes); err != nil {
+		return fmt.Errorf("%w: %v", utils.ErrValidation, err)
+	}
+
+	variants, err := s.variantRepo.ListByProduct(ctx, product.ID)
+	if err != nil {
+		return err
+	}
+	key := models.OptionsKey(options)
+	for _, v := range variants {
+		if v.ID != skipID && models.OptionsKey(v.Options) == key {
+			return fmt.Errorf("%w: options are taken by %s", ErrDuplicateVariant, v.SKU)
+		}
+	}
+
+	if len(imageIDs) == 0 {
+		return nil
+	}
+	images, err := s.imageRepo.ListByProduct(ctx, product.ID)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(images))
+	for _, image := range images {
+		known[image.ID] = true
+	}
+	for _, id := range imageIDs {
+		if !known[id] {
+			return fmt.Errorf("%w: %w %s", utils.ErrValidation, ErrUnknownImage, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/peterlimg/supabase-e/internal/models"
+	"github.com/peterlimg/supabase-e/internal/repository"
+	"github.com/peterlimg/supabase-e/pkg/tracing"
+	"github.com/peterlimg/supabase-e/pkg/utils"
+)
+
+var (
+	// ErrInsufficientStock is returned for adjustments that would leave the
+	// stock negative or below the reserved quantity
+	ErrInsufficientStock = errors.New("insufficient stock")
+
+	// ErrProductHasVariants is returned when adjusting the stock of a product
+	// directly although its stock is kept per variant
+	ErrProductHasVariants = errors.New("stock of a product with variants is adjusted per variant")
+)
+
+// StockService handles product and variant stock and its movement ledger
+type StockService struct {
+	stockRepo   *repository.StockRepository
+	productRepo *repository.ProductRepository
+	variantRepo *repository.ProductVariantRepository
+}
+
+// NewStockService creates a new stock service
+func NewStockService(stockRepo *repository.StockRepository, productRepo *repository.ProductRepository, variantRepo *repository.ProductVariantRepository) *StockService {
+	return &StockService{
+		stockRepo:   stockRepo,
+		productRepo: productRepo,
+		variantRepo: variantRepo,
+	}
+}
+
+// GetStock gets the current stock of a product. Products that are not
+// visible to the user are not found.
+func (s *StockService) GetStock(ctx context.Context, productID, userID string, admin bool) (_ *models.StockLevel, err error) {
+	ctx, span := tracing.Start(ctx, "StockService.GetStock")
+	defer func() { tracing.End(span, err) }()
+
+	product, err := visibleProduct(ctx, s.productRepo, productID, userID, admin)
+	if err != nil {
+		return nil, err
+	}
+
+	level := product.StockLevel()
+	return &level, nil
+}
+
+// GetVariantStock gets the current stock of a variant of a product.
+// Products that are not visible to the user are not found.
+func (s *StockService) GetVariantStock(ctx context.Context, productID, variantID, userID string, admin bool) (_ *models.StockLevel, err error) {
+	ctx, span := tracing.Start(ctx, "StockService.GetVariantStock")
+	defer func() { tracing.End(span, err) }()
+
+	// Variants of a trashed product are not found either
+	if _, err := visibleProduct(ctx, s.productRepo, productID, userID, admin); err != nil {
+		return nil, err
+	}
+
+	variant, err := s.variantRepo.GetByID(ctx, productID, variantID)
+	if err != nil {
+		return nil, err
+	}
+
+	level := variant.StockLevel()
+	return &level, nil
+}
+
+// AdjustStock changes the stock of a product, or of one of its variants if
+// variantID is set, and records why in the ledger. The stock of a product
+// with variants is the total of its variants and can only be adjusted through
+// them. Concurrent adjustments are applied atomically one after another, and
+// one that would take more than is available fails with ErrInsufficientStock.
+// Only the product's creator or an admin may adjust its stock.
+func (s *StockService) AdjustStock(ctx context.Context, productID, variantID string, req models.AdjustStockRequest, userID string, admin bool) (_ *models.StockMovement, err error) {
+	ctx, span := tracing.Start(ctx, "StockService.AdjustStock")
+	defer func() { tracing.End(span, err) }()
+
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", utils.ErrValidation, err)
+	}
+
+	// Products in the trash keep their stock as it was
+	product, err := s.productRepo.GetByID(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	if product.CreatedBy != userID && !admin {
+		return nil, ErrNotProductOwner
+	}
+
+	if variantID == "" {
+		variants, err := s.variantRepo.ListByProduct(ctx, productID)
+		if err != nil {
+			return nil, err
+		}
+		if len(variants) > 0 {
+			return nil, ErrProductHasVariants
+		}
+	}
+
+	movement, err := s.stockRepo.Adjust(ctx, productID, variantID, req, userID)
+	if errors.Is(err, repository.ErrConflict) {
+		return nil, fmt.Errorf("%w: %v", ErrInsufficientStock, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return movement, nil
+}
+
+// ListMovements lists a page of the stock movements of a product, newest
+// first. Products that are not visible to the user are not found.
+func (s *StockService) ListMovements(ctx context.Context, productID string, page, pageSize int, userID string, admin bool) (_ []models.StockMovement, err error) {
+	ctx, span := tracing.Start(ctx, "StockService.ListMovements")
+	defer func() { tracing.End(span, err) }()
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	// An unknown product is reported as such rather than as an empty ledger
+	if _, err := visibleProduct(ctx, s.productRepo, productID, userID, admin); err != nil {
+		return nil, err
+	}
+
+	return s.stockRepo.ListMovements(ctx, productID, page, pageSize)
+}
+
+// UpdateStockSettings sets the low-stock threshold of a product. Only the
+// product's creator or an admin may change it.
+func (s *StockService) UpdateStockSettings(ctx context.Context, productID string, req models.UpdateStockSettingsRequest, userID string, admin bool) (_ *models.StockLevel, err error) {
+	ctx, span := tracing.Start(ctx, "StockService.UpdateStockSettings")
+	defer func() { tracing.End(span, err) }()
+
+	current, err := s.productRepo.GetByID(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	if current.CreatedBy != userID && !admin {
+		return nil, ErrNotProductOwner
+	}
+
+	product, err := s.stockRepo.SetLowStockThreshold(ctx, productID, *req.LowStockThreshold)
+	if err != nil {
+		return nil, err
+	}
+
+	level := product.StockLevel()
+	return &level, nil
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/peterlimg/supabase-e/config"
+	"github.com/peterlimg/supabase-e/pkg/logger"
+)
+
+// TrashPurger periodically purges products that have been in the trash for
+// longer than the configured retention
+type TrashPurger struct {
+	productService *ProductService
+	interval       time.Duration
+}
+
+// NewTrashPurger creates a new trash purger
+func NewTrashPurger(productService *ProductService, config *config.Config) *TrashPurger {
+	return &TrashPurger{
+		productService: productService,
+		interval:       config.TrashPurgeInterval,
+	}
+}
+
+// Run purges the trash once per interval until ctx is cancelled. It returns
+// right away if purging is disabled.
+func (p *TrashPurger) Run(ctx context.Context) {
+	log := logger.GetLogger("trash")
+	runEvery(ctx, p.interval, func(ctx context.Context) {
+		purged, err := p.productService.PurgeTrash(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Int("purged", purged).Msg("Failed to purge trashed products")
+			return
+		}
+		if purged > 0 {
+			log.Info().Int("purged", purged).Msg("Purged trashed products")
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/nedpals/supabase-go"
+	"github.com/peterlimg/supabase-e/pkg/metrics"
+)
+
+// authMetricsLabel identifies Auth calls in Supabase call metrics
+const authMetricsLabel = "auth"
+
+// AuthError is returned for Auth API calls that fail with a non-2xx status
+type AuthError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+// Error implements error
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("auth returned status %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// InvalidCredentials reports whether Auth rejected the email and password
+// themselves, as opposed to failing for another reason
+func (e *AuthError) InvalidCredentials() bool {
+	if e.StatusCode != http.StatusBadRequest && e.StatusCode != http.StatusUnauthorized {
+		return false
+	}
+	return e.Code == "invalid_grant" || e.Code == "invalid_credentials"
+}
+
+// SignIn exchanges an email and password for a session with the anonymous
+// key. Unlike the client library it keeps the status of failed sign-ins, so
+// that callers can tell rejected credentials from Auth outages.
+func (c *Client) SignIn(ctx context.Context, email, password string) (*supabase.AuthenticatedDetails, error) {
+	body, err := json.Marshal(supabase.UserCredentials{Email: email, Password: password})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode credentials: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/"+supabase.AuthEndpoint+"/token?grant_type=password", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build sign in request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("apikey", c.anonKey)
+
+	start := time.Now()
+	details, err := c.doSignIn(req)
+	metrics.ObserveSupabaseCall(authMetricsLabel, "SignIn", start, err)
+	return details, err
+}
+
+// doSignIn sends a sign in request and decodes the session or the error
+func (c *Client) doSignIn(req *http.Request) (*supabase.AuthenticatedDetails, error) {
+	resp, err := c.Client.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// Auth reports errors as error_code and msg, and older versions as
+		// error and error_description
+		var body struct {
+			ErrorCode        string `json:"error_code"`
+			Msg              string `json:"msg"`
+			Error            string `json:"error"`
+			ErrorDescription string `json:"error_description"`
+		}
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body)
+		authErr := &AuthError{StatusCode: resp.StatusCode, Code: body.ErrorCode, Message: body.Msg}
+		if authErr.Code == "" {
+			authErr.Code = body.Error
+		}
+		if authErr.Message == "" {
+			authErr.Message = body.ErrorDescription
+		}
+		return nil, authErr
+	}
+
+	var details supabase.AuthenticatedDetails
+	if err := json.NewDecoder(resp.Body).Decode(&details); err != nil {
+		return nil, fmt.Errorf("failed to decode sign in response: %w", err)
+	}
+	return &details, nil
+}
@@ -0,0 +1,183 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nedpals/supabase-go"
+	"github.com/peterlimg/supabase-e/pkg/metrics"
+)
+
+// storageMetricsLabel identifies Storage calls in Supabase call metrics
+const storageMetricsLabel = "storage"
+
+// StorageError is returned for Storage API calls that fail with a non-2xx
+// status
+type StorageError struct {
+	StatusCode int
+	Message    string
+}
+
+// Error implements error
+func (e *StorageError) Error() string {
+	return fmt.Sprintf("storage returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// UploadObject stores data at path in the bucket. Existing objects are not
+// overwritten.
+func (c *Client) UploadObject(ctx context.Context, bucket, path string, data io.Reader, contentType string) error {
+	callCtx, cancel := c.WithTimeout(ctx)
+	defer cancel()
+
+	req, err := c.storageRequest(callCtx, http.MethodPost, "object/"+bucket+"/"+escapePath(path), data)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Cache-Control", "max-age=3600")
+	req.Header.Set("x-upsert", "false")
+
+	start := time.Now()
+	err = c.doStorage(req, nil)
+	metrics.ObserveSupabaseCall(storageMetricsLabel, "UploadObject", start, err)
+	if err != nil {
+		return fmt.Errorf("failed to upload object: %w", err)
+	}
+	return nil
+}
+
+// RemoveObjects deletes the objects at paths from the bucket. Missing
+// objects are ignored.
+func (c *Client) RemoveObjects(ctx context.Context, bucket string, paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	callCtx, cancel := c.WithTimeout(ctx)
+	defer cancel()
+
+	body, err := json.Marshal(map[string][]string{"prefixes": paths})
+	if err != nil {
+		return fmt.Errorf("failed to encode paths: %w", err)
+	}
+	req, err := c.storageRequest(callCtx, http.MethodDelete, "object/"+bucket, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	start := time.Now()
+	err = c.doStorage(req, nil)
+	metrics.ObserveSupabaseCall(storageMetricsLabel, "RemoveObjects", start, err)
+	if err != nil {
+		return fmt.Errorf("failed to remove objects: %w", err)
+	}
+	return nil
+}
+
+// SignedURLs creates URLs granting access to private objects for expiresIn,
+// keyed by object path
+func (c *Client) SignedURLs(ctx context.Context, bucket string, paths []string, expiresIn time.Duration) (map[string]string, error) {
+	urls := make(map[string]string, len(paths))
+	if len(paths) == 0 {
+		return urls, nil
+	}
+
+	callCtx, cancel := c.WithTimeout(ctx)
+	defer cancel()
+
+	body, err := json.Marshal(map[string]interface{}{
+		"expiresIn": int(expiresIn.Seconds()),
+		"paths":     paths,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode paths: %w", err)
+	}
+	req, err := c.storageRequest(callCtx, http.MethodPost, "object/sign/"+bucket, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var signed []struct {
+		Path      string  `json:"path"`
+		SignedURL *string `json:"signedURL"`
+		Error     *string `json:"error"`
+	}
+	start := time.Now()
+	err = c.doStorage(req, &signed)
+	metrics.ObserveSupabaseCall(storageMetricsLabel, "SignedURLs", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign object URLs: %w", err)
+	}
+
+	for _, s := range signed {
+		if s.SignedURL != nil {
+			urls[s.Path] = c.baseURL + "/" + supabase.StorageEndpoint + *s.SignedURL
+		}
+	}
+	return urls, nil
+}
+
+// PublicURL returns the URL of an object in a public bucket
+func (c *Client) PublicURL(bucket, path string) string {
+	return c.baseURL + "/" + supabase.StorageEndpoint + "/object/public/" + bucket + "/" + escapePath(path)
+}
+
+// storageRequest builds a Storage API request authenticated with the service
+// key
+func (c *Client) storageRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+"/"+supabase.StorageEndpoint+"/"+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build storage request: %w", err)
+	}
+	req.Header.Set("apikey", c.serviceKey)
+	req.Header.Set("Authorization", "Bearer "+c.serviceKey)
+	return req, nil
+}
+
+// doStorage sends a Storage API request and decodes a successful JSON
+// response into result if it is not nil
+func (c *Client) doStorage(req *http.Request, result interface{}) error {
+	resp, err := c.ServiceClient.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var body struct {
+			Message string `json:"message"`
+			Error   string `json:"error"`
+		}
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body)
+		if body.Message == "" {
+			body.Message = body.Error
+		}
+		return &StorageError{StatusCode: resp.StatusCode, Message: body.Message}
+	}
+
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode storage response: %w", err)
+	}
+	return nil
+}
+
+// escapePath escapes each segment of an object path
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
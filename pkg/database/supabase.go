@@ -1,14 +1,28 @@
 package database
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
 	"github.com/nedpals/supabase-go"
 	"github.com/peterlimg/supabase-e/config"
+	"github.com/peterlimg/supabase-e/pkg/resilience"
+	"github.com/peterlimg/supabase-e/pkg/tracing"
 )
 
 // Client represents a Supabase client
 type Client struct {
 	*supabase.Client
 	ServiceClient *supabase.Client
+	Breakers      *resilience.Breakers
+
+	baseURL     string
+	anonKey     string
+	serviceKey  string
+	callTimeout time.Duration
 }
 
 // NewSupabaseClient creates a new Supabase client
@@ -19,16 +33,77 @@ func NewSupabaseClient(cfg *config.Config) *Client {
 	// Create service client with service key (for server-side operations)
 	serviceClient := supabase.CreateClient(cfg.SupabaseURL, cfg.SupabaseServiceKey)
 
+	// Trace every outbound Auth, Storage and PostgREST call and propagate the
+	// trace context to Supabase. Retries and breakers sit on top so that each
+	// attempt gets its own span; both clients share the same breakers.
+	breakers := resilience.NewBreakers(cfg.BreakerFailureThreshold, cfg.BreakerOpenTimeout)
+	policy := resilience.RetryPolicy{
+		MaxRetries: cfg.SupabaseMaxRetries,
+		BaseDelay:  cfg.SupabaseRetryBaseDelay,
+		MaxDelay:   cfg.SupabaseRetryMaxDelay,
+	}
+	for _, c := range []*supabase.Client{client, serviceClient} {
+		c.HTTPClient.Transport = resilience.Transport(tracing.Transport(c.HTTPClient.Transport), breakers, policy)
+		c.DB.Transport.Parent = resilience.Transport(tracing.Transport(c.DB.Transport.Parent), breakers, policy)
+	}
+
 	return &Client{
 		Client:        client,
 		ServiceClient: serviceClient,
+		Breakers:      breakers,
+		baseURL:       strings.TrimSuffix(cfg.SupabaseURL, "/"),
+		anonKey:       cfg.SupabaseKey,
+		serviceKey:    cfg.SupabaseServiceKey,
+		callTimeout:   cfg.SupabaseTimeout,
 	}
 }
 
+// WithTimeout derives a context bounded by the configured per-call timeout.
+// The parent's own deadline still applies if it is earlier.
+func (c *Client) WithTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.callTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.callTimeout)
+}
+
 // Health checks if the Supabase connection is healthy
-func (c *Client) Health() error {
-	// Simple health check by querying a system table
-	// var result []map[string]interface{}
-	// err := c.ServiceClient.DB.From("").Select("*").Limit(1).Execute(&result)
+func (c *Client) Health(ctx context.Context) error {
+	if err := c.CheckPostgREST(ctx); err != nil {
+		return err
+	}
+	return c.CheckAuth(ctx)
+}
+
+// CheckPostgREST probes the PostgREST endpoint
+func (c *Client) CheckPostgREST(ctx context.Context) error {
+	return c.probe(ctx, supabase.RestEndpoint+"/")
+}
+
+// CheckAuth probes the Supabase Auth health endpoint
+func (c *Client) CheckAuth(ctx context.Context) error {
+	return c.probe(ctx, supabase.AuthEndpoint+"/health")
+}
+
+// probe issues an authenticated GET against the given Supabase path and
+// treats any non-2xx response as unhealthy
+func (c *Client) probe(ctx context.Context, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/"+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build probe request: %w", err)
+	}
+	req.Header.Set("apikey", c.serviceKey)
+	req.Header.Set("Authorization", "Bearer "+c.serviceKey)
+
+	resp, err := c.ServiceClient.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("probe %s failed: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("probe %s returned status %d", path, resp.StatusCode)
+	}
+
 	return nil
 }
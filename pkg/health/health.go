@@ -0,0 +1,173 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/peterlimg/supabase-e/pkg/logger"
+)
+
+// Status values reported for checks and for the overall report
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// CheckFunc probes a single dependency and returns an error if it is unhealthy
+type CheckFunc func(ctx context.Context) error
+
+// CheckResult is the outcome of a single check. Error only says how a check
+// failed, since health endpoints are public; the cause is logged.
+type CheckResult struct {
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Latency   string    `json:"latency"`
+	CheckedAt time.Time `json:"checked_at"`
+	Cached    bool      `json:"cached"`
+}
+
+// Report is the aggregated outcome of all registered checks
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Healthy reports whether every check passed
+func (r Report) Healthy() bool {
+	return r.Status == StatusUp
+}
+
+// check is a registered check together with its cached result
+type check struct {
+	name    string
+	fn      CheckFunc
+	timeout time.Duration
+	ttl     time.Duration
+
+	mu     sync.Mutex
+	result *CheckResult
+}
+
+// Registry runs registered dependency checks, enforcing per-check timeouts and
+// caching results so that frequent probes do not hammer upstreams
+type Registry struct {
+	timeout      time.Duration
+	ttl          time.Duration
+	shuttingDown atomic.Bool
+
+	mu     sync.RWMutex
+	checks []*check
+}
+
+// NewRegistry creates a registry with default timeout and cache TTL applied
+// to every check
+func NewRegistry(timeout, ttl time.Duration) *Registry {
+	return &Registry{
+		timeout: timeout,
+		ttl:     ttl,
+	}
+}
+
+// Register adds a named check to the registry
+func (r *Registry) Register(name string, fn CheckFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, &check{
+		name:    name,
+		fn:      fn,
+		timeout: r.timeout,
+		ttl:     r.ttl,
+	})
+	sort.Slice(r.checks, func(i, j int) bool { return r.checks[i].name < r.checks[j].name })
+}
+
+// SetShuttingDown marks the service as draining; readiness fails from then on
+func (r *Registry) SetShuttingDown() {
+	r.shuttingDown.Store(true)
+}
+
+// ShuttingDown reports whether the service is draining
+func (r *Registry) ShuttingDown() bool {
+	return r.shuttingDown.Load()
+}
+
+// Run executes all checks concurrently and aggregates their results
+func (r *Registry) Run(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := make([]*check, len(r.checks))
+	copy(checks, r.checks)
+	r.mu.RUnlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *check) {
+			defer wg.Done()
+			results[i] = c.run(ctx)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Checks: make(map[string]CheckResult, len(checks))}
+	for i, c := range checks {
+		report.Checks[c.name] = results[i]
+		if results[i].Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+
+	if r.ShuttingDown() {
+		report.Status = StatusDown
+		report.Checks["shutdown"] = CheckResult{
+			Status:    StatusDown,
+			Error:     "server is shutting down",
+			CheckedAt: time.Now(),
+		}
+	}
+
+	return report
+}
+
+// run executes the check or returns its cached result if still fresh
+func (c *check) run(ctx context.Context) CheckResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.result != nil && time.Since(c.result.CheckedAt) < c.ttl {
+		cached := *c.result
+		cached.Cached = true
+		return cached
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.fn(checkCtx)
+	result := CheckResult{
+		Status:    StatusUp,
+		Latency:   time.Since(start).String(),
+		CheckedAt: time.Now(),
+	}
+	if err != nil {
+		log := logger.GetLogger("health")
+		log.Warn().Err(err).Str("check", c.name).Msg("Health check failed")
+		result.Status = StatusDown
+		result.Error = "check failed"
+		if errors.Is(err, context.DeadlineExceeded) {
+			result.Error = "check timed out"
+		}
+	}
+
+	// A caller that went away says nothing about the dependency, so the
+	// result is not cached for later probes
+	if ctx.Err() == nil {
+		c.result = &result
+	}
+	return result
+}
@@ -0,0 +1,126 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInProgress is returned when a request with the same key is still
+	// being processed
+	ErrInProgress = errors.New("a request with this idempotency key is still in progress")
+
+	// ErrFingerprintMismatch is returned when a key is reused for a
+	// different request
+	ErrFingerprintMismatch = errors.New("idempotency key was already used for a different request")
+)
+
+// Record is the stored outcome of a request
+type Record struct {
+	Fingerprint string
+	Completed   bool
+	StatusCode  int
+	Header      http.Header
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+// Store keeps idempotency records. The in-memory store suits single
+// instances; multi-instance deployments plug in a shared implementation.
+type Store interface {
+	// Begin claims key for a request with the given fingerprint. It returns
+	// the completed record to replay, nil if the caller now owns the key, or
+	// ErrInProgress / ErrFingerprintMismatch.
+	Begin(ctx context.Context, key, fingerprint string, ttl time.Duration) (*Record, error)
+	// Complete stores the response for a claimed key
+	Complete(ctx context.Context, key string, record Record) error
+	// Release drops a claimed key so that the request can be retried
+	Release(ctx context.Context, key string) error
+}
+
+// MemoryStore is an in-process Store
+type MemoryStore struct {
+	mu        sync.Mutex
+	records   map[string]*Record
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records:   map[string]*Record{},
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// sweepInterval controls how often expired records are dropped
+const sweepInterval = time.Minute
+
+// Begin implements Store
+func (s *MemoryStore) Begin(_ context.Context, key, fingerprint string, ttl time.Duration) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) > sweepInterval {
+		s.sweep(now)
+	}
+
+	// Expired records may outlive their TTL until the next sweep
+	if rec, ok := s.records[key]; ok && now.After(rec.ExpiresAt) {
+		delete(s.records, key)
+	}
+
+	if rec, ok := s.records[key]; ok {
+		switch {
+		case rec.Fingerprint != fingerprint:
+			return nil, ErrFingerprintMismatch
+		case !rec.Completed:
+			return nil, ErrInProgress
+		}
+		replay := *rec
+		return &replay, nil
+	}
+
+	s.records[key] = &Record{Fingerprint: fingerprint, ExpiresAt: now.Add(ttl)}
+	return nil, nil
+}
+
+// Complete implements Store
+func (s *MemoryStore) Complete(_ context.Context, key string, record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.records[key]
+	if !ok {
+		return nil
+	}
+	record.Completed = true
+	record.Fingerprint = rec.Fingerprint
+	record.ExpiresAt = rec.ExpiresAt
+	s.records[key] = &record
+	return nil
+}
+
+// Release implements Store
+func (s *MemoryStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+// sweep drops expired records. Callers must hold s.mu.
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, rec := range s.records {
+		if now.After(rec.ExpiresAt) {
+			delete(s.records, key)
+		}
+	}
+	s.lastSweep = now
+}
@@ -0,0 +1,180 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"sort"
+
+	"golang.org/x/image/draw"
+
+	// Register the decoders of the remaining supported upload formats
+	_ "golang.org/x/image/webp"
+	_ "image/gif"
+)
+
+var (
+	// ErrUnsupportedFormat is returned for images that cannot be decoded
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+
+	// ErrTooManyPixels is returned for images whose dimensions exceed the
+	// configured limit, guarding against decompression bombs
+	ErrTooManyPixels = errors.New("image dimensions are too large")
+)
+
+// jpegQuality is the quality of generated JPEG variants
+const jpegQuality = 85
+
+// Variant is a resized copy of an image
+type Variant struct {
+	Width       int
+	Height      int
+	ContentType string
+	Ext         string
+	Data        []byte
+}
+
+// Processor strips metadata from uploaded images and generates resized
+// variants of them
+type Processor struct {
+	widths    []int
+	maxPixels int
+}
+
+// NewProcessor creates a processor generating variants of the given widths.
+// Images with more than maxPixels pixels are rejected.
+func NewProcessor(widths []int, maxPixels int) *Processor {
+	sorted := append([]int(nil), widths...)
+	sort.Ints(sorted)
+	return &Processor{
+		widths:    sorted,
+		maxPixels: maxPixels,
+	}
+}
+
+// Process returns the image with its metadata stripped together with one
+// variant per configured width narrower than the image. Variants are upright
+// regardless of the EXIF orientation, contain no metadata, and are encoded as
+// JPEG, or as PNG if the image has transparency.
+func (p *Processor) Process(data []byte, contentType string) ([]byte, []Variant, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+	if p.maxPixels > 0 && cfg.Width*cfg.Height > p.maxPixels {
+		return nil, nil, fmt.Errorf("%w: %dx%d", ErrTooManyPixels, cfg.Width, cfg.Height)
+	}
+
+	original, err := StripMetadata(data, contentType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+
+	if len(p.widths) == 0 {
+		return original, nil, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+
+	orientation := 1
+	if contentType == "image/jpeg" {
+		orientation = jpegOrientation(data)
+	}
+
+	// Widths refer to the displayed image, which is transposed for the
+	// orientations that rotate by 90 degrees
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	if orientation >= 5 {
+		width, height = height, width
+	}
+
+	var variants []Variant
+	for _, w := range p.widths {
+		if w <= 0 || w >= width {
+			continue
+		}
+		h := (height*w + width/2) / width
+		if h < 1 {
+			h = 1
+		}
+
+		variant, err := encode(orient(resize(img, w, h, orientation), orientation))
+		if err != nil {
+			return nil, nil, err
+		}
+		variant.Width, variant.Height = w, h
+		variants = append(variants, variant)
+	}
+
+	return original, variants, nil
+}
+
+// resize scales img so that it measures w by h once oriented
+func resize(img image.Image, w, h, orientation int) *image.NRGBA {
+	if orientation >= 5 {
+		w, h = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return dst
+}
+
+// orient applies an EXIF orientation to img
+func orient(img *image.NRGBA, orientation int) *image.NRGBA {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // rotated 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90 clockwise
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90 counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			dst.SetNRGBA(dx, dy, img.NRGBAAt(x, y))
+		}
+	}
+	return dst
+}
+
+// encode encodes a variant as JPEG, or as PNG if it has transparency
+func encode(img *image.NRGBA) (Variant, error) {
+	var buf bytes.Buffer
+	if img.Opaque() {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return Variant{}, fmt.Errorf("failed to encode variant: %w", err)
+		}
+		return Variant{ContentType: "image/jpeg", Ext: ".jpg", Data: buf.Bytes()}, nil
+	}
+
+	if err := png.Encode(&buf, img); err != nil {
+		return Variant{}, fmt.Errorf("failed to encode variant: %w", err)
+	}
+	return Variant{ContentType: "image/png", Ext: ".png", Data: buf.Bytes()}, nil
+}
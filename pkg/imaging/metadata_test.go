@@ -0,0 +1,369 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+// jpegSegment builds a JPEG marker segment holding payload
+func jpegSegment(marker byte, payload []byte) []byte {
+	segment := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// jpegImage builds a JPEG from the given segments followed by a short scan
+func jpegImage(segments ...[]byte) []byte {
+	data := []byte{0xFF, jpegSOI}
+	for _, segment := range segments {
+		data = append(data, segment...)
+	}
+	data = append(data, jpegSegment(jpegSOS, []byte{1, 2, 3, 4})...)
+	return append(data, 0xAB, 0xCD, 0xFF, 0xD9)
+}
+
+// exifBlock builds an EXIF block whose IFD0 holds a camera model and, if
+// orientation is not zero, an orientation tag
+func exifBlock(order binary.ByteOrder, orientation int) []byte {
+	tiff := make([]byte, 8)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 0x2a)
+	order.PutUint32(tiff[4:], 8)
+
+	entries := [][3]uint16{{0x0110, 2, 0}} // model, ASCII
+	if orientation != 0 {
+		entries = append(entries, [3]uint16{0x0112, 3, uint16(orientation)})
+	}
+	ifd := make([]byte, 2+12*len(entries)+4)
+	order.PutUint16(ifd, uint16(len(entries)))
+	for i, entry := range entries {
+		e := ifd[2+12*i:]
+		order.PutUint16(e, entry[0])
+		order.PutUint16(e[2:], entry[1])
+		order.PutUint32(e[4:], 1)
+		order.PutUint16(e[8:], entry[2])
+	}
+	return append([]byte("Exif\x00\x00"), append(tiff, ifd...)...)
+}
+
+// jpegSegments lists the markers of the segments before the scan
+func jpegSegments(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var markers []byte
+	for i := 2; i+4 <= len(data); {
+		marker := data[i+1]
+		if marker == jpegSOS {
+			return markers
+		}
+		markers = append(markers, marker)
+		i += 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+	}
+	t.Fatalf("no scan in %x", data)
+	return nil
+}
+
+func TestStripJPEGOrientation(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+		for orientation := 1; orientation <= 8; orientation++ {
+			t.Run(order.String()+"/"+strconv.Itoa(orientation), func(t *testing.T) {
+				input := jpegImage(
+					jpegSegment(0xE0, []byte("JFIF\x00\x01\x02")),
+					jpegSegment(jpegAPP1, exifBlock(order, orientation)),
+					jpegSegment(0xDB, []byte{0, 1, 2}),
+				)
+
+				out, err := stripJPEG(input)
+				if err != nil {
+					t.Fatalf("stripJPEG() error = %v", err)
+				}
+
+				want := []byte{0xE0, 0xDB}
+				if orientation > 1 {
+					want = []byte{jpegAPP1, 0xE0, 0xDB}
+				}
+				if got := jpegSegments(t, out); !bytes.Equal(got, want) {
+					t.Errorf("segments = %x, want %x", got, want)
+				}
+				if got := jpegOrientation(out); got != orientation {
+					t.Errorf("orientation = %d, want %d", got, orientation)
+				}
+				if !bytes.HasSuffix(out, input[len(input)-12:]) {
+					t.Errorf("scan was not copied as is")
+				}
+			})
+		}
+	}
+}
+
+func TestStripJPEG(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []byte
+		segments []byte
+		err      bool
+	}{
+		{
+			name:     "no metadata",
+			input:    jpegImage(jpegSegment(0xE0, []byte("JFIF\x00"))),
+			segments: []byte{0xE0},
+		},
+		{
+			name: "exif without orientation, xmp and iptc",
+			input: jpegImage(
+				jpegSegment(jpegAPP1, exifBlock(binary.BigEndian, 0)),
+				jpegSegment(jpegAPP1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>")),
+				jpegSegment(jpegAPP13, []byte("Photoshop 3.0\x00")),
+				jpegSegment(0xC0, []byte{8, 0, 1, 0, 1}),
+			),
+			segments: []byte{0xC0},
+		},
+		{
+			name:     "out of range orientation",
+			input:    jpegImage(jpegSegment(jpegAPP1, exifBlock(binary.BigEndian, 9))),
+			segments: []byte{},
+		},
+		{
+			name:     "fill bytes",
+			input:    append([]byte{0xFF, jpegSOI, 0xFF, 0xFF}, jpegImage(jpegSegment(0xE0, []byte{0}))[2:]...),
+			segments: []byte{0xE0},
+		},
+		{
+			name:     "empty segment",
+			input:    jpegImage(jpegSegment(0xFE, nil)),
+			segments: []byte{0xFE},
+		},
+		{name: "empty", input: nil, err: true},
+		{name: "no start of image", input: []byte{0xFF, 0xD9, 0xFF, 0xDA, 0, 2}, err: true},
+		{name: "no scan", input: []byte{0xFF, jpegSOI, 0xFF, 0xE0, 0, 3, 0}, err: true},
+		{name: "missing marker", input: []byte{0xFF, jpegSOI, 0x00, 0xE0, 0, 2, 0xFF, jpegSOS, 0, 2}, err: true},
+		{name: "length below two", input: []byte{0xFF, jpegSOI, 0xFF, 0xE0, 0, 1, 0xFF, jpegSOS, 0, 2}, err: true},
+		{name: "length past end", input: []byte{0xFF, jpegSOI, 0xFF, 0xE0, 0, 9, 0}, err: true},
+		{name: "truncated marker", input: []byte{0xFF, jpegSOI, 0xFF}, err: true},
+		{
+			// The orientation cannot be read, but the segment is still dropped
+			name:     "truncated exif",
+			input:    jpegImage(jpegSegment(jpegAPP1, exifBlock(binary.BigEndian, 6)[:20])),
+			segments: []byte{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := stripJPEG(tt.input)
+			if tt.err {
+				if !errors.Is(err, errMalformed) {
+					t.Fatalf("stripJPEG() error = %v, want %v", err, errMalformed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("stripJPEG() error = %v", err)
+			}
+			if got := jpegSegments(t, out); !bytes.Equal(got, tt.segments) {
+				t.Errorf("segments = %x, want %x", got, tt.segments)
+			}
+		})
+	}
+}
+
+func TestExifOrientation(t *testing.T) {
+	tests := []struct {
+		name string
+		exif []byte
+		want int
+	}{
+		{"big endian", exifBlock(binary.BigEndian, 3), 3},
+		{"little endian", exifBlock(binary.LittleEndian, 8), 8},
+		{"no tag", exifBlock(binary.BigEndian, 0), 0},
+		{"too short", exifBlock(binary.BigEndian, 3)[:12], 0},
+		{"not exif", append([]byte("Exig\x00\x00"), exifBlock(binary.BigEndian, 3)[6:]...), 0},
+		{"bad byte order", append([]byte("Exif\x00\x00XX"), exifBlock(binary.BigEndian, 3)[8:]...), 0},
+		{"ifd past end", append([]byte("Exif\x00\x00MM\x00\x2a\xff\xff\xff\x00"), make([]byte, 8)...), 0},
+		{"entries past end", exifBlock(binary.BigEndian, 3)[:30], 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exifOrientation(tt.exif); got != tt.want {
+				t.Errorf("exifOrientation() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// pngChunk builds a PNG chunk with a dummy CRC
+func pngChunk(kind string, data []byte) []byte {
+	chunk := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	copy(chunk[4:], kind)
+	chunk = append(chunk, data...)
+	return append(chunk, 0xDE, 0xAD, 0xBE, 0xEF)
+}
+
+// concat joins byte slices
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, part := range parts {
+		out = append(out, part...)
+	}
+	return out
+}
+
+func TestStripPNG(t *testing.T) {
+	ihdr := pngChunk("IHDR", make([]byte, 13))
+	idat := pngChunk("IDAT", []byte{1, 2, 3})
+	iend := pngChunk("IEND", nil)
+
+	tests := []struct {
+		name  string
+		input []byte
+		want  []byte
+		err   bool
+	}{
+		{
+			name:  "no metadata",
+			input: concat([]byte(pngSignature), ihdr, idat, iend),
+			want:  concat([]byte(pngSignature), ihdr, idat, iend),
+		},
+		{
+			name: "metadata chunks",
+			input: concat([]byte(pngSignature), ihdr,
+				pngChunk("eXIf", []byte("MM\x00\x2a")),
+				pngChunk("tEXt", []byte("Author\x00someone")),
+				pngChunk("zTXt", []byte("c\x00\x00x")),
+				pngChunk("iTXt", []byte("k\x00\x00\x00\x00\x00v")),
+				pngChunk("tIME", make([]byte, 7)),
+				idat, iend),
+			want: concat([]byte(pngSignature), ihdr, idat, iend),
+		},
+		{
+			name:  "odd chunk sizes",
+			input: concat([]byte(pngSignature), ihdr, pngChunk("tEXt", []byte("a")), pngChunk("IDAT", []byte{1}), pngChunk("tEXt", []byte("abc")), iend),
+			want:  concat([]byte(pngSignature), ihdr, pngChunk("IDAT", []byte{1}), iend),
+		},
+		{
+			name:  "unknown ancillary chunk",
+			input: concat([]byte(pngSignature), ihdr, pngChunk("gAMA", []byte{0, 0, 0, 1}), iend),
+			want:  concat([]byte(pngSignature), ihdr, pngChunk("gAMA", []byte{0, 0, 0, 1}), iend),
+		},
+		{name: "empty", input: nil, err: true},
+		{name: "bad signature", input: concat([]byte("\x89PNG\r\n\x1a\x00"), ihdr), err: true},
+		{name: "truncated chunk header", input: concat([]byte(pngSignature), ihdr, []byte{0, 0, 0}), err: true},
+		{name: "missing crc", input: concat([]byte(pngSignature), ihdr[:len(ihdr)-4]), err: true},
+		{name: "length past end", input: concat([]byte(pngSignature), []byte{0xFF, 0xFF, 0xFF, 0xFF}, []byte("IDAT")), err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := stripPNG(tt.input)
+			if tt.err {
+				if !errors.Is(err, errMalformed) {
+					t.Fatalf("stripPNG() error = %v, want %v", err, errMalformed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("stripPNG() error = %v", err)
+			}
+			if !bytes.Equal(out, tt.want) {
+				t.Errorf("stripPNG() = %x, want %x", out, tt.want)
+			}
+		})
+	}
+}
+
+// webpChunk builds a RIFF chunk, padded to an even size
+func webpChunk(fourCC string, data []byte) []byte {
+	chunk := make([]byte, 8, 8+len(data)+1)
+	copy(chunk, fourCC)
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(len(data)))
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+// webpImage builds a WebP file from the given chunks
+func webpImage(chunks ...[]byte) []byte {
+	data := concat(append([][]byte{[]byte("RIFF\x00\x00\x00\x00WEBP")}, chunks...)...)
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(data)-8))
+	return data
+}
+
+func TestStripWebP(t *testing.T) {
+	vp8x := func(flags byte) []byte {
+		return webpChunk("VP8X", []byte{flags, 0, 0, 0, 1, 0, 0, 1, 0, 0})
+	}
+	vp8 := webpChunk("VP8 ", []byte{1, 2, 3, 4, 5})
+
+	tests := []struct {
+		name  string
+		input []byte
+		want  []byte
+		err   bool
+	}{
+		{
+			name:  "simple format",
+			input: webpImage(vp8),
+			want:  webpImage(vp8),
+		},
+		{
+			name:  "extended format with metadata",
+			input: webpImage(vp8x(0x10|webpFlagEXIF|webpFlagXMP), webpChunk("ICCP", []byte{1, 2}), vp8, webpChunk("EXIF", []byte("MM\x00\x2a\x00")), webpChunk("XMP ", []byte("<x/>"))),
+			want:  webpImage(vp8x(0x10), webpChunk("ICCP", []byte{1, 2}), vp8),
+		},
+		{
+			name:  "odd chunk sizes",
+			input: webpImage(vp8x(webpFlagEXIF), webpChunk("EXIF", []byte{1}), webpChunk("VP8L", []byte{1, 2, 3})),
+			want:  webpImage(vp8x(0), webpChunk("VP8L", []byte{1, 2, 3})),
+		},
+		{
+			name:  "empty vp8x",
+			input: webpImage(webpChunk("VP8X", nil), vp8),
+			want:  webpImage(webpChunk("VP8X", nil), vp8),
+		},
+		{name: "empty", input: nil, err: true},
+		{name: "not riff", input: concat([]byte("RIFX\x00\x00\x00\x00WEBP"), vp8), err: true},
+		{name: "not webp", input: concat([]byte("RIFF\x00\x00\x00\x00WAVE"), vp8), err: true},
+		{name: "truncated chunk header", input: concat(webpImage(vp8), []byte("EXIF")), err: true},
+		{name: "missing padding", input: webpImage(vp8[:len(vp8)-1]), err: true},
+		{name: "size past end", input: webpImage([]byte("EXIF\xff\xff\xff\xff")), err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := append([]byte(nil), tt.input...)
+			out, err := stripWebP(input)
+			if tt.err {
+				if !errors.Is(err, errMalformed) {
+					t.Fatalf("stripWebP() error = %v, want %v", err, errMalformed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("stripWebP() error = %v", err)
+			}
+			if !bytes.Equal(out, tt.want) {
+				t.Errorf("stripWebP() = %x, want %x", out, tt.want)
+			}
+			if !bytes.Equal(input, tt.input) {
+				t.Errorf("stripWebP() modified its input")
+			}
+		})
+	}
+}
+
+func TestStripMetadataUnknownFormat(t *testing.T) {
+	data := []byte("GIF89a")
+	out, err := StripMetadata(data, "image/gif")
+	if err != nil {
+		t.Fatalf("StripMetadata() error = %v", err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Errorf("StripMetadata() = %q, want input unchanged", out)
+	}
+}
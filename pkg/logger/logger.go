@@ -1,30 +1,95 @@
 package logger
 
 import (
+	"io"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"github.com/peterlimg/supabase-e/config"
+)
+
+var (
+	mu              sync.RWMutex
+	baseLevel       = zerolog.InfoLevel
+	componentLevels = map[string]zerolog.Level{}
+	redactor        = NewRedactor(nil)
 )
 
-// Setup initializes the logger with the specified log level
-func Setup(level string) {
+// Setup initializes the global logger from the configuration
+func Setup(cfg *config.Config) {
 	// Parse log level
-	logLevel, err := zerolog.ParseLevel(level)
-	if err != nil {
+	logLevel, err := zerolog.ParseLevel(cfg.LogLevel)
+	if err != nil || cfg.LogLevel == "" {
 		logLevel = zerolog.InfoLevel
 	}
 
+	// Parse per-component levels; the global level must be low enough to let
+	// the most verbose component through
+	levels := map[string]zerolog.Level{}
+	globalLevel := logLevel
+	for component, level := range cfg.LogComponentLevels {
+		l, err := zerolog.ParseLevel(level)
+		if err != nil {
+			continue
+		}
+		levels[component] = l
+		if l < globalLevel {
+			globalLevel = l
+		}
+	}
+
+	mu.Lock()
+	baseLevel = logLevel
+	componentLevels = levels
+	redactor = NewRedactor(cfg.LogRedactFields)
+	mu.Unlock()
+
 	// Configure zerolog
-	zerolog.SetGlobalLevel(logLevel)
+	zerolog.SetGlobalLevel(globalLevel)
 	zerolog.TimeFieldFormat = time.RFC3339
 
-	// Use pretty console writer for development
-	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339})
+	// Select the output destination
+	var out io.Writer = os.Stdout
+	if cfg.LogFile != "" {
+		out = io.MultiWriter(os.Stdout, &lumberjack.Logger{
+			Filename:   cfg.LogFile,
+			MaxSize:    cfg.LogMaxSizeMB,
+			MaxBackups: cfg.LogMaxBackups,
+			MaxAge:     cfg.LogMaxAgeDays,
+			Compress:   true,
+		})
+	}
+
+	// Use pretty console writer for development, raw JSON otherwise
+	if strings.ToLower(cfg.LogFormat) != "json" {
+		out = zerolog.ConsoleWriter{Out: out, TimeFormat: time.RFC3339, NoColor: cfg.LogFile != ""}
+	}
+
+	// Redact sensitive fields before anything is written
+	log.Logger = zerolog.New(&redactWriter{out: out}).Level(logLevel).With().Timestamp().Logger()
 }
 
 // GetLogger returns a logger with the given component name
 func GetLogger(component string) zerolog.Logger {
-	return log.With().Str("component", component).Logger()
+	mu.RLock()
+	level, ok := componentLevels[component]
+	if !ok {
+		level = baseLevel
+	}
+	mu.RUnlock()
+
+	return log.With().Str("component", component).Logger().Level(level)
+}
+
+// GetRedactor returns the redactor configured by Setup
+func GetRedactor() *Redactor {
+	mu.RLock()
+	defer mu.RUnlock()
+	return redactor
 }
@@ -0,0 +1,122 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// RedactedValue replaces the value of every redacted field
+const RedactedValue = "[REDACTED]"
+
+// Redactor masks configured fields and query parameters
+type Redactor struct {
+	fields map[string]struct{}
+}
+
+// NewRedactor creates a redactor for the given field names (case-insensitive)
+func NewRedactor(fields []string) *Redactor {
+	r := &Redactor{fields: make(map[string]struct{}, len(fields))}
+	for _, f := range fields {
+		r.fields[strings.ToLower(f)] = struct{}{}
+	}
+	return r
+}
+
+// IsSensitive reports whether the given field name is redacted
+func (r *Redactor) IsSensitive(name string) bool {
+	_, ok := r.fields[strings.ToLower(name)]
+	return ok
+}
+
+// RedactQuery masks sensitive parameters in a raw URL query string
+func (r *Redactor) RedactQuery(rawQuery string) string {
+	if rawQuery == "" || len(r.fields) == 0 {
+		return rawQuery
+	}
+
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		// Unparseable queries may still carry secrets, so drop them entirely
+		return RedactedValue
+	}
+
+	redacted := false
+	for key := range values {
+		if r.IsSensitive(key) {
+			values[key] = []string{RedactedValue}
+			redacted = true
+		}
+	}
+	if !redacted {
+		return rawQuery
+	}
+
+	return values.Encode()
+}
+
+// redactValue masks sensitive keys in decoded JSON, recursing into objects
+// and arrays
+func (r *Redactor) redactValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for key, child := range val {
+			if r.IsSensitive(key) {
+				val[key] = RedactedValue
+			} else {
+				val[key] = r.redactValue(child)
+			}
+		}
+	case []interface{}:
+		for i, child := range val {
+			val[i] = r.redactValue(child)
+		}
+	}
+	return v
+}
+
+// mayContainSensitive is a cheap pre-check that avoids decoding events which
+// cannot contain any redacted key
+func (r *Redactor) mayContainSensitive(p []byte) bool {
+	lower := bytes.ToLower(p)
+	for field := range r.fields {
+		if bytes.Contains(lower, []byte(`"`+field+`"`)) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactWriter masks sensitive fields in JSON log events before passing them
+// on to the underlying writer
+type redactWriter struct {
+	out io.Writer
+}
+
+// Write implements io.Writer
+func (w *redactWriter) Write(p []byte) (int, error) {
+	r := GetRedactor()
+	if !r.mayContainSensitive(p) {
+		return w.out.Write(p)
+	}
+
+	var event map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+	if err := dec.Decode(&event); err != nil {
+		return w.out.Write(p)
+	}
+
+	r.redactValue(event)
+	data, err := json.Marshal(event)
+	if err != nil {
+		return w.out.Write(p)
+	}
+
+	if _, err := w.out.Write(append(data, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,48 @@
+package mailer
+
+import (
+	"context"
+	"strings"
+
+	"github.com/peterlimg/supabase-e/pkg/logger"
+)
+
+// Message is an email to be delivered
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails. Implementations plug in an SMTP relay or a
+// transactional email provider.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogMailer is a Mailer that only logs messages, for development and for
+// deployments without an email provider
+type LogMailer struct{}
+
+// NewLogMailer creates a new log mailer
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+// Send implements Mailer
+func (m *LogMailer) Send(_ context.Context, msg Message) error {
+	log := logger.GetLogger("mailer")
+	log.Info().Str("to", redactAddress(msg.To)).Str("subject", msg.Subject).Msg("Email not sent, no mailer configured")
+	return nil
+}
+
+// redactAddress masks the local part of an email address for logging, so
+// that the recipient is not written to the logs whatever fields the log
+// redactor is configured with
+func redactAddress(address string) string {
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return logger.RedactedValue
+	}
+	return logger.RedactedValue + address[at:]
+}
@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "supabase_e"
+
+// Registry holds every collector exposed on the metrics endpoint
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequestsTotal counts processed HTTP requests
+	HTTPRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Total number of HTTP requests processed.",
+	}, []string{"method", "route", "status_class"})
+
+	// HTTPRequestDuration observes HTTP request latency
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency in seconds.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status_class"})
+
+	// HTTPRequestsInFlight tracks requests currently being served
+	HTTPRequestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_in_flight",
+		Help:      "Number of HTTP requests currently being served.",
+	})
+
+	// SupabaseCallDuration observes Supabase call latency per repository method
+	SupabaseCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "supabase",
+		Name:      "call_duration_seconds",
+		Help:      "Supabase call latency in seconds per repository method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"repository", "method"})
+
+	// SupabaseCallErrors counts failed Supabase calls per repository method
+	SupabaseCallErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "supabase",
+		Name:      "call_errors_total",
+		Help:      "Total number of failed Supabase calls per repository method.",
+	}, []string{"repository", "method"})
+
+	// SupabaseRetries counts retried Supabase requests per upstream
+	SupabaseRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "supabase",
+		Name:      "retries_total",
+		Help:      "Total number of retried Supabase requests per upstream.",
+	}, []string{"upstream"})
+
+	// CircuitBreakerState exposes the breaker state per upstream
+	// (0 closed, 1 half-open, 2 open)
+	CircuitBreakerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "supabase",
+		Name:      "circuit_breaker_state",
+		Help:      "Circuit breaker state per upstream (0 closed, 1 half-open, 2 open).",
+	}, []string{"upstream"})
+
+	// LoginAttempts counts login attempts by result
+	LoginAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "login_attempts_total",
+		Help:      "Total number of login attempts by result.",
+	}, []string{"result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequestsTotal,
+		HTTPRequestDuration,
+		HTTPRequestsInFlight,
+		SupabaseCallDuration,
+		SupabaseCallErrors,
+		SupabaseRetries,
+		CircuitBreakerState,
+		LoginAttempts,
+	)
+}
+
+// Handler returns the HTTP handler serving the metrics endpoint
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// StatusClass returns the status class label (e.g. "2xx") for a status code
+func StatusClass(status int) string {
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// ObserveSupabaseCall records the latency and outcome of a Supabase call
+// started at start
+func ObserveSupabaseCall(repository, method string, start time.Time, err error) {
+	SupabaseCallDuration.WithLabelValues(repository, method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		SupabaseCallErrors.WithLabelValues(repository, method).Inc()
+	}
+}
+
+// ObserveLogin records the result of a login attempt
+func ObserveLogin(success bool) {
+	result := "failure"
+	if success {
+		result = "success"
+	}
+	LoginAttempts.WithLabelValues(result).Inc()
+}
@@ -0,0 +1,44 @@
+package money
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Currency is an ISO 4217 currency
+type Currency struct {
+	Code string
+	// Exponent is the number of digits after the decimal separator of the
+	// currency's minor unit, e.g. 2 for USD cents and 0 for JPY
+	Exponent int32
+}
+
+// currencies lists the supported ISO 4217 currencies
+var currencies = map[string]Currency{}
+
+func init() {
+	for exponent, codes := range map[int32][]string{
+		0: {"CLP", "ISK", "JPY", "KRW", "PYG", "UGX", "VND", "XAF", "XOF"},
+		2: {
+			"AED", "ARS", "AUD", "BRL", "CAD", "CHF", "CNY", "COP", "CZK", "DKK",
+			"EGP", "EUR", "GBP", "HKD", "HUF", "IDR", "ILS", "INR", "MAD", "MXN",
+			"MYR", "NGN", "NOK", "NZD", "PEN", "PHP", "PKR", "PLN", "RON", "RUB",
+			"SAR", "SEK", "SGD", "THB", "TRY", "TWD", "UAH", "USD", "ZAR",
+		},
+		3: {"BHD", "IQD", "JOD", "KWD", "LYD", "OMR", "TND"},
+	} {
+		for _, code := range codes {
+			currencies[code] = Currency{Code: code, Exponent: exponent}
+		}
+	}
+}
+
+// Lookup returns the currency with the given code, which is matched
+// case-insensitively
+func Lookup(code string) (Currency, error) {
+	currency, ok := currencies[strings.ToUpper(code)]
+	if !ok {
+		return Currency{}, fmt.Errorf("%w: %q", ErrUnknownCurrency, code)
+	}
+	return currency, nil
+}
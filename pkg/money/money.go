@@ -0,0 +1,86 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// Format selects how prices are written in API JSON
+type Format string
+
+// Supported price formats
+const (
+	// FormatDecimal writes prices as decimal strings in major units, e.g.
+	// "19.99"
+	FormatDecimal Format = "decimal"
+	// FormatMinor writes prices as integers in the currency's minor unit,
+	// e.g. 1999
+	FormatMinor Format = "minor"
+)
+
+var (
+	// ErrUnknownCurrency is returned for currency codes that are not
+	// supported
+	ErrUnknownCurrency = errors.New("unknown currency")
+
+	// ErrInvalidScale is returned when an amount has more decimal places than
+	// its currency allows
+	ErrInvalidScale = errors.New("amount has too many decimal places for its currency")
+)
+
+// ParseFormat parses a price format name
+func ParseFormat(name string) (Format, error) {
+	switch Format(name) {
+	case FormatDecimal, FormatMinor:
+		return Format(name), nil
+	}
+	return "", fmt.Errorf("unknown price format %q", name)
+}
+
+// Validate checks that amount is a valid amount of the given currency
+func Validate(amount decimal.Decimal, code string) error {
+	currency, err := Lookup(code)
+	if err != nil {
+		return err
+	}
+	if !amount.Equal(amount.Truncate(currency.Exponent)) {
+		return fmt.Errorf("%w: %s allows %d", ErrInvalidScale, currency.Code, currency.Exponent)
+	}
+	return nil
+}
+
+// ToMinor converts an amount in major units into minor units of the
+// currency, e.g. 19.99 USD into 1999
+func ToMinor(amount decimal.Decimal, code string) (int64, error) {
+	if err := Validate(amount, code); err != nil {
+		return 0, err
+	}
+	currency, _ := Lookup(code)
+	return amount.Shift(currency.Exponent).IntPart(), nil
+}
+
+// RoundToMinor converts an amount in major units into minor units of the
+// currency like ToMinor, rounding amounts with more decimal places than the
+// currency allows instead of rejecting them, e.g. 19.995 USD into 2000
+func RoundToMinor(amount decimal.Decimal, code string) (int64, error) {
+	currency, err := Lookup(code)
+	if err != nil {
+		return 0, err
+	}
+	return amount.Round(currency.Exponent).Shift(currency.Exponent).IntPart(), nil
+}
+
+// FromMinor converts an integral amount in minor units of the currency into
+// major units, e.g. 1999 USD into 19.99
+func FromMinor(minor decimal.Decimal, code string) (decimal.Decimal, error) {
+	currency, err := Lookup(code)
+	if err != nil {
+		return decimal.Decimal{}, err
+	}
+	if !minor.IsInteger() {
+		return decimal.Decimal{}, fmt.Errorf("%w: minor units must be an integer", ErrInvalidScale)
+	}
+	return minor.Shift(-currency.Exponent), nil
+}
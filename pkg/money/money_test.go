@@ -0,0 +1,87 @@
+package money
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestToMinor(t *testing.T) {
+	tests := []struct {
+		amount string
+		code   string
+		want   int64
+		err    error
+	}{
+		{"19.99", "USD", 1999, nil},
+		{"19.9", "usd", 1990, nil},
+		{"0", "EUR", 0, nil},
+		{"1500", "JPY", 1500, nil},
+		{"1.234", "KWD", 1234, nil},
+		{"19.999", "USD", 0, ErrInvalidScale},
+		{"1500.5", "JPY", 0, ErrInvalidScale},
+		{"1", "XXX", 0, ErrUnknownCurrency},
+	}
+	for _, tt := range tests {
+		got, err := ToMinor(decimal.RequireFromString(tt.amount), tt.code)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("ToMinor(%s, %s) error = %v, want %v", tt.amount, tt.code, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ToMinor(%s, %s) = %d, want %d", tt.amount, tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestRoundToMinor(t *testing.T) {
+	tests := []struct {
+		amount string
+		code   string
+		want   int64
+		err    error
+	}{
+		{"19.99", "USD", 1999, nil},
+		{"19.995", "USD", 2000, nil},
+		{"19.994", "USD", 1999, nil},
+		{"1500.5", "JPY", 1501, nil},
+		{"1.2345", "KWD", 1235, nil},
+		{"1", "XXX", 0, ErrUnknownCurrency},
+	}
+	for _, tt := range tests {
+		got, err := RoundToMinor(decimal.RequireFromString(tt.amount), tt.code)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("RoundToMinor(%s, %s) error = %v, want %v", tt.amount, tt.code, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("RoundToMinor(%s, %s) = %d, want %d", tt.amount, tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestFromMinor(t *testing.T) {
+	tests := []struct {
+		minor string
+		code  string
+		want  string
+		err   error
+	}{
+		{"1999", "USD", "19.99", nil},
+		{"1500", "JPY", "1500", nil},
+		{"1234", "KWD", "1.234", nil},
+		{"19.5", "USD", "", ErrInvalidScale},
+		{"1", "XXX", "", ErrUnknownCurrency},
+	}
+	for _, tt := range tests {
+		got, err := FromMinor(decimal.RequireFromString(tt.minor), tt.code)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("FromMinor(%s, %s) error = %v, want %v", tt.minor, tt.code, err, tt.err)
+			continue
+		}
+		if err == nil && !got.Equal(decimal.RequireFromString(tt.want)) {
+			t.Errorf("FromMinor(%s, %s) = %s, want %s", tt.minor, tt.code, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrNoRate is returned when no exchange rate is configured for a currency
+var ErrNoRate = errors.New("no exchange rate configured")
+
+// conversionPrecision is the number of decimal places kept while converting
+// before rounding to the target currency
+const conversionPrecision = 16
+
+// Rates is a locally configured exchange rate table relative to a base
+// currency
+type Rates struct {
+	base  string
+	rates map[string]decimal.Decimal
+}
+
+// ParseRates creates a rate table from "<code>=<rate>" pairs, each giving
+// the amount of that currency worth one unit of base
+func ParseRates(base string, pairs []string) (*Rates, error) {
+	baseCurrency, err := Lookup(base)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Rates{
+		base:  baseCurrency.Code,
+		rates: map[string]decimal.Decimal{baseCurrency.Code: decimal.NewFromInt(1)},
+	}
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid exchange rate %q: expected <code>=<rate>", pair)
+		}
+		currency, err := Lookup(strings.TrimSpace(parts[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid exchange rate %q: %w", pair, err)
+		}
+		rate, err := decimal.NewFromString(strings.TrimSpace(parts[1]))
+		if err != nil || !rate.IsPositive() {
+			return nil, fmt.Errorf("invalid exchange rate %q: bad rate", pair)
+		}
+		r.rates[currency.Code] = rate
+	}
+	return r, nil
+}
+
+// Base returns the base currency code
+func (r *Rates) Base() string {
+	return r.base
+}
+
+// Factors returns the factors converting amounts of each currency into to
+// before rounding, matching Convert. Amounts already in to convert as is;
+// other currencies are only listed when both have a rate.
+func (r *Rates) Factors(to string) (map[string]decimal.Decimal, error) {
+	toCurrency, err := Lookup(to)
+	if err != nil {
+		return nil, err
+	}
+
+	factors := map[string]decimal.Decimal{toCurrency.Code: decimal.NewFromInt(1)}
+	toRate, ok := r.rates[toCurrency.Code]
+	if !ok {
+		return factors, nil
+	}
+	for code, rate := range r.rates {
+		if code != toCurrency.Code {
+			factors[code] = toRate.DivRound(rate, conversionPrecision)
+		}
+	}
+	return factors, nil
+}
+
+// Convert converts amount from one currency into another, rounding half to
+// even to the target currency's minor unit
+func (r *Rates) Convert(amount decimal.Decimal, from, to string) (decimal.Decimal, error) {
+	fromCurrency, err := Lookup(from)
+	if err != nil {
+		return decimal.Decimal{}, err
+	}
+	toCurrency, err := Lookup(to)
+	if err != nil {
+		return decimal.Decimal{}, err
+	}
+	if fromCurrency.Code == toCurrency.Code {
+		return amount, nil
+	}
+
+	fromRate, ok := r.rates[fromCurrency.Code]
+	if !ok {
+		return decimal.Decimal{}, fmt.Errorf("%w: %s", ErrNoRate, fromCurrency.Code)
+	}
+	toRate, ok := r.rates[toCurrency.Code]
+	if !ok {
+		return decimal.Decimal{}, fmt.Errorf("%w: %s", ErrNoRate, toCurrency.Code)
+	}
+
+	converted := amount.Mul(toRate).DivRound(fromRate, conversionPrecision)
+	return converted.RoundBank(toCurrency.Exponent), nil
+}
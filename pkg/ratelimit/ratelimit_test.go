@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	policy := Policy{Name: "test", Limit: 3, Period: 3 * time.Second}
+
+	steps := []struct {
+		advance    time.Duration
+		key        string
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+	}{
+		{0, "a", true, 2, 0},
+		{0, "a", true, 1, 0},
+		{0, "a", true, 0, 0},
+		{0, "a", false, 0, time.Second},
+		{0, "b", true, 2, 0},
+		{500 * time.Millisecond, "a", false, 0, 500 * time.Millisecond},
+		{500 * time.Millisecond, "a", true, 0, 0},
+		{time.Hour, "a", true, 2, 0},
+	}
+	for i, step := range steps {
+		now = now.Add(step.advance)
+		res, err := store.Take(context.Background(), step.key, policy)
+		if err != nil {
+			t.Fatalf("step %d: Take() error = %v", i, err)
+		}
+		if res.Allowed != step.allowed || res.Remaining != step.remaining || res.RetryAfter != step.retryAfter {
+			t.Errorf("step %d: Take() = %+v, want allowed %v, remaining %d, retry after %v",
+				i, res, step.allowed, step.remaining, step.retryAfter)
+		}
+		if res.Limit != policy.Limit {
+			t.Errorf("step %d: limit = %d, want %d", i, res.Limit, policy.Limit)
+		}
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	store.lastSweep = now
+	policy := Policy{Name: "test", Limit: 1, Period: time.Second}
+
+	store.Take(context.Background(), "idle", policy)
+	now = now.Add(sweepInterval + time.Second)
+	store.Take(context.Background(), "active", policy)
+
+	if _, ok := store.buckets["idle"]; ok {
+		t.Error("idle bucket was not swept")
+	}
+	if _, ok := store.buckets["active"]; !ok {
+		t.Error("active bucket was swept")
+	}
+}
@@ -0,0 +1,184 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/peterlimg/supabase-e/pkg/metrics"
+)
+
+// ErrCircuitOpen is returned when a call is rejected by an open breaker
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// OpenError reports a call rejected by an open breaker and when to retry
+type OpenError struct {
+	Upstream   string
+	RetryAfter time.Duration
+}
+
+// Error implements error
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("%s: %s, retry after %s", e.Upstream, ErrCircuitOpen, e.RetryAfter.Round(time.Second))
+}
+
+// Unwrap allows errors.Is(err, ErrCircuitOpen)
+func (e *OpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+// State is the state of a circuit breaker
+type State int
+
+// Breaker states; the numeric values are exported as the state metric
+const (
+	StateClosed State = iota
+	StateHalfOpen
+	StateOpen
+)
+
+// String returns the state name
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	}
+	return "unknown"
+}
+
+// Breaker is a consecutive-failure circuit breaker for a single upstream.
+// After threshold consecutive failures it opens and rejects calls for
+// openTimeout, then lets a single trial call through (half-open) whose
+// outcome closes or re-opens it.
+type Breaker struct {
+	name        string
+	threshold   int
+	openTimeout time.Duration
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+// NewBreaker creates a closed breaker for the named upstream
+func NewBreaker(name string, threshold int, openTimeout time.Duration) *Breaker {
+	b := &Breaker{
+		name:        name,
+		threshold:   threshold,
+		openTimeout: openTimeout,
+	}
+	b.publish()
+	return b
+}
+
+// Name returns the upstream name
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State returns the current state, moving an expired open breaker to half-open
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+	return b.state
+}
+
+// Allow reports whether a call may proceed. Every allowed call must be
+// followed by exactly one call to Record or Release.
+func (b *Breaker) Allow() error {
+	if b.threshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+
+	switch b.state {
+	case StateOpen:
+		return &OpenError{Upstream: b.name, RetryAfter: b.openTimeout - time.Since(b.openedAt)}
+	case StateHalfOpen:
+		if b.trial {
+			// Only one trial call at a time while half-open
+			return &OpenError{Upstream: b.name, RetryAfter: time.Second}
+		}
+		b.trial = true
+	}
+	return nil
+}
+
+// Record records the outcome of an allowed call
+func (b *Breaker) Record(success bool) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if success {
+		b.failures = 0
+		b.trial = false
+		b.setState(StateClosed)
+		return
+	}
+
+	b.failures++
+	if b.state == StateHalfOpen || b.failures >= b.threshold {
+		b.trial = false
+		b.openedAt = time.Now()
+		b.setState(StateOpen)
+	}
+}
+
+// Release ends an allowed call whose outcome says nothing about the
+// upstream, such as one canceled by its caller. A half-open breaker stays
+// half-open and lets the next trial call through.
+func (b *Breaker) Release() {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+// Check is a health check that fails while the breaker is open
+func (b *Breaker) Check(_ context.Context) error {
+	if state := b.State(); state == StateOpen {
+		return fmt.Errorf("%s circuit breaker is %s", b.name, state)
+	}
+	return nil
+}
+
+// advance moves an open breaker to half-open once its timeout has elapsed.
+// Callers must hold b.mu.
+func (b *Breaker) advance() {
+	if b.state == StateOpen && time.Since(b.openedAt) >= b.openTimeout {
+		b.setState(StateHalfOpen)
+	}
+}
+
+// setState changes the state and publishes it. Callers must hold b.mu.
+func (b *Breaker) setState(state State) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	b.publish()
+}
+
+// publish exports the current state as a metric
+func (b *Breaker) publish() {
+	metrics.CircuitBreakerState.WithLabelValues(b.name).Set(float64(b.state))
+}
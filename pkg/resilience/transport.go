@@ -0,0 +1,192 @@
+package resilience
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/peterlimg/supabase-e/pkg/metrics"
+)
+
+// RetryPolicy controls retries of idempotent requests
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// Backoff returns the full-jitter exponential delay before the given retry
+// attempt (starting at 1)
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << (attempt - 1)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// Breakers holds one breaker per Supabase upstream
+type Breakers struct {
+	byName map[string]*Breaker
+}
+
+// Upstream names, derived from the Supabase API path prefix
+const (
+	UpstreamPostgREST = "postgrest"
+	UpstreamAuth      = "auth"
+	UpstreamStorage   = "storage"
+)
+
+// NewBreakers creates a breaker for each Supabase upstream
+func NewBreakers(threshold int, openTimeout time.Duration) *Breakers {
+	b := &Breakers{byName: map[string]*Breaker{}}
+	for _, name := range []string{UpstreamPostgREST, UpstreamAuth, UpstreamStorage} {
+		b.byName[name] = NewBreaker(name, threshold, openTimeout)
+	}
+	return b
+}
+
+// Get returns the breaker for the named upstream, or nil if unknown
+func (b *Breakers) Get(name string) *Breaker {
+	return b.byName[name]
+}
+
+// forRequest returns the breaker guarding the request's upstream
+func (b *Breakers) forRequest(req *http.Request) *Breaker {
+	path := req.URL.Path
+	switch {
+	case strings.Contains(path, "/rest/v1"):
+		return b.byName[UpstreamPostgREST]
+	case strings.Contains(path, "/auth/v1"):
+		return b.byName[UpstreamAuth]
+	case strings.Contains(path, "/storage/v1"):
+		return b.byName[UpstreamStorage]
+	}
+	return nil
+}
+
+// transport retries idempotent requests and fails fast on open breakers
+type transport struct {
+	base     http.RoundTripper
+	breakers *Breakers
+	policy   RetryPolicy
+}
+
+// Transport wraps base with per-upstream circuit breaking and retry with
+// jitter for idempotent requests
+func Transport(base http.RoundTripper, breakers *Breakers, policy RetryPolicy) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base, breakers: breakers, policy: policy}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	breaker := t.breakers.forRequest(req)
+	retries := 0
+	if isIdempotent(req) {
+		retries = t.policy.MaxRetries
+	}
+
+	for attempt := 0; ; attempt++ {
+		if breaker != nil {
+			if err := breaker.Allow(); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := t.base.RoundTrip(req)
+		if breaker != nil {
+			if err != nil && req.Context().Err() != nil {
+				// Cancellations by our own caller are not the upstream's
+				// fault, nor do they show that it recovered
+				breaker.Release()
+			} else {
+				breaker.Record(!isFailure(resp, err))
+			}
+		}
+
+		if attempt >= retries || !isRetryable(req.Context(), resp, err) {
+			return resp, err
+		}
+
+		// Rewind the body for the next attempt
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return resp, err
+			}
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return resp, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		delay := t.policy.Backoff(attempt + 1)
+		if resp != nil {
+			if d := retryAfter(resp); d > delay && d <= t.policy.MaxDelay {
+				delay = d
+			}
+			resp.Body.Close()
+		}
+
+		if breaker != nil {
+			metrics.SupabaseRetries.WithLabelValues(breaker.Name()).Inc()
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// isIdempotent reports whether the request may safely be retried
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// isFailure reports whether the outcome counts against the upstream's breaker
+func isFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode >= http.StatusInternalServerError
+}
+
+// isRetryable reports whether the outcome is transient and worth retrying
+func isRetryable(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses a Retry-After header expressed in seconds
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
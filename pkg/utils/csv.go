@@ -0,0 +1,27 @@
+package utils
+
+import "strings"
+
+// csvFormulaPrefixes are the leading characters that make spreadsheet
+// programs evaluate a CSV cell as a formula, including tab and carriage
+// return, plus the quote that escapes them
+const csvFormulaPrefixes = "=+-@\t\r'"
+
+// EscapeCSVCell prefixes a text cell that a spreadsheet program would
+// evaluate as a formula with a quote, so that it is shown as text. Cells
+// already starting with a quote get another one, which keeps the escaping
+// reversible by UnescapeCSVCell.
+func EscapeCSVCell(value string) string {
+	if value != "" && strings.IndexByte(csvFormulaPrefixes, value[0]) >= 0 {
+		return "'" + value
+	}
+	return value
+}
+
+// UnescapeCSVCell reverses EscapeCSVCell
+func UnescapeCSVCell(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.IndexByte(csvFormulaPrefixes, value[1]) >= 0 {
+		return value[1:]
+	}
+	return value
+}
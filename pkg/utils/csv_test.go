@@ -0,0 +1,55 @@
+package utils
+
+import "testing"
+
+func TestEscapeCSVCell(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"=SUM(A1:A2)", "'=SUM(A1:A2)"},
+		{"+1", "'+1"},
+		{"-1", "'-1"},
+		{"@cmd", "'@cmd"},
+		{"\t=1+2", "'\t=1+2"},
+		{"\r=1+2", "'\r=1+2"},
+		{"'\tx", "''\tx"},
+		{"a\tb", "a\tb"},
+		{"'quoted", "''quoted"},
+		{"'=x", "''=x"},
+		{"plain", "plain"},
+		{"a=b", "a=b"},
+		{" =x", " =x"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		got := EscapeCSVCell(tt.value)
+		if got != tt.want {
+			t.Errorf("EscapeCSVCell(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+		if back := UnescapeCSVCell(got); back != tt.value {
+			t.Errorf("UnescapeCSVCell(%q) = %q, want %q", got, back, tt.value)
+		}
+	}
+}
+
+func TestUnescapeCSVCell(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"'=x", "=x"},
+		{"'\tx", "\tx"},
+		{"'\rx", "\rx"},
+		{"''", "'"},
+		{"'", "'"},
+		{"'abc", "'abc"},
+		{"abc", "abc"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := UnescapeCSVCell(tt.value); got != tt.want {
+			t.Errorf("UnescapeCSVCell(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
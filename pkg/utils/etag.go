@@ -0,0 +1,25 @@
+package utils
+
+import "strings"
+
+// MatchETag reports whether etag matches one of the entity tags in an
+// If-Match or If-None-Match header value. Strong comparison requires both
+// tags to be strong; weak comparison ignores the W/ prefix.
+func MatchETag(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+			continue
+		}
+		if !strings.HasPrefix(candidate, "W/") && candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package utils
+
+import "testing"
+
+func TestMatchETag(t *testing.T) {
+	tests := []struct {
+		header string
+		etag   string
+		weak   bool
+		want   bool
+	}{
+		{`"a"`, `"a"`, false, true},
+		{`"a"`, `"b"`, false, false},
+		{`"b", "a"`, `"a"`, false, true},
+		{` "b" ,"a" `, `"a"`, false, true},
+		{`*`, `"a"`, false, true},
+		{`W/"a"`, `"a"`, false, false},
+		{`"a"`, `W/"a"`, false, false},
+		{`W/"a"`, `"a"`, true, true},
+		{`"a"`, `W/"a"`, true, true},
+		{`W/"a"`, `W/"a"`, true, true},
+		{`W/"b"`, `"a"`, true, false},
+		{``, `"a"`, false, false},
+	}
+	for _, tt := range tests {
+		if got := MatchETag(tt.header, tt.etag, tt.weak); got != tt.want {
+			t.Errorf("MatchETag(%q, %q, %v) = %v, want %v", tt.header, tt.etag, tt.weak, got, tt.want)
+		}
+	}
+}
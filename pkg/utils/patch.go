@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// Patch media types
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+var (
+	// ErrMalformedPatch is returned when a patch document cannot be parsed or
+	// applied
+	ErrMalformedPatch = errors.New("malformed patch")
+
+	// ErrUnsupportedPatchType is returned for patch media types other than
+	// merge patch and JSON patch
+	ErrUnsupportedPatchType = errors.New("unsupported patch media type")
+
+	// ErrValidation is returned when a patched document fails validation
+	ErrValidation = errors.New("validation failed")
+)
+
+// Patch is a patch document together with its media type
+type Patch struct {
+	ContentType string
+	Body        []byte
+}
+
+// NewPatch creates a patch from a request body and Content-Type header.
+// Plain application/json is treated as a JSON merge patch.
+func NewPatch(contentType string, body []byte) (Patch, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil && contentType != "" {
+		return Patch{}, fmt.Errorf("%w: %s", ErrUnsupportedPatchType, contentType)
+	}
+
+	switch mediaType {
+	case MergePatchContentType, "application/json", "":
+		return Patch{ContentType: MergePatchContentType, Body: body}, nil
+	case JSONPatchContentType:
+		return Patch{ContentType: JSONPatchContentType, Body: body}, nil
+	}
+	return Patch{}, fmt.Errorf("%w: %s", ErrUnsupportedPatchType, mediaType)
+}
+
+// ApplyTo applies the patch to current and decodes the result into target,
+// which is then validated using its binding tags and its Validate method if
+// it has one. Fields unknown to target are rejected so that patches cannot
+// silently touch read-only data.
+func (p Patch) ApplyTo(current interface{}, target interface{}) error {
+	doc, err := json.Marshal(current)
+	if err != nil {
+		return fmt.Errorf("failed to encode document: %w", err)
+	}
+
+	var patched []byte
+	switch p.ContentType {
+	case JSONPatchContentType:
+		ops, err := jsonpatch.DecodePatch(p.Body)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrMalformedPatch, err)
+		}
+		patched, err = ops.Apply(doc)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrMalformedPatch, err)
+		}
+	default:
+		if !json.Valid(p.Body) || bytes.TrimSpace(p.Body)[0] != '{' {
+			return fmt.Errorf("%w: merge patch must be a JSON object", ErrMalformedPatch)
+		}
+		patched, err = jsonpatch.MergePatch(doc, p.Body)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrMalformedPatch, err)
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(target); err != nil {
+		return fmt.Errorf("%w: %v", ErrValidation, err)
+	}
+
+	if err := binding.Validator.ValidateStruct(target); err != nil {
+		return fmt.Errorf("%w: %v", ErrValidation, err)
+	}
+
+	// Run checks that cannot be expressed as binding tags
+	if v, ok := target.(interface{ Validate() error }); ok {
+		if err := v.Validate(); err != nil {
+			return fmt.Errorf("%w: %v", ErrValidation, err)
+		}
+	}
+
+	return nil
+}
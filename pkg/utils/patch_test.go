@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// patchTarget is a document patched in tests
+type patchTarget struct {
+	Name  string `json:"name" binding:"required"`
+	Stock int    `json:"stock"`
+}
+
+// Validate rejects negative stock
+func (p *patchTarget) Validate() error {
+	if p.Stock < 0 {
+		return fmt.Errorf("stock must not be negative")
+	}
+	return nil
+}
+
+func TestNewPatch(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        string
+		err         error
+	}{
+		{"", MergePatchContentType, nil},
+		{"application/json", MergePatchContentType, nil},
+		{"application/merge-patch+json; charset=utf-8", MergePatchContentType, nil},
+		{"application/json-patch+json", JSONPatchContentType, nil},
+		{"text/plain", "", ErrUnsupportedPatchType},
+		{"not a media type;", "", ErrUnsupportedPatchType},
+	}
+	for _, tt := range tests {
+		patch, err := NewPatch(tt.contentType, []byte(`{}`))
+		if !errors.Is(err, tt.err) {
+			t.Errorf("NewPatch(%q) error = %v, want %v", tt.contentType, err, tt.err)
+			continue
+		}
+		if patch.ContentType != tt.want {
+			t.Errorf("NewPatch(%q) content type = %q, want %q", tt.contentType, patch.ContentType, tt.want)
+		}
+	}
+}
+
+func TestPatchApplyTo(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        patchTarget
+		err         error
+	}{
+		{"merge", MergePatchContentType, `{"stock": 5}`, patchTarget{Name: "widget", Stock: 5}, nil},
+		{"merge with whitespace", MergePatchContentType, "  \n{\"name\": \"gadget\"}", patchTarget{Name: "gadget", Stock: 2}, nil},
+		{"json patch", JSONPatchContentType, `[{"op": "replace", "path": "/stock", "value": 7}]`, patchTarget{Name: "widget", Stock: 7}, nil},
+		{"merge array", MergePatchContentType, `[]`, patchTarget{}, ErrMalformedPatch},
+		{"merge invalid json", MergePatchContentType, `{`, patchTarget{}, ErrMalformedPatch},
+		{"json patch bad path", JSONPatchContentType, `[{"op": "remove", "path": "/missing"}]`, patchTarget{}, ErrMalformedPatch},
+		{"json patch not a list", JSONPatchContentType, `{}`, patchTarget{}, ErrMalformedPatch},
+		{"unknown field", MergePatchContentType, `{"id": "x"}`, patchTarget{}, ErrValidation},
+		{"binding", MergePatchContentType, `{"name": null}`, patchTarget{}, ErrValidation},
+		{"validate", MergePatchContentType, `{"stock": -1}`, patchTarget{}, ErrValidation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch := Patch{ContentType: tt.contentType, Body: []byte(tt.body)}
+			var got patchTarget
+			err := patch.ApplyTo(patchTarget{Name: "widget", Stock: 2}, &got)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ApplyTo() error = %v, want %v", err, tt.err)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("ApplyTo() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,17 +1,37 @@
 package utils
 
 import (
+	"context"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/peterlimg/supabase-e/pkg/resilience"
 )
 
+// Error codes returned in the code field of error responses
+const (
+	ErrCodeRequestTimeout  = "REQUEST_TIMEOUT"
+	ErrCodeRequestCanceled = "REQUEST_CANCELED"
+	ErrCodeUnavailable     = "UPSTREAM_UNAVAILABLE"
+	ErrCodeRateLimited     = "RATE_LIMITED"
+)
+
+// StatusClientClosedRequest is the non-standard status used when the client
+// went away before the request finished
+const StatusClientClosedRequest = 499
+
 // Response represents a standard API response
 type Response struct {
 	Success bool        `json:"success"`
 	Message string      `json:"message,omitempty"`
 	Data    interface{} `json:"data,omitempty"`
+	Meta    interface{} `json:"meta,omitempty"`
 	Error   string      `json:"error,omitempty"`
+	Code    string      `json:"code,omitempty"`
 }
 
 // SuccessResponse returns a success response
@@ -23,8 +43,38 @@ func SuccessResponse(c *gin.Context, statusCode int, message string, data interf
 	})
 }
 
-// ErrorResponse returns an error response
+// SuccessResponseWithMeta returns a success response with metadata about the
+// data, such as facet counts of a listing
+func SuccessResponseWithMeta(c *gin.Context, statusCode int, message string, data, meta interface{}) {
+	c.JSON(statusCode, Response{
+		Success: true,
+		Message: message,
+		Data:    data,
+		Meta:    meta,
+	})
+}
+
+// ErrorResponse returns an error response. Errors caused by the request
+// deadline or by the client going away are reported as such regardless of the
+// given status code, as are calls rejected by an open circuit breaker.
 func ErrorResponse(c *gin.Context, statusCode int, message string, err error) {
+	var openErr *resilience.OpenError
+	switch {
+	case errors.As(err, &openErr):
+		ServiceUnavailableResponse(c, openErr.RetryAfter)
+		return
+	case errors.Is(err, context.DeadlineExceeded):
+		GatewayTimeoutResponse(c)
+		return
+	case errors.Is(err, context.Canceled):
+		c.JSON(StatusClientClosedRequest, Response{
+			Success: false,
+			Message: "Request canceled",
+			Code:    ErrCodeRequestCanceled,
+		})
+		return
+	}
+
 	errMsg := ""
 	if err != nil {
 		errMsg = err.Error()
@@ -61,3 +111,36 @@ func NotFoundResponse(c *gin.Context, message string) {
 func InternalServerErrorResponse(c *gin.Context, err error) {
 	ErrorResponse(c, http.StatusInternalServerError, "Internal server error", err)
 }
+
+// GatewayTimeoutResponse returns a 504 Gateway Timeout response
+func GatewayTimeoutResponse(c *gin.Context) {
+	c.JSON(http.StatusGatewayTimeout, Response{
+		Success: false,
+		Message: "Request timed out",
+		Code:    ErrCodeRequestTimeout,
+	})
+}
+
+// ServiceUnavailableResponse returns a 503 Service Unavailable response
+// telling the client when to retry
+func ServiceUnavailableResponse(c *gin.Context, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusServiceUnavailable, Response{
+		Success: false,
+		Message: "Service temporarily unavailable",
+		Code:    ErrCodeUnavailable,
+	})
+}
+
+// TooManyRequestsResponse returns a 429 Too Many Requests response
+func TooManyRequestsResponse(c *gin.Context) {
+	c.JSON(http.StatusTooManyRequests, Response{
+		Success: false,
+		Message: "Too many requests",
+		Code:    ErrCodeRateLimited,
+	})
+}
@@ -0,0 +1,48 @@
+package utils
+
+import "testing"
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Crème Brûlée & Co", "creme-brulee-co"},
+		{"Hello World", "hello-world"},
+		{"  --Leading and trailing--  ", "leading-and-trailing"},
+		{"Size 10.5", "size-10-5"},
+		{"Ñandú", "nandu"},
+		{"日本語", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		got := Slugify(tt.name)
+		if got != tt.want {
+			t.Errorf("Slugify(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+		if got != "" && !ValidSlug(got) {
+			t.Errorf("Slugify(%q) = %q, which is not a valid slug", tt.name, got)
+		}
+	}
+}
+
+func TestValidSlug(t *testing.T) {
+	tests := []struct {
+		slug string
+		want bool
+	}{
+		{"abc", true},
+		{"a-b-1", true},
+		{"", false},
+		{"-abc", false},
+		{"abc-", false},
+		{"a--b", false},
+		{"ABC", false},
+		{"a_b", false},
+	}
+	for _, tt := range tests {
+		if got := ValidSlug(tt.slug); got != tt.want {
+			t.Errorf("ValidSlug(%q) = %v, want %v", tt.slug, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+// readPart returns the content of a part of a workbook
+func readPart(t *testing.T, workbook []byte, name string) string {
+	t.Helper()
+	archive, err := zip.NewReader(bytes.NewReader(workbook), int64(len(workbook)))
+	if err != nil {
+		t.Fatalf("workbook is not a zip archive: %v", err)
+	}
+	f, err := archive.Open(name)
+	if err != nil {
+		t.Fatalf("workbook has no %s: %v", name, err)
+	}
+	defer f.Close()
+	content, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", name, err)
+	}
+	return string(content)
+}
+
+// worksheet is the decoded sheetData of a worksheet
+type worksheet struct {
+	Rows []struct {
+		Ref   string `xml:"r,attr"`
+		Cells []struct {
+			Ref    string `xml:"r,attr"`
+			Type   string `xml:"t,attr"`
+			Value  string `xml:"v"`
+			Inline string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, `Products <"&">`)
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	rows := [][]interface{}{
+		{"sku", "name", "price", "stock"},
+		{"A-1", "Fish & Chips <large>", decimal.RequireFromString("12.50"), 3},
+		{"A-2", nil, decimal.RequireFromString("-0.5"), int64(1) << 40},
+		{"=SUM(A1:A2)", "  padded  ", "line\nbreak", "\x00bell\x07"},
+	}
+	for _, row := range rows {
+		if err := w.WriteRow(row); err != nil {
+			t.Fatalf("WriteRow(%v) error = %v", row, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/_rels/workbook.xml.rels"} {
+		if content := readPart(t, buf.Bytes(), name); content == "" {
+			t.Errorf("%s is empty", name)
+		}
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.Unmarshal([]byte(readPart(t, buf.Bytes(), "xl/workbook.xml")), &workbook); err != nil {
+		t.Fatalf("workbook.xml is not well-formed: %v", err)
+	}
+	if len(workbook.Sheets) != 1 || workbook.Sheets[0].Name != `Products <"&">` {
+		t.Errorf("sheets = %+v, want one named %q", workbook.Sheets, `Products <"&">`)
+	}
+
+	var sheet worksheet
+	if err := xml.Unmarshal([]byte(readPart(t, buf.Bytes(), "xl/worksheets/sheet1.xml")), &sheet); err != nil {
+		t.Fatalf("sheet1.xml is not well-formed: %v", err)
+	}
+
+	type cell struct{ ref, typ, value string }
+	want := [][]cell{
+		{{"A1", "inlineStr", "sku"}, {"B1", "inlineStr", "name"}, {"C1", "inlineStr", "price"}, {"D1", "inlineStr", "stock"}},
+		{{"A2", "inlineStr", "A-1"}, {"B2", "inlineStr", "Fish & Chips <large>"}, {"C2", "", "12.5"}, {"D2", "", "3"}},
+		{{"A3", "inlineStr", "A-2"}, {"C3", "", "-0.5"}, {"D3", "", "1099511627776"}},
+		{{"A4", "inlineStr", "=SUM(A1:A2)"}, {"B4", "inlineStr", "  padded  "}, {"C4", "inlineStr", "line\nbreak"}, {"D4", "inlineStr", "\uFFFDbell\uFFFD"}},
+	}
+	if len(sheet.Rows) != len(want) {
+		t.Fatalf("rows = %d, want %d", len(sheet.Rows), len(want))
+	}
+	for i, row := range sheet.Rows {
+		if row.Ref != strconv.Itoa(i+1) {
+			t.Errorf("row %d ref = %q", i, row.Ref)
+		}
+		if len(row.Cells) != len(want[i]) {
+			t.Errorf("row %d has %d cells, want %d", i, len(row.Cells), len(want[i]))
+			continue
+		}
+		for j, c := range row.Cells {
+			value := c.Value
+			if c.Type == "inlineStr" {
+				value = c.Inline
+			}
+			if got := (cell{c.Ref, c.Type, value}); got != want[i][j] {
+				t.Errorf("cell %d,%d = %+v, want %+v", i, j, got, want[i][j])
+			}
+		}
+	}
+}
+
+func TestWriteRowUnsupportedType(t *testing.T) {
+	w, err := NewWriter(io.Discard, "Sheet")
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	if err := w.WriteRow([]interface{}{1.5}); err == nil {
+		t.Error("WriteRow() with a float succeeded, want an error")
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	tests := []struct {
+		index int
+		want  string
+	}{
+		{0, "A"},
+		{1, "B"},
+		{25, "Z"},
+		{26, "AA"},
+		{27, "AB"},
+		{51, "AZ"},
+		{52, "BA"},
+		{701, "ZZ"},
+		{702, "AAA"},
+		{16383, "XFD"},
+	}
+	for _, tt := range tests {
+		if got := columnName(tt.index); got != tt.want {
+			t.Errorf("columnName(%d) = %q, want %q", tt.index, got, tt.want)
+		}
+	}
+}
@@ -7,6 +7,7 @@
 API_URL="http://127.0.0.1:8080/api/v1"
 TOKEN=""
 USER_ID=""
+CATEGORY_ID=""
 
 # Colors for output
 GREEN='\033[0;32m'
@@ -113,6 +114,26 @@ get_profile() {
   fi
 }
 
+# Function to pick a category for the test product. Categories are created
+# by admins, so at least one must exist already.
+get_category() {
+  print_header "Listing categories"
+  
+  response=$(curl -s -X GET "${API_URL}/categories" \
+    -H "Authorization: Bearer $TOKEN")
+  
+  echo "$response" | jq .
+  
+  CATEGORY_ID=$(echo "$response" | jq -r '.data[0].id // empty')
+  if [ -n "$CATEGORY_ID" ]; then
+    echo -e "${GREEN}Using category $CATEGORY_ID${NC}"
+    return 0
+  else
+    echo -e "${RED}No categories found; create one as an admin first.${NC}"
+    return 1
+  fi
+}
+
 # Function to create a product
 create_product() {
   print_header "Creating a product"
@@ -124,8 +145,9 @@ create_product() {
       "name": "Test Product",
       "description": "This is a test product created by the API test script",
       "price": 99.99,
-      "category": "test",
-      "image_url": "https://example.com/image.jpg"
+      "category_id": "'"$CATEGORY_ID"'",
+      "image_url": "https://example.com/image.jpg",
+      "status": "published"
     }')
   
   echo "$response" | jq .
@@ -212,6 +234,7 @@ main() {
   # If login successful, continue with other tests
   if [ -n "$TOKEN" ]; then
     get_profile
+    get_category
     create_product
     list_products
     